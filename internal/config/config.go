@@ -10,6 +10,8 @@ import (
 type Config struct {
 	Server struct {
 		Port string `toml:"port"`
+		// ShutdownTimeout 收到退出信号后等待请求和进行中操作完成的秒数，默认 25
+		ShutdownTimeout int `toml:"shutdown_timeout"`
 	} `toml:"server"`
 	Web struct {
 		Account  string `toml:"account"`
@@ -25,6 +27,17 @@ type Config struct {
 		RPID      string   `toml:"rp_id"`
 		RPOrigins []string `toml:"rp_origins"`
 	} `toml:"passkey"`
+	WebSocket struct {
+		// AllowedOrigins 允许跨域连接 WebSocket 的来源，为空时使用 Passkey.RPOrigins，同源连接始终允许
+		AllowedOrigins []string `toml:"allowed_origins"`
+	} `toml:"websocket"`
+	Metrics struct {
+		Token string `toml:"token"`
+	} `toml:"metrics"`
+	Jobs struct {
+		// Workers 同时执行的后台任务数（自动救援、开启/关闭 500Mbps、更换 IP 等），默认 4
+		Workers int `toml:"workers"`
+	} `toml:"jobs"`
 }
 
 func Load() *Config {
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BudgetController struct {
+	budgetService *services.BudgetService
+}
+
+func NewBudgetController(budgetService *services.BudgetService) *BudgetController {
+	return &BudgetController{
+		budgetService: budgetService,
+	}
+}
+
+type BudgetConfigRequest struct {
+	ConfigID string `json:"configId" binding:"required"`
+}
+
+type SetBudgetRequest struct {
+	ConfigID string  `json:"configId" binding:"required"`
+	Amount   float64 `json:"amount" binding:"required"`
+	AutoStop bool    `json:"autoStop"` // 达到 100% 时停止非免费实例
+	Mirror   bool    `json:"mirror"`   // 同步到 OCI Budgets
+}
+
+// GetBudget 获取配置的预算和本月使用情况，未设置预算时返回 null
+func (bc *BudgetController) GetBudget(c *gin.Context) {
+	var req BudgetConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	status, err := bc.budgetService.GetBudget(req.ConfigID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, models.SuccessResponse(nil, "未设置预算"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(status, "Success"))
+}
+
+// SetBudget 设置配置的月度预算
+func (bc *BudgetController) SetBudget(c *gin.Context) {
+	var req SetBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	budget, err := bc.budgetService.SetBudget(req.ConfigID, req.Amount, req.AutoStop, req.Mirror)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	message := "预算已保存"
+	if budget.MirrorError != "" {
+		message = "预算已保存，但同步到 OCI 失败: " + budget.MirrorError
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(budget, message))
+}
+
+// DeleteBudget 删除配置的预算
+func (bc *BudgetController) DeleteBudget(c *gin.Context) {
+	var req BudgetConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	if err := bc.budgetService.DeleteBudget(req.ConfigID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "预算已删除"))
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type IdleController struct {
+	idleGuardService *services.IdleGuardService
+}
+
+func NewIdleController(idleGuardService *services.IdleGuardService) *IdleController {
+	return &IdleController{
+		idleGuardService: idleGuardService,
+	}
+}
+
+type IdleListRequest struct {
+	ConfigID string `json:"configId"` // 为空时返回所有配置
+	Refresh  bool   `json:"refresh"`  // 立即重新评估
+	All      bool   `json:"all"`      // 同时返回无风险和无数据的实例
+}
+
+// ListIdleInstances 获取有空闲回收风险的 Always Free 实例
+func (ic *IdleController) ListIdleInstances(c *gin.Context) {
+	var req IdleListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	if req.Refresh {
+		if req.ConfigID != "" {
+			if _, err := ic.idleGuardService.AssessConfig(req.ConfigID); err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+				return
+			}
+		} else {
+			ic.idleGuardService.AssessAll(false)
+		}
+	}
+
+	result, err := ic.idleGuardService.List(req.ConfigID, req.All)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(result, "Success"))
+}
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/adiecho/oci-panel/internal/models"
 	"github.com/adiecho/oci-panel/internal/services"
@@ -10,10 +12,14 @@ import (
 
 type InstanceController struct {
 	instanceService *services.InstanceService
+	jobService      *services.JobService
 }
 
-func NewInstanceController(instanceService *services.InstanceService) *InstanceController {
-	return &InstanceController{instanceService: instanceService}
+func NewInstanceController(instanceService *services.InstanceService, jobService *services.JobService) *InstanceController {
+	return &InstanceController{
+		instanceService: instanceService,
+		jobService:      jobService,
+	}
 }
 
 type ListInstancesRequest struct {
@@ -40,6 +46,7 @@ func (ic *InstanceController) ListInstances(c *gin.Context) {
 type InstanceActionRequest struct {
 	UserId     string `json:"userId" binding:"required"`
 	InstanceId string `json:"instanceId" binding:"required"`
+	Region     string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 }
 
 func (ic *InstanceController) StartInstance(c *gin.Context) {
@@ -49,7 +56,7 @@ func (ic *InstanceController) StartInstance(c *gin.Context) {
 		return
 	}
 
-	if err := ic.instanceService.StartInstance(req.UserId, req.InstanceId); err != nil {
+	if err := ic.instanceService.StartInstance(req.UserId, req.InstanceId, req.Region); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
@@ -64,7 +71,7 @@ func (ic *InstanceController) StopInstance(c *gin.Context) {
 		return
 	}
 
-	if err := ic.instanceService.StopInstance(req.UserId, req.InstanceId); err != nil {
+	if err := ic.instanceService.StopInstance(req.UserId, req.InstanceId, req.Region); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
@@ -79,7 +86,7 @@ func (ic *InstanceController) RebootInstance(c *gin.Context) {
 		return
 	}
 
-	if err := ic.instanceService.RebootInstance(req.UserId, req.InstanceId); err != nil {
+	if err := ic.instanceService.RebootInstance(req.UserId, req.InstanceId, req.Region); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
@@ -94,7 +101,7 @@ func (ic *InstanceController) TerminateInstance(c *gin.Context) {
 		return
 	}
 
-	if err := ic.instanceService.TerminateInstance(req.UserId, req.InstanceId); err != nil {
+	if err := ic.instanceService.TerminateInstance(req.UserId, req.InstanceId, req.Region); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
@@ -105,6 +112,7 @@ func (ic *InstanceController) TerminateInstance(c *gin.Context) {
 type UpdateInstanceNameRequest struct {
 	UserId      string `json:"userId" binding:"required"`
 	InstanceId  string `json:"instanceId" binding:"required"`
+	Region      string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 	DisplayName string `json:"displayName" binding:"required"`
 }
 
@@ -115,7 +123,7 @@ func (ic *InstanceController) UpdateInstanceName(c *gin.Context) {
 		return
 	}
 
-	if err := ic.instanceService.UpdateInstanceName(req.UserId, req.InstanceId, req.DisplayName); err != nil {
+	if err := ic.instanceService.UpdateInstanceName(req.UserId, req.InstanceId, req.Region, req.DisplayName); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
@@ -126,6 +134,7 @@ func (ic *InstanceController) UpdateInstanceName(c *gin.Context) {
 type ChangeIPRequest struct {
 	UserId     string `json:"userId" binding:"required"`
 	InstanceId string `json:"instanceId" binding:"required"`
+	Region     string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 }
 
 func (ic *InstanceController) ChangePublicIP(c *gin.Context) {
@@ -135,18 +144,22 @@ func (ic *InstanceController) ChangePublicIP(c *gin.Context) {
 		return
 	}
 
-	newIP, err := ic.instanceService.ChangePublicIP(req.UserId, req.InstanceId)
+	// 后台任务执行，新 IP 通过 /api/jobs/get 的 result 查询
+	job, err := ic.jobService.Submit(c.Request.Context(), services.JobKindChangePublicIP, req.UserId, req.InstanceId, services.ChangePublicIPJobParams{
+		Region: req.Region,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, models.SuccessResponse(map[string]string{"newIP": newIP}, "IP更改成功"))
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"jobId": job.ID}, "IP更换任务已提交"))
 }
 
 type UpdateInstanceConfigRequest struct {
 	UserId      string  `json:"userId" binding:"required"`
 	InstanceId  string  `json:"instanceId" binding:"required"`
+	Region      string  `json:"region"` // 实例所在区域，为空时使用配置所在区域
 	Ocpus       float32 `json:"ocpus" binding:"required,gt=0"`
 	MemoryInGBs float32 `json:"memoryInGBs" binding:"required,gt=0"`
 	AutoRestart bool    `json:"autoRestart"` // 是否自动重启实例，默认false
@@ -159,7 +172,7 @@ func (ic *InstanceController) UpdateInstanceConfig(c *gin.Context) {
 		return
 	}
 
-	if err := ic.instanceService.UpdateInstanceConfig(req.UserId, req.InstanceId, req.Ocpus, req.MemoryInGBs, req.AutoRestart); err != nil {
+	if err := ic.instanceService.UpdateInstanceConfig(req.UserId, req.InstanceId, req.Region, req.Ocpus, req.MemoryInGBs, req.AutoRestart); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
@@ -174,6 +187,7 @@ func (ic *InstanceController) UpdateInstanceConfig(c *gin.Context) {
 type UpdateBootVolumeRequest struct {
 	UserId     string `json:"userId" binding:"required"`
 	InstanceId string `json:"instanceId" binding:"required"`
+	Region     string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 	SizeInGBs  int64  `json:"sizeInGBs" binding:"required,gt=0"`
 	VpusPerGB  int64  `json:"vpusPerGB" binding:"required,gt=0"`
 }
@@ -185,7 +199,7 @@ func (ic *InstanceController) UpdateBootVolume(c *gin.Context) {
 		return
 	}
 
-	if err := ic.instanceService.UpdateBootVolumeConfig(req.UserId, req.InstanceId, req.SizeInGBs, req.VpusPerGB); err != nil {
+	if err := ic.instanceService.UpdateBootVolumeConfig(req.UserId, req.InstanceId, req.Region, req.SizeInGBs, req.VpusPerGB); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
@@ -218,6 +232,7 @@ func (ic *InstanceController) UpdateBootVolumeById(c *gin.Context) {
 type CreateCloudShellRequest struct {
 	UserId     string `json:"userId" binding:"required"`
 	InstanceId string `json:"instanceId" binding:"required"`
+	Region     string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 	PublicKey  string `json:"publicKey" binding:"required"`
 }
 
@@ -228,7 +243,7 @@ func (ic *InstanceController) CreateCloudShell(c *gin.Context) {
 		return
 	}
 
-	result, err := ic.instanceService.CreateCloudShellConnection(req.UserId, req.InstanceId, req.PublicKey)
+	result, err := ic.instanceService.CreateCloudShellConnection(req.UserId, req.InstanceId, req.Region, req.PublicKey)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
@@ -240,6 +255,7 @@ func (ic *InstanceController) CreateCloudShell(c *gin.Context) {
 type AttachIPv6Request struct {
 	UserId     string `json:"userId" binding:"required"`
 	InstanceId string `json:"instanceId" binding:"required"`
+	Region     string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 }
 
 func (ic *InstanceController) AttachIPv6(c *gin.Context) {
@@ -249,7 +265,7 @@ func (ic *InstanceController) AttachIPv6(c *gin.Context) {
 		return
 	}
 
-	ipv6Address, err := ic.instanceService.AttachIPv6(req.UserId, req.InstanceId)
+	ipv6Address, err := ic.instanceService.AttachIPv6(req.UserId, req.InstanceId, req.Region)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
@@ -261,6 +277,7 @@ func (ic *InstanceController) AttachIPv6(c *gin.Context) {
 type AutoRescueRequest struct {
 	UserId       string `json:"userId" binding:"required"`
 	InstanceId   string `json:"instanceId" binding:"required"`
+	Region       string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 	InstanceName string `json:"instanceName"`
 	KeepBackup   bool   `json:"keepBackup"`
 }
@@ -272,31 +289,25 @@ func (ic *InstanceController) AutoRescue(c *gin.Context) {
 		return
 	}
 
-	// 异步执行救援任务
-	go func() {
-		progressChan := make(chan services.AutoRescueProgress, 10)
-		go func() {
-			for progress := range progressChan {
-				// 进度可通过WebSocket推送，这里仅记录日志
-				_ = progress
-			}
-		}()
-
-		err := ic.instanceService.AutoRescue(req.UserId, req.InstanceId, req.InstanceName, req.KeepBackup, progressChan)
-		close(progressChan)
-		if err != nil {
-			// 记录错误日志
-			_ = err
-		}
-	}()
+	// 后台任务执行，进度写入日志并推送到实时日志流（rescue:<instanceId> 或 job:<jobId> 主题）
+	job, err := ic.jobService.Submit(c.Request.Context(), services.JobKindAutoRescue, req.UserId, req.InstanceId, services.AutoRescueJobParams{
+		Region:       req.Region,
+		InstanceName: req.InstanceName,
+		KeepBackup:   req.KeepBackup,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
 
-	c.JSON(http.StatusOK, models.SuccessResponse(nil, "自动救援任务已启动，请等待完成"))
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"jobId": job.ID}, "自动救援任务已启动，请等待完成"))
 }
 
-// Enable500MbpsRequest 一键开启500Mbps请求（简化版，仅需要userId和instanceId）
+// Enable500MbpsRequest 一键开启500Mbps请求（简化版，仅需要userId和instanceId，可选region）
 type Enable500MbpsRequest struct {
 	UserId     string `json:"userId" binding:"required"`
 	InstanceId string `json:"instanceId" binding:"required"`
+	Region     string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 }
 
 // Enable500Mbps 一键开启下行500Mbps
@@ -311,27 +322,26 @@ func (ic *InstanceController) Enable500Mbps(c *gin.Context) {
 	}
 
 	// 使用默认SSH端口22
-	sshPort := 22
-
-	// 异步执行
-	go func() {
-		publicIP, err := ic.instanceService.Enable500Mbps(req.UserId, req.InstanceId, sshPort)
-		if err != nil {
-			_ = err
-		} else {
-			_ = publicIP
-		}
-	}()
+	job, err := ic.jobService.Submit(c.Request.Context(), services.JobKindEnable500Mbps, req.UserId, req.InstanceId, services.Enable500MbpsJobParams{
+		Region:  req.Region,
+		SSHPort: 22,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
 
 	c.JSON(http.StatusOK, models.SuccessResponse(map[string]interface{}{
+		"jobId":   job.ID,
 		"warning": "开启后实例原公网IP将失效，请使用新分配的负载均衡器IP访问。此操作仅支持 VM.Standard.E2.1.Micro 实例。",
 	}, "500Mbps开启任务已启动，正在创建NAT网关和网络负载均衡器，请稍候..."))
 }
 
-// Disable500MbpsRequest 一键关闭500Mbps请求（简化版，仅需要userId和instanceId）
+// Disable500MbpsRequest 一键关闭500Mbps请求（简化版，仅需要userId和instanceId，可选region）
 type Disable500MbpsRequest struct {
 	UserId     string `json:"userId" binding:"required"`
 	InstanceId string `json:"instanceId" binding:"required"`
+	Region     string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 }
 
 // Disable500Mbps 一键关闭下行500Mbps
@@ -345,18 +355,18 @@ func (ic *InstanceController) Disable500Mbps(c *gin.Context) {
 	}
 
 	// 默认清理所有资源（NAT网关和网络负载均衡器）
-	retainNatGw := false
-	retainNlb := false
-
-	// 异步执行
-	go func() {
-		err := ic.instanceService.Disable500Mbps(req.UserId, req.InstanceId, retainNatGw, retainNlb)
-		if err != nil {
-			_ = err
-		}
-	}()
+	job, err := ic.jobService.Submit(c.Request.Context(), services.JobKindDisable500Mbps, req.UserId, req.InstanceId, services.Disable500MbpsJobParams{
+		Region:      req.Region,
+		RetainNatGw: false,
+		RetainNlb:   false,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
 
 	c.JSON(http.StatusOK, models.SuccessResponse(map[string]interface{}{
+		"jobId":   job.ID,
 		"warning": "关闭后NAT网关和网络负载均衡器将被删除，实例将失去公网访问能力，需要重新分配公网IP。",
 	}, "500Mbps关闭任务已启动，正在清理NAT网关和网络负载均衡器，请稍候..."))
 }
@@ -366,6 +376,7 @@ func (ic *InstanceController) Disable500Mbps(c *gin.Context) {
 type Check500MbpsSupportRequest struct {
 	UserId     string `json:"userId" binding:"required"`
 	InstanceId string `json:"instanceId" binding:"required"`
+	Region     string `json:"region"` // 实例所在区域，为空时使用配置所在区域
 }
 
 func (ic *InstanceController) Check500MbpsSupport(c *gin.Context) {
@@ -375,7 +386,7 @@ func (ic *InstanceController) Check500MbpsSupport(c *gin.Context) {
 		return
 	}
 
-	supported, shape, err := ic.instanceService.Check500MbpsSupport(req.UserId, req.InstanceId)
+	supported, shape, err := ic.instanceService.Check500MbpsSupport(req.UserId, req.InstanceId, req.Region)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
@@ -394,3 +405,144 @@ func getShapeSupportMessage(supported bool) string {
 	}
 	return "此实例不支持500Mbps功能，仅 VM.Standard.E2.1.Micro 实例支持此功能"
 }
+
+// BulkInstanceActionRequest 批量实例操作请求，筛选条件见 services.BulkInstanceSelector
+type BulkInstanceActionRequest struct {
+	services.BulkInstanceSelector
+	Action      string `json:"action" binding:"required"`   // start, stop, reboot, terminate, changeIP, rename
+	NewName     string `json:"newName"`                     // rename 的名称模板，支持 {name}、{index}、{config}、{region}、{shape}
+	Concurrency int    `json:"concurrency" binding:"min=0"` // 同时处理的实例数，默认 5，最大 20
+	DryRun      bool   `json:"dryRun"`                      // 只返回选中的实例和执行计划，不执行
+	Confirm     bool   `json:"confirm"`                     // 未指定 instanceIds 时终止实例需要显式确认
+}
+
+// BulkAction 跨配置批量启动、停止、重启、终止、更换 IP 或重命名实例
+// 选中的实例和执行计划在提交时确定，执行作为后台任务进行，逐个实例的结果保存在任务结果中
+func (ic *InstanceController) BulkAction(c *gin.Context) {
+	var req BulkInstanceActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	if !services.IsBulkAction(req.Action) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "不支持的操作: "+req.Action))
+		return
+	}
+	if req.Action == services.BulkActionRename && req.NewName == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "重命名需要提供 newName"))
+		return
+	}
+	if req.Action == services.BulkActionTerminate && !req.DryRun && len(req.InstanceIDs) == 0 && !req.Confirm {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "按条件批量终止实例需要指定 instanceIds 或设置 confirm，建议先用 dryRun 预览"))
+		return
+	}
+	if req.Concurrency > services.BulkMaxConcurrency {
+		req.Concurrency = services.BulkMaxConcurrency
+	}
+
+	targets, errs, err := ic.instanceService.SelectInstances(c.Request.Context(), req.BulkInstanceSelector)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	plan := services.PlanBulkAction(req.Action, req.NewName, targets)
+	plan.Errors = errs
+	if req.DryRun {
+		c.JSON(http.StatusOK, models.SuccessResponse(plan, "预览完成"))
+		return
+	}
+	if plan.Planned == 0 {
+		plan.DryRun = false
+		c.JSON(http.StatusOK, models.SuccessResponse(plan, "没有需要执行的实例"))
+		return
+	}
+
+	job, err := ic.jobService.Submit(c.Request.Context(), services.JobKindBulkInstance, "", "", services.BulkActionParams{
+		Action:      req.Action,
+		Concurrency: req.Concurrency,
+		Items:       plan.Items,
+		Errors:      errs,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	plan.DryRun = false
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"jobId": job.ID,
+		"plan":  plan,
+	}, fmt.Sprintf("批量操作已提交，共 %d 个实例", plan.Planned)))
+}
+
+// RevealPassword 查看创建实例时注入的 root 密码（仅可查看一次）
+func (ic *InstanceController) RevealPassword(c *gin.Context) {
+	var req InstanceActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	result, err := ic.instanceService.RevealInstancePassword(req.UserId, req.InstanceId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(result, "请妥善保存密码，此后将无法再次查看"))
+}
+
+type InstanceMetricsRequest struct {
+	UserId     string   `json:"userId" binding:"required"`
+	InstanceId string   `json:"instanceId" binding:"required"`
+	Region     string   `json:"region"`    // 实例所在区域，为空时使用配置所在区域
+	Metrics    []string `json:"metrics"`   // 默认 CpuUtilization、MemoryUtilization
+	Interval   string   `json:"interval"`  // 1m 到 1d，默认 5m
+	Statistic  string   `json:"statistic"` // mean, max, min, sum, count, rate, p50, p90, p95, p99
+	StartTime  string   `json:"startTime"` // 2006-01-02 15:04:05，默认结束时间前 1 小时
+	EndTime    string   `json:"endTime"`   // 2006-01-02 15:04:05，默认当前时间
+}
+
+// GetInstanceMetrics 查询实例的 CPU、内存、磁盘等监控指标
+func (ic *InstanceController) GetInstanceMetrics(c *gin.Context) {
+	var req InstanceMetricsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	end := time.Now()
+	if req.EndTime != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", req.EndTime, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "结束时间格式错误"))
+			return
+		}
+		end = t
+	}
+	start := end.Add(-time.Hour)
+	if req.StartTime != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", req.StartTime, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "开始时间格式错误"))
+			return
+		}
+		start = t
+	}
+
+	series, err := ic.instanceService.GetInstanceMetrics(req.UserId, services.InstanceMetricsQuery{
+		InstanceID: req.InstanceId,
+		Region:     req.Region,
+		Metrics:    req.Metrics,
+		Interval:   req.Interval,
+		Statistic:  req.Statistic,
+		StartTime:  start,
+		EndTime:    end,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(series, "Success"))
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type JobController struct {
+	jobService *services.JobService
+}
+
+func NewJobController(jobService *services.JobService) *JobController {
+	return &JobController{
+		jobService: jobService,
+	}
+}
+
+type JobPageRequest struct {
+	Page     int    `json:"page" binding:"required,min=1"`
+	PageSize int    `json:"pageSize" binding:"required,min=1,max=100"`
+	ConfigID string `json:"configId"`
+	TargetID string `json:"targetId"`
+	Kind     string `json:"kind"`
+	Status   string `json:"status"` // pending, running, succeeded, failed, cancelled
+}
+
+// ListJobs 分页查询后台任务
+func (jc *JobController) ListJobs(c *gin.Context) {
+	var req JobPageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	jobs, total, err := jc.jobService.List(services.JobFilter{
+		ConfigID: req.ConfigID,
+		TargetID: req.TargetID,
+		Kind:     req.Kind,
+		Status:   req.Status,
+	}, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "查询失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"list":     jobs,
+		"total":    total,
+		"page":     req.Page,
+		"pageSize": req.PageSize,
+	}, ""))
+}
+
+type JobRequest struct {
+	JobID string `json:"jobId" binding:"required"`
+}
+
+// GetJob 查询后台任务的状态、进度和结果
+func (jc *JobController) GetJob(c *gin.Context) {
+	var req JobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	job, err := jc.jobService.Get(req.JobID)
+	if err != nil {
+		jc.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(job, ""))
+}
+
+// CancelJob 取消排队中或执行中的任务，已完成的步骤不会回滚
+func (jc *JobController) CancelJob(c *gin.Context) {
+	var req JobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	job, err := jc.jobService.Cancel(req.JobID)
+	if err != nil {
+		jc.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(job, "已请求取消任务"))
+}
+
+// RetryJob 使用原参数重新执行失败或已取消的任务
+func (jc *JobController) RetryJob(c *gin.Context) {
+	var req JobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	job, err := jc.jobService.Retry(req.JobID)
+	if err != nil {
+		jc.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(job, "任务已重新排队"))
+}
+
+func (jc *JobController) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, err.Error()))
+	case errors.Is(err, services.ErrJobFinished), errors.Is(err, services.ErrJobNotRetrying):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+	}
+}
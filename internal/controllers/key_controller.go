@@ -1,11 +1,15 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/adiecho/oci-panel/internal/database"
 	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -28,12 +32,25 @@ func (kc *KeyController) CreateKey(c *gin.Context) {
 		return
 	}
 
+	publicKey := strings.TrimSpace(req.PublicKey)
+	algorithm, fingerprint, err := services.ParseSSHPublicKey(publicKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	if err := checkDuplicateKey(fingerprint, ""); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
 	key := models.SSHKey{
-		ID:         uuid.New().String(),
-		Name:       req.Name,
-		PublicKey:  req.PublicKey,
-		KeyType:    "standalone",
-		CreateTime: time.Now(),
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		PublicKey:   publicKey,
+		KeyType:     "standalone",
+		Algorithm:   algorithm,
+		Fingerprint: fingerprint,
+		CreateTime:  time.Now(),
 	}
 
 	if err := database.GetDB().Create(&key).Error; err != nil {
@@ -41,7 +58,132 @@ func (kc *KeyController) CreateKey(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, models.SuccessResponse(key, "创建成功"))
+	c.JSON(http.StatusOK, models.SuccessResponse(toKeyResponse(&key), "创建成功"))
+}
+
+type GenerateKeyRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Algorithm string `json:"algorithm"` // ed25519 或 rsa，默认 ed25519
+	Bits      int    `json:"bits"`      // RSA 位数，默认 4096
+}
+
+// GenerateKey 服务端生成密钥对，私钥加密保存，仅允许下载一次
+func (kc *KeyController) GenerateKey(c *gin.Context) {
+	var req GenerateKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	publicKey, privateKey, err := services.GenerateSSHKeyPair(req.Algorithm, req.Bits, "oci-panel")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	algorithm, fingerprint, err := services.ParseSSHPublicKey(publicKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+	encrypted, err := services.EncryptSecret(privateKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "加密私钥失败"))
+		return
+	}
+
+	key := models.SSHKey{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		PublicKey:   publicKey,
+		PrivateKey:  encrypted,
+		KeyType:     "standalone",
+		Algorithm:   algorithm,
+		Fingerprint: fingerprint,
+		Generated:   true,
+		CreateTime:  time.Now(),
+	}
+
+	if err := database.GetDB().Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "创建密钥失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(toKeyResponse(&key), "生成成功，请及时下载私钥"))
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// DownloadPrivateKey 下载服务端生成的私钥，每个密钥仅可下载一次
+func (kc *KeyController) DownloadPrivateKey(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "缺少ID参数"))
+		return
+	}
+
+	db := database.GetDB()
+	var key models.SSHKey
+	if err := db.First(&key, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "密钥不存在"))
+		return
+	}
+	if !key.Generated || key.PrivateKey == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "该密钥没有可下载的私钥"))
+		return
+	}
+
+	// 条件更新保证并发请求时只有一个能成功下载
+	result := db.Model(&models.SSHKey{}).Where("id = ? AND private_downloaded = ?", key.ID, false).Update("private_downloaded", true)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "下载失败"))
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "私钥已下载过，无法再次下载"))
+		return
+	}
+
+	privateKey, err := services.DecryptSecret(key.PrivateKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	filename := unsafeFilenameChars.ReplaceAllString(key.Name, "_")
+	if filename == "" {
+		filename = key.ID
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".pem"))
+	c.Data(http.StatusOK, "application/x-pem-file", []byte(privateKey))
+}
+
+// checkDuplicateKey 检查是否已存在相同指纹的公钥
+func checkDuplicateKey(fingerprint, excludeID string) error {
+	var existing models.SSHKey
+	query := database.GetDB().Where("fingerprint = ?", fingerprint)
+	if excludeID != "" {
+		query = query.Where("id <> ?", excludeID)
+	}
+	if err := query.First(&existing).Error; err == nil {
+		return fmt.Errorf("公钥已存在: %s", existing.Name)
+	}
+	return nil
+}
+
+// toKeyResponse 转换密钥响应，旧数据的指纹在启动时由 services.BackfillSSHKeyFingerprints 补全
+func toKeyResponse(key *models.SSHKey) models.SSHKeyResponse {
+	return models.SSHKeyResponse{
+		ID:                key.ID,
+		Name:              key.Name,
+		PublicKey:         key.PublicKey,
+		KeyType:           key.KeyType,
+		ConfigID:          key.ConfigID,
+		Algorithm:         key.Algorithm,
+		Fingerprint:       key.Fingerprint,
+		Generated:         key.Generated,
+		PrivateDownloaded: key.PrivateDownloaded,
+		CreateTime:        key.CreateTime.Format("2006-01-02 15:04:05"),
+	}
 }
 
 type KeyPageRequest struct {
@@ -79,15 +221,9 @@ func (kc *KeyController) ListKeys(c *gin.Context) {
 	}
 
 	var responses []models.SSHKeyResponse
-	for _, key := range keys {
-		resp := models.SSHKeyResponse{
-			ID:         key.ID,
-			Name:       key.Name,
-			PublicKey:  key.PublicKey,
-			KeyType:    key.KeyType,
-			ConfigID:   key.ConfigID,
-			CreateTime: key.CreateTime.Format("2006-01-02 15:04:05"),
-		}
+	for i := range keys {
+		key := &keys[i]
+		resp := toKeyResponse(key)
 
 		if key.ConfigID != "" {
 			var config models.OciUser
@@ -115,14 +251,8 @@ func (kc *KeyController) GetAllStandaloneKeys(c *gin.Context) {
 	}
 
 	var responses []models.SSHKeyResponse
-	for _, key := range keys {
-		responses = append(responses, models.SSHKeyResponse{
-			ID:         key.ID,
-			Name:       key.Name,
-			PublicKey:  key.PublicKey,
-			KeyType:    key.KeyType,
-			CreateTime: key.CreateTime.Format("2006-01-02 15:04:05"),
-		})
+	for i := range keys {
+		responses = append(responses, toKeyResponse(&keys[i]))
 	}
 
 	c.JSON(http.StatusOK, models.SuccessResponse(responses, ""))
@@ -151,8 +281,24 @@ func (kc *KeyController) UpdateKey(c *gin.Context) {
 	if req.Name != "" {
 		updates["name"] = req.Name
 	}
-	if req.PublicKey != "" {
-		updates["public_key"] = req.PublicKey
+	if req.PublicKey != "" && strings.TrimSpace(req.PublicKey) != key.PublicKey {
+		if key.Generated {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "服务端生成的密钥不允许修改公钥"))
+			return
+		}
+		publicKey := strings.TrimSpace(req.PublicKey)
+		algorithm, fingerprint, err := services.ParseSSHPublicKey(publicKey)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+			return
+		}
+		if err := checkDuplicateKey(fingerprint, key.ID); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+			return
+		}
+		updates["public_key"] = publicKey
+		updates["algorithm"] = algorithm
+		updates["fingerprint"] = fingerprint
 	}
 
 	if len(updates) > 0 {
@@ -197,14 +343,5 @@ func (kc *KeyController) GetKeyByID(c *gin.Context) {
 		return
 	}
 
-	resp := models.SSHKeyResponse{
-		ID:         key.ID,
-		Name:       key.Name,
-		PublicKey:  key.PublicKey,
-		KeyType:    key.KeyType,
-		ConfigID:   key.ConfigID,
-		CreateTime: key.CreateTime.Format("2006-01-02 15:04:05"),
-	}
-
-	c.JSON(http.StatusOK, models.SuccessResponse(resp, ""))
+	c.JSON(http.StatusOK, models.SuccessResponse(toKeyResponse(&key), ""))
 }
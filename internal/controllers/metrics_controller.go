@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/adiecho/oci-panel/internal/config"
+	"github.com/adiecho/oci-panel/internal/metrics"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	token string
+}
+
+func NewMetricsController(cfg *config.Config) *MetricsController {
+	return &MetricsController{
+		token: cfg.Metrics.Token,
+	}
+}
+
+// Scrape 以 Prometheus 文本格式输出指标，使用独立的抓取令牌鉴权，未配置令牌时不开放
+func (mc *MetricsController) Scrape(c *gin.Context) {
+	if mc.token == "" {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Metrics disabled"))
+		return
+	}
+
+	token := c.Query("token")
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(mc.token)) != 1 {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(401, "Unauthorized"))
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	_ = metrics.Write(c.Writer)
+}
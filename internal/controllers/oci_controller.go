@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,21 +16,32 @@ import (
 	"github.com/adiecho/oci-panel/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/oracle/oci-go-sdk/v65/core"
 )
 
 type OciController struct {
 	ociService       *services.OCIService
 	schedulerService *services.SchedulerService
+	healthService    *services.HealthService
+	jobService       *services.JobService
 }
 
-func NewOciController(ociService *services.OCIService, schedulerService *services.SchedulerService) *OciController {
+func NewOciController(ociService *services.OCIService, schedulerService *services.SchedulerService, healthService *services.HealthService, jobService *services.JobService) *OciController {
 	return &OciController{
 		ociService:       ociService,
 		schedulerService: schedulerService,
+		healthService:    healthService,
+		jobService:       jobService,
 	}
 }
 
+// formatOptionalTime 格式化可为空的时间
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
 type UserPageRequest struct {
 	Page     int    `json:"page" binding:"required,min=1"`
 	PageSize int    `json:"pageSize" binding:"required,min=1,max=100"`
@@ -82,12 +95,19 @@ func (oc *OciController) UserPage(c *gin.Context) {
 				CreateTime:       user.CreateTime.Format("2006-01-02 15:04:05"),
 				InstanceCount:    0,
 				RunningInstances: 0,
+
+				DefaultCompartmentID: user.DefaultCompartmentID,
+				HealthStatus:         user.HealthStatus,
+				HealthCheckTime:      formatOptionalTime(user.HealthCheckTime),
+				LastOkTime:           formatOptionalTime(user.LastOkTime),
+				LastError:            user.LastError,
 			}
 
 			cache, err := oc.schedulerService.GetConfigCache(user.ID)
 			if err == nil {
 				responseList[i].InstanceCount = cache.InstanceCount
 				responseList[i].RunningInstances = cache.RunningInstances
+				responseList[i].Regions = cachedRegions(cache)
 			}
 		}
 	} else {
@@ -96,6 +116,7 @@ func (oc *OciController) UserPage(c *gin.Context) {
 			index            int
 			instanceCount    int
 			runningInstances int
+			regions          []models.RegionResourceCount
 		}
 		resultChan := make(chan instanceCountResult, len(users))
 
@@ -103,15 +124,11 @@ func (oc *OciController) UserPage(c *gin.Context) {
 		for i, user := range users {
 			go func(idx int, u models.OciUser) {
 				result := instanceCountResult{index: idx}
-				instances, err := oc.ociService.ListInstances(ctx, &u, u.OciTenantID)
+				inventory, err := oc.ociService.CollectInventory(ctx, &u, nil, services.InventoryOptions{Instances: true, Recursive: true})
 				if err == nil {
-					result.instanceCount = len(instances)
-					for _, inst := range instances {
-						if inst.LifecycleState == core.InstanceLifecycleStateRunning {
-							result.runningInstances++
-						}
-					}
+					result.instanceCount, result.runningInstances = inventory.Totals()
 				}
+				result.regions = inventory.Regions
 				resultChan <- result
 			}(i, user)
 		}
@@ -131,6 +148,12 @@ func (oc *OciController) UserPage(c *gin.Context) {
 				CreateTime:       user.CreateTime.Format("2006-01-02 15:04:05"),
 				InstanceCount:    0,
 				RunningInstances: 0,
+
+				DefaultCompartmentID: user.DefaultCompartmentID,
+				HealthStatus:         user.HealthStatus,
+				HealthCheckTime:      formatOptionalTime(user.HealthCheckTime),
+				LastOkTime:           formatOptionalTime(user.LastOkTime),
+				LastError:            user.LastError,
 			}
 		}
 
@@ -138,6 +161,7 @@ func (oc *OciController) UserPage(c *gin.Context) {
 			result := <-resultChan
 			responseList[result.index].InstanceCount = result.instanceCount
 			responseList[result.index].RunningInstances = result.runningInstances
+			responseList[result.index].Regions = result.regions
 		}
 	}
 
@@ -166,6 +190,7 @@ func (oc *OciController) AddCfg(c *gin.Context) {
 		return
 	}
 
+	now := time.Now()
 	user := models.OciUser{
 		ID:             uuid.New().String(),
 		Username:       req.Username,
@@ -175,22 +200,27 @@ func (oc *OciController) AddCfg(c *gin.Context) {
 		OciFingerprint: req.OciFingerprint,
 		OciRegion:      req.OciRegion,
 		OciKeyPath:     req.OciKeyPath,
-		CreateTime:     time.Now(),
+		CreateTime:     now,
 	}
 
-	// 获取真正的租户名称和创建时间
+	// 校验私钥与指纹一致、用户和租户存在，同时获取真正的租户名称和创建时间
 	ctx := context.Background()
-	tenantInfo, err := oc.ociService.GetTenantInfo(ctx, &user)
-	if err == nil && tenantInfo != nil {
-		if tenantInfo.Name != "" {
-			user.TenantName = tenantInfo.Name
-		}
-		if tenantInfo.CreateTime != "" {
-			if parsedTime, err := time.Parse("2006-01-02 15:04:05", tenantInfo.CreateTime); err == nil {
-				user.TenantCreateTime = &parsedTime
-			}
+	tenantInfo, err := oc.ociService.CheckCredentials(ctx, &user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "配置校验失败: "+err.Error()))
+		return
+	}
+	if tenantInfo.Name != "" {
+		user.TenantName = tenantInfo.Name
+	}
+	if tenantInfo.CreateTime != "" {
+		if parsedTime, err := time.Parse("2006-01-02 15:04:05", tenantInfo.CreateTime); err == nil {
+			user.TenantCreateTime = &parsedTime
 		}
 	}
+	user.HealthStatus = services.HealthStatusOK
+	user.HealthCheckTime = &now
+	user.LastOkTime = &now
 
 	if err := database.GetDB().Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "Failed to create user"))
@@ -200,6 +230,171 @@ func (oc *OciController) AddCfg(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Configuration added successfully"))
 }
 
+// maxImportSize 导入配置文件和私钥的大小上限
+const maxImportSize = 1 << 20
+
+type ImportCfgRequest struct {
+	Content  string            `json:"content" binding:"required"` // OCI CLI 配置文件内容
+	Keys     map[string]string `json:"keys"`                       // key_file 路径、文件名或 profile 名称 -> 私钥内容
+	Profiles []string          `json:"profiles"`                   // 为空时导入全部 profile
+}
+
+// ImportCfg 从 OCI CLI 配置文件批量导入配置
+// 支持 JSON 提交内联私钥，或 multipart 上传 config 文件和多个 keys 私钥文件
+func (oc *OciController) ImportCfg(c *gin.Context) {
+	var req ImportCfgRequest
+	if c.ContentType() == "multipart/form-data" {
+		if err := bindImportForm(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	results, err := oc.ociService.ImportOCIConfig(context.Background(), req.Content, req.Keys, req.Profiles)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	imported := 0
+	for _, r := range results {
+		if r.Success {
+			imported++
+		}
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"results":  results,
+		"imported": imported,
+		"failed":   len(results) - imported,
+	}, fmt.Sprintf("成功导入 %d 个配置", imported)))
+}
+
+// bindImportForm 读取 multipart 表单：config 文件或 content 字段，keys 为私钥文件
+func bindImportForm(c *gin.Context, req *ImportCfgRequest) error {
+	req.Content = c.PostForm("content")
+	if file, err := c.FormFile("config"); err == nil {
+		data, err := readFormFile(file)
+		if err != nil {
+			return err
+		}
+		req.Content = string(data)
+	}
+	if req.Content == "" {
+		return fmt.Errorf("缺少配置文件")
+	}
+	req.Profiles = c.PostFormArray("profiles")
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return err
+	}
+	req.Keys = make(map[string]string)
+	for _, file := range form.File["keys"] {
+		data, err := readFormFile(file)
+		if err != nil {
+			return err
+		}
+		req.Keys[filepath.Base(file.Filename)] = string(data)
+	}
+	return nil
+}
+
+func readFormFile(file *multipart.FileHeader) ([]byte, error) {
+	if file.Size > maxImportSize {
+		return nil, fmt.Errorf("文件 %s 过大", file.Filename)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, maxImportSize))
+}
+
+type ExportCfgRequest struct {
+	IDs         []string `json:"ids"` // 为空时导出全部配置
+	IncludeKeys bool     `json:"includeKeys"`
+}
+
+// ExportCfg 将配置导出为 OCI CLI 配置文件（zip，可选附带私钥）
+func (oc *OciController) ExportCfg(c *gin.Context) {
+	var req ExportCfgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	var users []models.OciUser
+	query := database.GetDB().Model(&models.OciUser{})
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	}
+	if err := query.Find(&users).Error; err != nil || len(users) == 0 {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	data, err := services.ExportOCIConfig(users, req.IncludeKeys)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	filename := "oci-config-" + time.Now().Format("20060102150405") + ".zip"
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/zip", data)
+}
+
+type HealthCheckRequest struct {
+	ConfigID string `json:"configId"` // 为空时检查全部配置
+}
+
+// HealthCheck 立即检查配置凭据
+func (oc *OciController) HealthCheck(c *gin.Context) {
+	var req HealthCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	if req.ConfigID == "" {
+		c.JSON(http.StatusOK, models.SuccessResponse(oc.healthService.CheckAll(), "Success"))
+		return
+	}
+
+	result, err := oc.healthService.CheckConfig(req.ConfigID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(result, "Success"))
+}
+
+type RotateApiKeyRequest struct {
+	ConfigID     string `json:"configId" binding:"required"`
+	DeleteOldKey bool   `json:"deleteOldKey"`
+}
+
+// RotateApiKey 轮换配置的 OCI API 密钥
+func (oc *OciController) RotateApiKey(c *gin.Context) {
+	var req RotateApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	result, err := oc.ociService.RotateApiKey(context.Background(), req.ConfigID, req.DeleteOldKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(result, "API密钥已轮换"))
+}
+
 type UpdateCfgNameRequest struct {
 	ID         string `json:"id" binding:"required"`
 	Username   string `json:"username" binding:"required"`
@@ -257,19 +452,32 @@ func (oc *OciController) RemoveCfg(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "Failed to delete"))
 		return
 	}
+	database.GetDB().Where("config_id IN ?", req.IDs).Delete(&models.OciSecurityReport{})
+	database.GetDB().Where("config_id IN ?", req.IDs).Delete(&models.OciBudget{})
+	database.GetDB().Where("config_id IN ?", req.IDs).Delete(&models.OciTrafficQuota{})
+	database.GetDB().Where("config_id IN ?", req.IDs).Delete(&models.OciTrafficQuotaLog{})
+	database.GetDB().Where("config_id IN ?", req.IDs).Delete(&models.OciTrafficSample{})
+	database.GetDB().Where("config_id IN ?", req.IDs).Delete(&models.OciIdleAssessment{})
 
 	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Deleted successfully"))
 }
 
 type CreateInstanceRequest struct {
-	UserID          string  `json:"userId" binding:"required"`
-	OciRegion       string  `json:"ociRegion" binding:"required"`
-	Ocpus           float64 `json:"ocpus"`
-	Memory          float64 `json:"memory"`
-	Disk            int     `json:"disk"`
-	Architecture    string  `json:"architecture"`
-	OperationSystem string  `json:"operationSystem"`
-	SSHKeyID        string  `json:"sshKeyId" binding:"required"`
+	UserID          string   `json:"userId" binding:"required"`
+	OciRegion       string   `json:"ociRegion" binding:"required"`
+	CompartmentID   string   `json:"compartmentId"`
+	Ocpus           float64  `json:"ocpus"`
+	Memory          float64  `json:"memory"`
+	Disk            int      `json:"disk"`
+	Architecture    string   `json:"architecture"`
+	Shape           string   `json:"shape"`
+	OperationSystem string   `json:"operationSystem"`
+	UserDataID      string   `json:"userDataId"`
+	EnableRootLogin bool     `json:"enableRootLogin"`
+	RootPassword    string   `json:"rootPassword"`
+	SSHPort         int      `json:"sshPort"`
+	SSHKeyID        string   `json:"sshKeyId"`
+	SSHKeyIDs       []string `json:"sshKeyIds"`
 }
 
 func (oc *OciController) CreateInstance(c *gin.Context) {
@@ -280,9 +488,23 @@ func (oc *OciController) CreateInstance(c *gin.Context) {
 	}
 
 	// 验证SSH密钥是否存在
-	var sshKey models.SSHKey
-	if err := database.GetDB().First(&sshKey, "id = ?", req.SSHKeyID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "SSH密钥不存在"))
+	sshKeyID, sshKeyIDs, err := normalizeSSHKeys(req.SSHKeyID, req.SSHKeyIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	if req.UserDataID != "" {
+		var tpl models.UserDataTemplate
+		if err := database.GetDB().First(&tpl, "id = ?", req.UserDataID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "用户数据模板不存在"))
+			return
+		}
+	}
+
+	rootPassword, err := resolveRootPassword(req.EnableRootLogin, req.RootPassword, req.SSHPort, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
 		return
 	}
 
@@ -290,12 +512,19 @@ func (oc *OciController) CreateInstance(c *gin.Context) {
 		ID:              uuid.New().String(),
 		UserID:          req.UserID,
 		OciRegion:       req.OciRegion,
+		CompartmentID:   req.CompartmentID,
 		Ocpus:           req.Ocpus,
 		Memory:          req.Memory,
 		Disk:            req.Disk,
 		Architecture:    req.Architecture,
+		Shape:           req.Shape,
 		OperationSystem: req.OperationSystem,
-		SSHKeyID:        req.SSHKeyID,
+		UserDataID:      req.UserDataID,
+		EnableRootLogin: req.EnableRootLogin,
+		RootPassword:    rootPassword,
+		SSHPort:         req.SSHPort,
+		SSHKeyID:        sshKeyID,
+		SSHKeyIDs:       sshKeyIDs,
 		CreateTime:      time.Now(),
 	}
 
@@ -410,14 +639,143 @@ func (oc *OciController) GetConfigDetails(c *gin.Context) {
 		Instances:   []models.InstanceInfo{},
 		Volumes:     []models.VolumeInfo{},
 		VCNs:        []models.VCNInfo{},
+
+		DefaultCompartmentID: user.DefaultCompartmentID,
+		Regions:              []models.RegionResourceCount{},
+		HealthStatus:         user.HealthStatus,
+		HealthCheckTime:      formatOptionalTime(user.HealthCheckTime),
+		LastOkTime:           formatOptionalTime(user.LastOkTime),
+		LastError:            user.LastError,
+	}
+
+	// 各区域资源统计，优先使用缓存
+	var regions []models.RegionResourceCount
+	if oc.schedulerService.IsCacheEnabled() {
+		if cache, err := oc.schedulerService.GetConfigCache(user.ID); err == nil {
+			regions = cachedRegions(cache)
+		}
+	}
+	if regions == nil {
+		inventory, _ := oc.ociService.CollectInventory(context.Background(), &user, nil, services.InventoryOptions{
+			Instances: true,
+			Volumes:   true,
+			VCNs:      true,
+			Recursive: true,
+		})
+		regions = inventory.Regions
+	}
+	details.Regions = regions
+
+	if cache, err := oc.schedulerService.GetConfigCache(user.ID); err == nil {
+		details.Cost = services.CachedCost(cache)
 	}
 
 	c.JSON(http.StatusOK, models.SuccessResponse(details, "Success"))
 }
 
+// GetCostRequest 费用查询请求
+type GetCostRequest struct {
+	ConfigID string `json:"configId" binding:"required"`
+	Refresh  bool   `json:"refresh"` // 忽略缓存立即查询
+}
+
+// GetCostUsage 获取配置的本月费用汇总，默认使用缓存，没有缓存时实时查询
+func (oc *OciController) GetCostUsage(c *gin.Context) {
+	var req GetCostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	if !req.Refresh {
+		if cache, err := oc.schedulerService.GetConfigCache(req.ConfigID); err == nil {
+			if cost := services.CachedCost(cache); cost != nil {
+				c.JSON(http.StatusOK, models.SuccessResponse(cost, "Success (cached)"))
+				return
+			}
+		}
+	}
+
+	cost, err := oc.schedulerService.RefreshCostCache(req.ConfigID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(cost, "Success"))
+}
+
 type GetResourceRequest struct {
 	ConfigID   string `json:"configId" binding:"required"`
 	ClearCache bool   `json:"clearCache"`
+	Region     string `json:"region"` // 为空时汇总所有订阅区域
+	// CompartmentID 为空时查询默认区间及其所有子区间
+	CompartmentID string `json:"compartmentId"`
+	Recursive     bool   `json:"recursive"` // 指定区间时是否包含子区间
+}
+
+// inventoryOptions 根据请求的区间范围构造查询选项
+func (r GetResourceRequest) inventoryOptions(opts services.InventoryOptions) services.InventoryOptions {
+	opts.CompartmentID = r.CompartmentID
+	opts.Recursive = r.CompartmentID == "" || r.Recursive
+	return opts
+}
+
+// compartmentFilter 返回缓存数据的区间过滤函数，未指定区间时不过滤
+func (oc *OciController) compartmentFilter(req GetResourceRequest) (func(string) bool, error) {
+	if req.CompartmentID == "" {
+		return func(string) bool { return true }, nil
+	}
+
+	var user models.OciUser
+	if err := database.GetDB().Where("id = ?", req.ConfigID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	compartments, err := oc.ociService.ResolveCompartments(context.Background(), &user, req.CompartmentID, req.Recursive)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]bool, len(compartments))
+	for _, id := range compartments {
+		allowed[id] = true
+	}
+	return func(id string) bool { return allowed[id] }, nil
+}
+
+// regions 返回实时查询的区域范围，nil 表示全部订阅区域
+func (r GetResourceRequest) regions() []string {
+	if r.Region == "" {
+		return nil
+	}
+	return []string{r.Region}
+}
+
+// cachedRegions 解析缓存中的区域统计，旧缓存没有区域数据时返回 nil
+func cachedRegions(cache *models.OciConfigCache) []models.RegionResourceCount {
+	if cache.RegionsData == "" {
+		return nil
+	}
+	var regions []models.RegionResourceCount
+	if json.Unmarshal([]byte(cache.RegionsData), &regions) != nil {
+		return nil
+	}
+	return regions
+}
+
+// filterResources 按区域和区间过滤缓存的资源列表，scope 返回资源所在的区域和区间
+func filterResources[T any](items []T, region string, inCompartment func(string) bool, scope func(T) (string, string)) []T {
+	filtered := make([]T, 0, len(items))
+	for _, item := range items {
+		itemRegion, compartmentID := scope(item)
+		if region != "" && itemRegion != region {
+			continue
+		}
+		if !inCompartment(compartmentID) {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
 }
 
 // GetConfigInstances 获取配置的实例列表
@@ -436,9 +794,14 @@ func (oc *OciController) GetConfigInstances(c *gin.Context) {
 	// 尝试从数据库缓存获取
 	if oc.schedulerService.IsCacheEnabled() {
 		cache, err := oc.schedulerService.GetConfigCache(req.ConfigID)
-		if err == nil && cache.InstancesData != "" {
+		inCompartment, filterErr := oc.compartmentFilter(req)
+		if err == nil && filterErr == nil && cache.InstancesData != "" {
 			var instances []models.InstanceInfo
 			if json.Unmarshal([]byte(cache.InstancesData), &instances) == nil {
+				instances = filterResources(instances, req.Region, inCompartment, func(i models.InstanceInfo) (string, string) {
+					return i.Region, i.CompartmentID
+				})
+				services.ApplyInstanceCredentials(instances)
 				c.JSON(http.StatusOK, models.SuccessResponse(instances, "Success (cached)"))
 				return
 			}
@@ -454,20 +817,16 @@ func (oc *OciController) GetConfigInstances(c *gin.Context) {
 	}
 
 	ctx := context.Background()
-	compartmentId := user.OciTenantID
-
-	instances := []models.InstanceInfo{}
-	instanceList, err := oc.ociService.ListInstances(ctx, &user, compartmentId)
-	if err == nil {
-		for _, inst := range instanceList {
-			if inst.Id != nil {
-				instanceDetail, err := oc.ociService.GetInstanceDetails(ctx, &user, *inst.Id)
-				if err == nil {
-					instances = append(instances, *instanceDetail)
-				}
-			}
-		}
+	inventory, err := oc.ociService.CollectInventory(ctx, &user, req.regions(), req.inventoryOptions(services.InventoryOptions{
+		Instances: true,
+		Details:   true,
+	}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
 	}
+	instances := inventory.Instances
+	services.ApplyInstanceCredentials(instances)
 
 	c.JSON(http.StatusOK, models.SuccessResponse(instances, "Success"))
 }
@@ -487,9 +846,13 @@ func (oc *OciController) GetConfigVolumes(c *gin.Context) {
 	// 尝试从数据库缓存获取
 	if oc.schedulerService.IsCacheEnabled() {
 		cache, err := oc.schedulerService.GetConfigCache(req.ConfigID)
-		if err == nil && cache.VolumesData != "" {
+		inCompartment, filterErr := oc.compartmentFilter(req)
+		if err == nil && filterErr == nil && cache.VolumesData != "" {
 			var volumes []models.VolumeInfo
 			if json.Unmarshal([]byte(cache.VolumesData), &volumes) == nil {
+				volumes = filterResources(volumes, req.Region, inCompartment, func(v models.VolumeInfo) (string, string) {
+					return v.Region, v.CompartmentID
+				})
 				c.JSON(http.StatusOK, models.SuccessResponse(volumes, "Success (cached)"))
 				return
 			}
@@ -505,15 +868,16 @@ func (oc *OciController) GetConfigVolumes(c *gin.Context) {
 	}
 
 	ctx := context.Background()
-	compartmentId := user.OciTenantID
-
-	volumes, err := oc.ociService.ListBootVolumes(ctx, &user, compartmentId)
+	inventory, err := oc.ociService.CollectInventory(ctx, &user, req.regions(), req.inventoryOptions(services.InventoryOptions{
+		Volumes: true,
+		Details: true,
+	}))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, models.SuccessResponse(volumes, "Success"))
+	c.JSON(http.StatusOK, models.SuccessResponse(inventory.Volumes, "Success"))
 }
 
 // GetConfigVCNs 获取配置的VCN列表
@@ -531,9 +895,13 @@ func (oc *OciController) GetConfigVCNs(c *gin.Context) {
 	// 尝试从数据库缓存获取
 	if oc.schedulerService.IsCacheEnabled() {
 		cache, err := oc.schedulerService.GetConfigCache(req.ConfigID)
-		if err == nil && cache.VcnsData != "" {
+		inCompartment, filterErr := oc.compartmentFilter(req)
+		if err == nil && filterErr == nil && cache.VcnsData != "" {
 			var vcns []models.VCNInfo
 			if json.Unmarshal([]byte(cache.VcnsData), &vcns) == nil {
+				vcns = filterResources(vcns, req.Region, inCompartment, func(v models.VCNInfo) (string, string) {
+					return v.Region, v.CompartmentID
+				})
 				c.JSON(http.StatusOK, models.SuccessResponse(vcns, "Success (cached)"))
 				return
 			}
@@ -549,15 +917,16 @@ func (oc *OciController) GetConfigVCNs(c *gin.Context) {
 	}
 
 	ctx := context.Background()
-	compartmentId := user.OciTenantID
-
-	vcns, err := oc.ociService.ListVCNs(ctx, &user, compartmentId)
+	inventory, err := oc.ociService.CollectInventory(ctx, &user, req.regions(), req.inventoryOptions(services.InventoryOptions{
+		VCNs:    true,
+		Details: true,
+	}))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, models.SuccessResponse(vcns, "Success"))
+	c.JSON(http.StatusOK, models.SuccessResponse(inventory.VCNs, "Success"))
 }
 
 // ClearConfigCache 刷新配置的缓存
@@ -616,12 +985,159 @@ func (oc *OciController) GetTenantInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(tenantInfo, "Success"))
 }
 
+// ListCompartments 获取区间树
+func (oc *OciController) ListCompartments(c *gin.Context) {
+	var req GetConfigDetailsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.ConfigID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	tree, err := oc.ociService.ListCompartmentTree(context.Background(), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(tree, "Success"))
+}
+
+type SetDefaultCompartmentRequest struct {
+	ConfigID      string `json:"configId" binding:"required"`
+	CompartmentID string `json:"compartmentId"` // 为空时恢复为租户根区间
+}
+
+// SetDefaultCompartment 设置配置的默认区间
+func (oc *OciController) SetDefaultCompartment(c *gin.Context) {
+	var req SetDefaultCompartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.ConfigID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	compartmentID := req.CompartmentID
+	if compartmentID == user.OciTenantID {
+		compartmentID = ""
+	}
+	if compartmentID != "" {
+		compartments, err := oc.ociService.ResolveCompartments(context.Background(), &user, user.OciTenantID, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+			return
+		}
+		found := false
+		for _, id := range compartments {
+			if id == compartmentID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "区间不存在或无权访问"))
+			return
+		}
+	}
+
+	if err := db.Model(&user).Update("default_compartment_id", compartmentID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "Failed to update configuration"))
+		return
+	}
+
+	// 默认区间变化后缓存的资源范围随之变化
+	go oc.schedulerService.UpdateConfigCache(user.ID)
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "默认区间已更新"))
+}
+
+// ListRegions 列出所有区域及订阅状态
+func (oc *OciController) ListRegions(c *gin.Context) {
+	var req GetConfigDetailsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.ConfigID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	regions, err := oc.ociService.ListRegionSubscriptionStatus(context.Background(), &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	// 订阅中的区域（例如服务重启前发起的订阅）继续轮询
+	for _, region := range regions {
+		if region.Status == "IN_PROGRESS" {
+			oc.schedulerService.WatchRegionSubscription(user.ID, region.RegionName)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(regions, "Success"))
+}
+
+type SubscribeRegionRequest struct {
+	ConfigID string `json:"configId" binding:"required"`
+	Region   string `json:"region" binding:"required"`
+}
+
+// SubscribeRegion 订阅新区域，就绪后自动刷新配置缓存
+func (oc *OciController) SubscribeRegion(c *gin.Context) {
+	var req SubscribeRegionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.ConfigID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	region, err := oc.ociService.SubscribeRegion(context.Background(), &user, req.Region)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	if region.Status == "READY" {
+		go oc.schedulerService.UpdateConfigCache(user.ID)
+		c.JSON(http.StatusOK, models.SuccessResponse(region, "区域已订阅"))
+		return
+	}
+
+	oc.schedulerService.WatchRegionSubscription(user.ID, region.RegionName)
+	c.JSON(http.StatusOK, models.SuccessResponse(region, "区域订阅已提交，就绪后将自动刷新缓存"))
+}
+
 type GetTrafficDataRequest struct {
 	ConfigID   string `json:"configId" binding:"required"`
 	InstanceID string `json:"instanceId" binding:"required"`
 	VnicID     string `json:"vnicId" binding:"required"`
 	StartTime  string `json:"startTime" binding:"required"`
 	EndTime    string `json:"endTime" binding:"required"`
+	// CompartmentID 为空时从租户根区间递归查询
+	CompartmentID string `json:"compartmentId"`
 }
 
 // GetTrafficData 获取流量统计数据
@@ -640,7 +1156,7 @@ func (oc *OciController) GetTrafficData(c *gin.Context) {
 	}
 
 	ctx := context.Background()
-	trafficData, err := oc.ociService.GetTrafficData(ctx, &user, req.VnicID, req.StartTime, req.EndTime)
+	trafficData, err := oc.ociService.GetTrafficData(ctx, &user, req.CompartmentID, req.VnicID, req.StartTime, req.EndTime)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
@@ -681,10 +1197,17 @@ func (oc *OciController) GetTrafficCondition(c *gin.Context) {
 		}
 	}
 
-	// 获取当前区域的实例
-	compartmentId := user.OciTenantID
-	instances, err := oc.ociService.ListInstances(ctx, &user, compartmentId)
-	if err == nil {
+	// 获取当前区域的实例，未指定区间时包含默认区间的所有子区间
+	compartmentId := c.Query("compartmentId")
+	compartments, err := oc.ociService.ResolveCompartments(ctx, &user, compartmentId, compartmentId == "" || c.Query("recursive") == "true")
+	if err != nil {
+		compartments = []string{user.ResourceCompartmentID()}
+	}
+	for _, cid := range compartments {
+		instances, err := oc.ociService.ListInstances(ctx, &user, cid)
+		if err != nil {
+			continue
+		}
 		for _, inst := range instances {
 			if inst.Id != nil && inst.DisplayName != nil {
 				condition.Instances = append(condition.Instances, models.ValueLabel{
@@ -875,6 +1398,264 @@ func (oc *OciController) DeleteApiKey(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(nil, "API密钥清除成功"))
 }
 
+// CreateIAMUserRequest 创建 IAM 用户请求
+type CreateIAMUserRequest struct {
+	OciCfgID    string   `json:"ociCfgId" binding:"required"`
+	Mode        string   `json:"mode"` // classic（默认）/ domain
+	Name        string   `json:"name" binding:"required"`
+	Email       string   `json:"email"`
+	Description string   `json:"description"`
+	GroupIDs    []string `json:"groupIds"`
+}
+
+// IAMGroupRequest 组列表和创建组请求
+type IAMGroupRequest struct {
+	OciCfgID    string `json:"ociCfgId" binding:"required"`
+	Mode        string `json:"mode"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AddUserToGroupRequest 用户加组请求
+type AddUserToGroupRequest struct {
+	OciCfgID string `json:"ociCfgId" binding:"required"`
+	Mode     string `json:"mode"`
+	UserID   string `json:"userId" binding:"required"`
+	GroupID  string `json:"groupId" binding:"required"`
+}
+
+// PolicyRequest 策略列表、创建、更新和预览请求
+// statements 为原始语句，rules 为编辑器中的结构化语句，两者合并后提交
+type PolicyRequest struct {
+	OciCfgID      string                     `json:"ociCfgId" binding:"required"`
+	CompartmentID string                     `json:"compartmentId"`
+	PolicyID      string                     `json:"policyId"`
+	Name          string                     `json:"name"`
+	Description   string                     `json:"description"`
+	Statements    []string                   `json:"statements"`
+	Rules         []services.PolicyStatement `json:"rules"`
+}
+
+// CreateIAMUser 创建 IAM 用户，可同时加入组
+func (oc *OciController) CreateIAMUser(c *gin.Context) {
+	var req CreateIAMUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.OciCfgID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	ctx := context.Background()
+	created, err := oc.ociService.CreateIAMUser(ctx, &user, services.CreateIAMUserParams{
+		Mode:        req.Mode,
+		Name:        req.Name,
+		Email:       req.Email,
+		Description: req.Description,
+		GroupIDs:    req.GroupIDs,
+	})
+	if created != nil {
+		go oc.schedulerService.UpdateConfigCache(req.OciCfgID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(created, "用户创建成功"))
+}
+
+// ListIAMGroups 获取组列表
+func (oc *OciController) ListIAMGroups(c *gin.Context) {
+	var req IAMGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.OciCfgID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	groups, err := oc.ociService.ListIAMGroups(context.Background(), &user, req.Mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(groups, "Success"))
+}
+
+// CreateIAMGroup 创建组
+func (oc *OciController) CreateIAMGroup(c *gin.Context) {
+	var req IAMGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "组名不能为空"))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.OciCfgID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	group, err := oc.ociService.CreateIAMGroup(context.Background(), &user, services.CreateIAMGroupParams{
+		Mode:        req.Mode,
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(group, "组创建成功"))
+}
+
+// AddUserToGroup 将用户加入组
+func (oc *OciController) AddUserToGroup(c *gin.Context) {
+	var req AddUserToGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.OciCfgID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	if err := oc.ociService.AddUserToGroup(context.Background(), &user, req.Mode, req.UserID, req.GroupID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "已加入组"))
+}
+
+// ListPolicies 获取区间下的策略列表
+func (oc *OciController) ListPolicies(c *gin.Context) {
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.OciCfgID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	policies, err := oc.ociService.ListPolicies(context.Background(), &user, req.CompartmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(policies, "Success"))
+}
+
+// PreviewPolicy 预览编辑器生成的策略语句，不提交到 OCI
+func (oc *OciController) PreviewPolicy(c *gin.Context) {
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	statements, err := services.BuildPolicyStatements(req.Statements, req.Rules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(statements, "Success"))
+}
+
+// CreatePolicy 创建策略
+func (oc *OciController) CreatePolicy(c *gin.Context) {
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "策略名称不能为空"))
+		return
+	}
+	statements, err := services.BuildPolicyStatements(req.Statements, req.Rules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.OciCfgID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	policy, err := oc.ociService.CreatePolicy(context.Background(), &user, req.CompartmentID, req.Name, req.Description, statements)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(policy, "策略创建成功"))
+}
+
+// UpdatePolicy 替换策略语句
+func (oc *OciController) UpdatePolicy(c *gin.Context) {
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	if req.PolicyID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "policyId不能为空"))
+		return
+	}
+	statements, err := services.BuildPolicyStatements(req.Statements, req.Rules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.OciCfgID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	policy, err := oc.ociService.UpdatePolicy(context.Background(), &user, req.PolicyID, req.Description, statements)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(policy, "策略更新成功"))
+}
+
 // GetInstanceVnics 获取实例的VNIC列表
 func (oc *OciController) GetInstanceVnics(c *gin.Context) {
 	configId := c.Query("configId")
@@ -1013,7 +1794,7 @@ func (oc *OciController) ReleaseSecurityRules(c *gin.Context) {
 		return
 	}
 
-	if err := oc.ociService.ReleaseSecurityRules(&user, req.VcnID); err != nil {
+	if err := oc.ociService.ReleaseSecurityRules(c.Request.Context(), &user, req.VcnID); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
@@ -1042,13 +1823,13 @@ func (oc *OciController) DeleteVcn(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	if err := oc.ociService.DeleteVcn(ctx, &user, req.VcnID); err != nil {
+	job, err := oc.jobService.Submit(c.Request.Context(), services.JobKindDeleteVcn, user.ID, req.VcnID, nil)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, models.SuccessResponse(nil, "VCN删除成功"))
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"jobId": job.ID}, "VCN删除任务已提交"))
 }
 
 // ListImagesRequest 获取镜像列表请求
@@ -1056,6 +1837,7 @@ type ListImagesRequest struct {
 	ConfigID     string `json:"configId" binding:"required"`
 	Region       string `json:"region" binding:"required"`
 	Architecture string `json:"architecture" binding:"required"`
+	Shape        string `json:"shape"`
 	ClearCache   bool   `json:"clearCache"`
 }
 
@@ -1075,11 +1857,14 @@ func (oc *OciController) ListImages(c *gin.Context) {
 	}
 
 	cacheKey := req.Region + "_" + req.Architecture
+	if req.Shape != "" {
+		cacheKey += "_" + req.Shape
+	}
 
 	// 尝试从缓存获取
 	if !req.ClearCache {
 		var cache models.OciImageCache
-		if err := db.Where("region = ? AND architecture = ?", req.Region, req.Architecture).First(&cache).Error; err == nil {
+		if err := db.Where("region = ? AND architecture = ? AND shape = ?", req.Region, req.Architecture, req.Shape).First(&cache).Error; err == nil {
 			if cache.ImagesData != "" {
 				var images []services.ImageInfo
 				if json.Unmarshal([]byte(cache.ImagesData), &images) == nil {
@@ -1091,7 +1876,7 @@ func (oc *OciController) ListImages(c *gin.Context) {
 	}
 
 	ctx := context.Background()
-	images, err := oc.ociService.ListImages(ctx, &user, req.Region, req.Architecture)
+	images, err := oc.ociService.ListImages(ctx, &user, req.Region, req.Architecture, req.Shape)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
 		return
@@ -1100,12 +1885,13 @@ func (oc *OciController) ListImages(c *gin.Context) {
 	// 保存到缓存
 	imagesJson, _ := json.Marshal(images)
 	var cache models.OciImageCache
-	result := db.Where("region = ? AND architecture = ?", req.Region, req.Architecture).First(&cache)
+	result := db.Where("region = ? AND architecture = ? AND shape = ?", req.Region, req.Architecture, req.Shape).First(&cache)
 	if result.Error != nil {
 		cache = models.OciImageCache{
 			ID:           cacheKey,
 			Region:       req.Region,
 			Architecture: req.Architecture,
+			Shape:        req.Shape,
 		}
 	}
 	cache.ImagesData = string(imagesJson)
@@ -1114,3 +1900,35 @@ func (oc *OciController) ListImages(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.SuccessResponse(images, "获取镜像列表成功"))
 }
+
+// ListShapesRequest 获取实例规格列表请求
+type ListShapesRequest struct {
+	ConfigID           string `json:"configId" binding:"required"`
+	Region             string `json:"region"`
+	AvailabilityDomain string `json:"availabilityDomain"`
+}
+
+// ListShapes 获取区域/可用域内可用的实例规格及 OCPU/内存范围
+func (oc *OciController) ListShapes(c *gin.Context) {
+	var req ListShapesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", req.ConfigID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+		return
+	}
+
+	ctx := context.Background()
+	shapes, err := oc.ociService.ListShapes(ctx, &user, req.Region, req.AvailabilityDomain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(shapes, "获取规格列表成功"))
+}
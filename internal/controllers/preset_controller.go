@@ -1,11 +1,13 @@
 package controllers
 
 import (
+	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/adiecho/oci-panel/internal/database"
 	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -17,16 +19,22 @@ func NewPresetController() *PresetController {
 }
 
 type CreatePresetRequest struct {
-	Name            string  `json:"name" binding:"required"`
-	Ocpus           float64 `json:"ocpus"`
-	Memory          float64 `json:"memory"`
-	Disk            int     `json:"disk"`
-	BootVolumeVpu   int64   `json:"bootVolumeVpu"`
-	Architecture    string  `json:"architecture"`
-	OperationSystem string  `json:"operationSystem"`
-	ImageID         string  `json:"imageId"`
-	SSHKeyID        string  `json:"sshKeyId"`
-	Description     string  `json:"description"`
+	Name            string   `json:"name" binding:"required"`
+	Ocpus           float64  `json:"ocpus"`
+	Memory          float64  `json:"memory"`
+	Disk            int      `json:"disk"`
+	BootVolumeVpu   int64    `json:"bootVolumeVpu"`
+	Architecture    string   `json:"architecture"`
+	Shape           string   `json:"shape"`
+	OperationSystem string   `json:"operationSystem"`
+	ImageID         string   `json:"imageId"`
+	SSHKeyID        string   `json:"sshKeyId"`
+	SSHKeyIDs       []string `json:"sshKeyIds"`
+	UserDataID      string   `json:"userDataId"`
+	EnableRootLogin bool     `json:"enableRootLogin"`
+	RootPassword    string   `json:"rootPassword"`
+	SSHPort         int      `json:"sshPort"`
+	Description     string   `json:"description"`
 }
 
 func (pc *PresetController) CreatePreset(c *gin.Context) {
@@ -55,6 +63,17 @@ func (pc *PresetController) CreatePreset(c *gin.Context) {
 		req.OperationSystem = "Ubuntu"
 	}
 
+	rootPassword, err := resolveRootPassword(req.EnableRootLogin, req.RootPassword, req.SSHPort, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	req.SSHKeyID, req.SSHKeyIDs, err = normalizePresetSSHKeys(req.SSHKeyID, req.SSHKeyIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
 	preset := &models.InstancePreset{
 		ID:              uuid.New().String(),
 		Name:            req.Name,
@@ -63,9 +82,15 @@ func (pc *PresetController) CreatePreset(c *gin.Context) {
 		Disk:            req.Disk,
 		BootVolumeVpu:   req.BootVolumeVpu,
 		Architecture:    req.Architecture,
+		Shape:           req.Shape,
 		OperationSystem: req.OperationSystem,
 		ImageID:         req.ImageID,
 		SSHKeyID:        req.SSHKeyID,
+		SSHKeyIDs:       req.SSHKeyIDs,
+		UserDataID:      req.UserDataID,
+		EnableRootLogin: req.EnableRootLogin,
+		RootPassword:    rootPassword,
+		SSHPort:         req.SSHPort,
 		Description:     req.Description,
 		CreateTime:      time.Now(),
 	}
@@ -79,17 +104,23 @@ func (pc *PresetController) CreatePreset(c *gin.Context) {
 }
 
 type UpdatePresetRequest struct {
-	ID              string  `json:"id" binding:"required"`
-	Name            string  `json:"name" binding:"required"`
-	Ocpus           float64 `json:"ocpus"`
-	Memory          float64 `json:"memory"`
-	Disk            int     `json:"disk"`
-	BootVolumeVpu   int64   `json:"bootVolumeVpu"`
-	Architecture    string  `json:"architecture"`
-	OperationSystem string  `json:"operationSystem"`
-	ImageID         string  `json:"imageId"`
-	SSHKeyID        string  `json:"sshKeyId"`
-	Description     string  `json:"description"`
+	ID              string   `json:"id" binding:"required"`
+	Name            string   `json:"name" binding:"required"`
+	Ocpus           float64  `json:"ocpus"`
+	Memory          float64  `json:"memory"`
+	Disk            int      `json:"disk"`
+	BootVolumeVpu   int64    `json:"bootVolumeVpu"`
+	Architecture    string   `json:"architecture"`
+	Shape           string   `json:"shape"`
+	OperationSystem string   `json:"operationSystem"`
+	ImageID         string   `json:"imageId"`
+	SSHKeyID        string   `json:"sshKeyId"`
+	SSHKeyIDs       []string `json:"sshKeyIds"`
+	UserDataID      string   `json:"userDataId"`
+	EnableRootLogin bool     `json:"enableRootLogin"`
+	RootPassword    string   `json:"rootPassword"`
+	SSHPort         int      `json:"sshPort"`
+	Description     string   `json:"description"`
 }
 
 func (pc *PresetController) UpdatePreset(c *gin.Context) {
@@ -105,17 +136,49 @@ func (pc *PresetController) UpdatePreset(c *gin.Context) {
 		return
 	}
 
+	sshKeyID, sshKeyIDs, err := normalizePresetSSHKeys(req.SSHKeyID, req.SSHKeyIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	// map 更新不经过 serializer:json，需要手动序列化
+	sshKeyIDsJSON, _ := json.Marshal(sshKeyIDs)
+
 	updates := map[string]interface{}{
-		"name":             req.Name,
-		"ocpus":            req.Ocpus,
-		"memory":           req.Memory,
-		"disk":             req.Disk,
-		"boot_volume_vpu":  req.BootVolumeVpu,
-		"architecture":     req.Architecture,
-		"operation_system": req.OperationSystem,
-		"image_id":         req.ImageID,
-		"ssh_key_id":       req.SSHKeyID,
-		"description":      req.Description,
+		"name":              req.Name,
+		"ocpus":             req.Ocpus,
+		"memory":            req.Memory,
+		"disk":              req.Disk,
+		"boot_volume_vpu":   req.BootVolumeVpu,
+		"architecture":      req.Architecture,
+		"shape":             req.Shape,
+		"operation_system":  req.OperationSystem,
+		"image_id":          req.ImageID,
+		"ssh_key_id":        sshKeyID,
+		"ssh_key_ids":       string(sshKeyIDsJSON),
+		"user_data_id":      req.UserDataID,
+		"enable_root_login": req.EnableRootLogin,
+		"ssh_port":          req.SSHPort,
+		"description":       req.Description,
+	}
+
+	// 未填写新密码时保留原密码，关闭 root 登录时清除
+	if err := services.ValidateSSHPort(req.EnableRootLogin, req.SSHPort); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	if !req.EnableRootLogin {
+		updates["root_password"] = ""
+	} else if req.RootPassword != "" {
+		rootPassword, err := resolveRootPassword(true, req.RootPassword, req.SSHPort, "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+			return
+		}
+		updates["root_password"] = rootPassword
+	} else if err := services.ValidateRootLogin("", req.SSHPort); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
 	}
 
 	if err := database.GetDB().Model(&preset).Updates(updates).Error; err != nil {
@@ -126,6 +189,14 @@ func (pc *PresetController) UpdatePreset(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(nil, "更新成功"))
 }
 
+// normalizePresetSSHKeys 预设可以不指定 SSH 密钥，指定时与任务使用相同的校验
+func normalizePresetSSHKeys(primary string, extra []string) (string, []string, error) {
+	if primary == "" && len(extra) == 0 {
+		return "", []string{}, nil
+	}
+	return normalizeSSHKeys(primary, extra)
+}
+
 type DeletePresetRequest struct {
 	ID string `json:"id" binding:"required"`
 }
@@ -159,6 +230,13 @@ func (pc *PresetController) ListPresets(c *gin.Context) {
 		keyMap[key.ID] = key.Name
 	}
 
+	userDataMap := make(map[string]string)
+	var templates []models.UserDataTemplate
+	database.GetDB().Select("id", "name").Find(&templates)
+	for _, tpl := range templates {
+		userDataMap[tpl.ID] = tpl.Name
+	}
+
 	list := make([]models.InstancePresetResponse, len(presets))
 	for i, p := range presets {
 		list[i] = models.InstancePresetResponse{
@@ -169,10 +247,17 @@ func (pc *PresetController) ListPresets(c *gin.Context) {
 			Disk:            p.Disk,
 			BootVolumeVpu:   p.BootVolumeVpu,
 			Architecture:    p.Architecture,
+			Shape:           p.Shape,
 			OperationSystem: p.OperationSystem,
 			ImageID:         p.ImageID,
 			SSHKeyID:        p.SSHKeyID,
 			SSHKeyName:      keyMap[p.SSHKeyID],
+			SSHKeyIDs:       p.SSHKeyIDs,
+			UserDataID:      p.UserDataID,
+			UserDataName:    userDataMap[p.UserDataID],
+			EnableRootLogin: p.EnableRootLogin,
+			HasRootPassword: p.RootPassword != "",
+			SSHPort:         p.SSHPort,
 			Description:     p.Description,
 			CreateTime:      p.CreateTime.Format("2006-01-02 15:04:05"),
 		}
@@ -200,6 +285,12 @@ func (pc *PresetController) GetPreset(c *gin.Context) {
 		sshKeyName = key.Name
 	}
 
+	var userDataName string
+	var tpl models.UserDataTemplate
+	if preset.UserDataID != "" && database.GetDB().First(&tpl, "id = ?", preset.UserDataID).Error == nil {
+		userDataName = tpl.Name
+	}
+
 	resp := models.InstancePresetResponse{
 		ID:              preset.ID,
 		Name:            preset.Name,
@@ -208,10 +299,17 @@ func (pc *PresetController) GetPreset(c *gin.Context) {
 		Disk:            preset.Disk,
 		BootVolumeVpu:   preset.BootVolumeVpu,
 		Architecture:    preset.Architecture,
+		Shape:           preset.Shape,
 		OperationSystem: preset.OperationSystem,
 		ImageID:         preset.ImageID,
 		SSHKeyID:        preset.SSHKeyID,
 		SSHKeyName:      sshKeyName,
+		SSHKeyIDs:       preset.SSHKeyIDs,
+		UserDataID:      preset.UserDataID,
+		UserDataName:    userDataName,
+		EnableRootLogin: preset.EnableRootLogin,
+		HasRootPassword: preset.RootPassword != "",
+		SSHPort:         preset.SSHPort,
 		Description:     preset.Description,
 		CreateTime:      preset.CreateTime.Format("2006-01-02 15:04:05"),
 	}
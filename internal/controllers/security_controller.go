@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SecurityController struct {
+	securityService *services.SecurityReportService
+	jobService      *services.JobService
+}
+
+func NewSecurityController(securityService *services.SecurityReportService, jobService *services.JobService) *SecurityController {
+	return &SecurityController{
+		securityService: securityService,
+		jobService:      jobService,
+	}
+}
+
+// SecurityReportRequest 安全报告请求
+// configId 为空时返回全部配置；refresh 为 true 时重新扫描，否则返回定时任务保存的最近一次报告
+// configId 为空且 refresh 为 true 时提交后台任务并返回 jobId，完成后再不带 refresh 查询
+type SecurityReportRequest struct {
+	ConfigID         string `json:"configId"`
+	Refresh          bool   `json:"refresh"`
+	Format           string `json:"format"` // json（默认）/ markdown
+	ApiKeyMaxAgeDays int    `json:"apiKeyMaxAgeDays"`
+	InactiveDays     int    `json:"inactiveDays"`
+}
+
+// GetSecurityReport 获取租户安全报告
+func (sc *SecurityController) GetSecurityReport(c *gin.Context) {
+	var req SecurityReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+	if req.Format != "" && req.Format != "json" && req.Format != "markdown" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "format 只支持 json 或 markdown"))
+		return
+	}
+
+	opts := services.SecurityReportOptions{
+		ApiKeyMaxAgeDays: req.ApiKeyMaxAgeDays,
+		InactiveDays:     req.InactiveDays,
+	}
+
+	var reports []models.TenantSecurityReport
+	switch {
+	case req.Refresh && req.ConfigID != "":
+		report, err := sc.securityService.GenerateConfig(req.ConfigID, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+			return
+		}
+		reports = []models.TenantSecurityReport{*report}
+	case req.Refresh:
+		job, err := sc.jobService.Submit(c.Request.Context(), services.JobKindSecurityReport, "", "", services.SecurityReportJobParams{
+			ApiKeyMaxAgeDays: req.ApiKeyMaxAgeDays,
+			InactiveDays:     req.InactiveDays,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"jobId": job.ID}, "安全报告生成任务已提交"))
+		return
+	default:
+		var err error
+		reports, err = sc.securityService.Latest(req.ConfigID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+			return
+		}
+	}
+
+	if req.Format == "markdown" {
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(services.RenderSecurityReportMarkdown(reports)))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(reports, "Success"))
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/config"
+	"github.com/adiecho/oci-panel/internal/middleware"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type SSHController struct {
+	sshService *services.SSHTerminalService
+	upgrader   *websocket.Upgrader
+}
+
+func NewSSHController(cfg *config.Config, sshService *services.SSHTerminalService) *SSHController {
+	return &SSHController{
+		sshService: sshService,
+		upgrader:   newUpgrader(cfg),
+	}
+}
+
+// terminalInput Web 终端客户端消息，type 为 auth / input / resize；二进制帧直接作为终端输入
+type terminalInput struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	services.SSHTerminalParams
+}
+
+// terminalEvent Web 终端服务端事件，type 为 connected / hostKeyMismatch / error / closed；终端输出以二进制帧发送
+// hostKeyMismatch 时客户端确认 fingerprint 后，需在 auth 消息中带上 acceptHostKey 重新连接
+type terminalEvent struct {
+	Type        string `json:"type"`
+	Message     string `json:"message,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// wsConn 保证同一连接上的写操作串行执行
+type wsConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (w *wsConn) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *wsConn) send(msg terminalEvent) {
+	data, _ := json.Marshal(msg)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	w.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// HandleTerminal Web SSH 终端
+// 浏览器无法为 WebSocket 设置请求头，token 通过查询参数传递；连接后首条消息需为 auth
+func (sc *SSHController) HandleTerminal(c *gin.Context) {
+	claims, err := middleware.ParseToken(c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse(401, "Unauthorized"))
+		return
+	}
+
+	conn, err := sc.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to upgrade terminal connection", "error", err)
+		return
+	}
+	defer conn.Close()
+	ws := &wsConn{conn: conn}
+
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	var auth terminalInput
+	if err := conn.ReadJSON(&auth); err != nil || auth.Type != "auth" {
+		ws.send(terminalEvent{Type: "error", Message: "首条消息必须为认证信息"})
+		return
+	}
+
+	params := auth.SSHTerminalParams
+	params.Operator = claims.Username
+	params.ClientIP = c.ClientIP()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	session, err := sc.sshService.Open(ctx, params, ws)
+	cancel()
+	if err != nil {
+		var mismatch *services.HostKeyMismatchError
+		if errors.As(err, &mismatch) {
+			ws.send(terminalEvent{Type: "hostKeyMismatch", Message: err.Error(), Fingerprint: mismatch.Fingerprint})
+			return
+		}
+		ws.send(terminalEvent{Type: "error", Message: err.Error()})
+		return
+	}
+
+	var closeReason string
+	var reasonOnce sync.Once
+	closeWith := func(reason string) {
+		reasonOnce.Do(func() { closeReason = reason })
+		session.Close(closeReason)
+		conn.Close()
+	}
+	defer func() { closeWith("客户端断开") }()
+
+	ws.send(terminalEvent{Type: "connected", Message: session.Audit.Host})
+
+	maxTimer := time.AfterFunc(services.SSHMaxSessionDuration, func() {
+		ws.send(terminalEvent{Type: "closed", Message: "会话已达到最长时间"})
+		closeWith("会话超时")
+	})
+	defer maxTimer.Stop()
+
+	go func() {
+		session.Wait()
+		ws.send(terminalEvent{Type: "closed", Message: "远端会话已结束"})
+		closeWith("远端退出")
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(services.SSHIdleTimeout))
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				ws.send(terminalEvent{Type: "closed", Message: "长时间无操作，连接已断开"})
+				closeWith("空闲超时")
+			}
+			return
+		}
+
+		if msgType == websocket.BinaryMessage {
+			if err := session.Write(data); err != nil {
+				return
+			}
+			continue
+		}
+
+		var msg terminalInput
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "input":
+			if err := session.Write([]byte(msg.Data)); err != nil {
+				return
+			}
+		case "resize":
+			session.Resize(msg.Cols, msg.Rows)
+		}
+	}
+}
+
+type SSHSessionPageRequest struct {
+	Page       int    `json:"page" binding:"required,min=1"`
+	PageSize   int    `json:"pageSize" binding:"required,min=1,max=100"`
+	InstanceID string `json:"instanceId"`
+}
+
+// ListSessions 查询 Web 终端会话审计记录
+func (sc *SSHController) ListSessions(c *gin.Context) {
+	var req SSHSessionPageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	audits, total, err := sc.sshService.ListSessions(req.InstanceID, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "查询失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"list":  audits,
+		"total": total,
+		"page":  req.Page,
+	}, ""))
+}
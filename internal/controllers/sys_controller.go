@@ -18,12 +18,14 @@ import (
 type SysController struct {
 	cfg              *config.Config
 	schedulerService *services.SchedulerService
+	operations       *services.OperationRegistry
 }
 
-func NewSysController(cfg *config.Config, schedulerService *services.SchedulerService) *SysController {
+func NewSysController(cfg *config.Config, schedulerService *services.SchedulerService, operations *services.OperationRegistry) *SysController {
 	return &SysController{
 		cfg:              cfg,
 		schedulerService: schedulerService,
+		operations:       operations,
 	}
 }
 
@@ -161,6 +163,28 @@ func (sc *SysController) RefreshCache(c *gin.Context) {
 	c.JSON(http.StatusOK, models.SuccessResponse(nil, "Cache refresh started"))
 }
 
+// GetOperations 进行中的长时间操作，以及上次关闭时被中断的操作
+func (sc *SysController) GetOperations(c *gin.Context) {
+	interrupted, err := sc.operations.Interrupted()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{
+		"running":     sc.operations.Running(),
+		"interrupted": interrupted,
+	}, "获取成功"))
+}
+
+// ClearInterruptedOperations 确认并清除被中断操作的记录
+func (sc *SysController) ClearInterruptedOperations(c *gin.Context) {
+	if err := sc.operations.ClearInterrupted(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "清除成功"))
+}
+
 const (
 	MfaEnabledKey = "mfa_enabled"
 	MfaSecretKey  = "mfa_secret"
@@ -23,18 +23,26 @@ func NewTaskController(taskService *services.TaskService) *TaskController {
 }
 
 type CreateTaskRequest struct {
-	UserID          string  `json:"userId" binding:"required"`
-	OciRegion       string  `json:"ociRegion" binding:"required"`
-	Ocpus           float64 `json:"ocpus"`
-	Memory          float64 `json:"memory"`
-	Disk            int     `json:"disk"`
-	BootVolumeVpu   int64   `json:"bootVolumeVpu"`
-	Architecture    string  `json:"architecture"`
-	OperationSystem string  `json:"operationSystem"`
-	ImageId         string  `json:"imageId"`
-	SSHKeyID        string  `json:"sshKeyId" binding:"required"`
-	Interval        int     `json:"interval"`
-	ExecuteOnce     bool    `json:"executeOnce"`
+	UserID          string   `json:"userId" binding:"required"`
+	OciRegion       string   `json:"ociRegion" binding:"required"`
+	CompartmentID   string   `json:"compartmentId"` // 为空时使用配置的默认区间
+	Ocpus           float64  `json:"ocpus"`
+	Memory          float64  `json:"memory"`
+	Disk            int      `json:"disk"`
+	BootVolumeVpu   int64    `json:"bootVolumeVpu"`
+	Architecture    string   `json:"architecture"`
+	Shape           string   `json:"shape"`
+	OperationSystem string   `json:"operationSystem"`
+	ImageId         string   `json:"imageId"`
+	UserDataID      string   `json:"userDataId"`
+	EnableRootLogin bool     `json:"enableRootLogin"`
+	RootPassword    string   `json:"rootPassword"`
+	SSHPort         int      `json:"sshPort"`
+	PresetID        string   `json:"presetId"` // 从预设创建时沿用预设中保存的root密码
+	SSHKeyID        string   `json:"sshKeyId"`
+	SSHKeyIDs       []string `json:"sshKeyIds"` // 多个公钥同时注入 ssh_authorized_keys
+	Interval        int      `json:"interval"`
+	ExecuteOnce     bool     `json:"executeOnce"`
 }
 
 func (tc *TaskController) CreateTask(c *gin.Context) {
@@ -44,9 +52,9 @@ func (tc *TaskController) CreateTask(c *gin.Context) {
 		return
 	}
 
-	var sshKey models.SSHKey
-	if err := database.GetDB().First(&sshKey, "id = ?", req.SSHKeyID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "SSH密钥不存在"))
+	sshKeyID, sshKeyIDs, err := normalizeSSHKeys(req.SSHKeyID, req.SSHKeyIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
 		return
 	}
 
@@ -56,6 +64,14 @@ func (tc *TaskController) CreateTask(c *gin.Context) {
 		return
 	}
 
+	if req.UserDataID != "" {
+		var tpl models.UserDataTemplate
+		if err := database.GetDB().First(&tpl, "id = ?", req.UserDataID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "用户数据模板不存在"))
+			return
+		}
+	}
+
 	if req.Interval < 10 {
 		req.Interval = 60
 	}
@@ -78,6 +94,20 @@ func (tc *TaskController) CreateTask(c *gin.Context) {
 		req.OperationSystem = "Ubuntu"
 	}
 
+	// 指定规格时提前校验，避免任务反复以同样的错误失败
+	if req.Shape != "" {
+		if err := tc.taskService.ValidateShape(&user, req.OciRegion, req.Shape, req.Ocpus, req.Memory); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+			return
+		}
+	}
+
+	rootPassword, err := resolveRootPassword(req.EnableRootLogin, req.RootPassword, req.SSHPort, req.PresetID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
 	// 如果是只执行一次，状态设置为 pending，执行后变为 completed 或 error
 	status := "running"
 	if req.ExecuteOnce {
@@ -89,14 +119,21 @@ func (tc *TaskController) CreateTask(c *gin.Context) {
 		UserID:          req.UserID,
 		Username:        user.Username,
 		OciRegion:       req.OciRegion,
+		CompartmentID:   req.CompartmentID,
 		Ocpus:           req.Ocpus,
 		Memory:          req.Memory,
 		Disk:            req.Disk,
 		BootVolumeVpu:   req.BootVolumeVpu,
 		Architecture:    req.Architecture,
+		Shape:           req.Shape,
 		OperationSystem: req.OperationSystem,
 		ImageId:         req.ImageId,
-		SSHKeyID:        req.SSHKeyID,
+		UserDataID:      req.UserDataID,
+		EnableRootLogin: req.EnableRootLogin,
+		RootPassword:    rootPassword,
+		SSHPort:         req.SSHPort,
+		SSHKeyID:        sshKeyID,
+		SSHKeyIDs:       sshKeyIDs,
 		Interval:        req.Interval,
 		Status:          status,
 		CreateTime:      time.Now(),
@@ -170,12 +207,17 @@ func (tc *TaskController) TaskList(c *gin.Context) {
 			UserID:          t.UserID,
 			Username:        t.Username,
 			OciRegion:       t.OciRegion,
+			CompartmentID:   t.CompartmentID,
 			Ocpus:           t.Ocpus,
 			Memory:          t.Memory,
 			Disk:            t.Disk,
 			Architecture:    t.Architecture,
+			Shape:           t.Shape,
 			Interval:        t.Interval,
 			OperationSystem: t.OperationSystem,
+			UserDataID:      t.UserDataID,
+			EnableRootLogin: t.EnableRootLogin,
+			SSHPort:         t.SSHPort,
 			Status:          t.Status,
 			ExecuteCount:    t.ExecuteCount,
 			SuccessCount:    t.SuccessCount,
@@ -316,3 +358,59 @@ func (tc *TaskController) ClearTaskLogs(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.SuccessResponse(nil, "日志已清空"))
 }
+
+// resolveRootPassword 校验 root 登录配置并返回加密后的密码
+// 未填写密码时沿用预设中保存的密码，均为空则在创建实例时随机生成
+func resolveRootPassword(enable bool, password string, sshPort int, presetID string) (string, error) {
+	if err := services.ValidateSSHPort(enable, sshPort); err != nil {
+		return "", err
+	}
+	if !enable {
+		return "", nil
+	}
+	if err := services.ValidateRootLogin(password, sshPort); err != nil {
+		return "", err
+	}
+	if password == "" {
+		if presetID == "" {
+			return "", nil
+		}
+		var preset models.InstancePreset
+		if err := database.GetDB().First(&preset, "id = ?", presetID).Error; err != nil {
+			return "", fmt.Errorf("预设不存在")
+		}
+		return preset.RootPassword, nil
+	}
+	encrypted, err := services.EncryptSecret(password)
+	if err != nil {
+		return "", fmt.Errorf("加密root密码失败: %w", err)
+	}
+	return encrypted, nil
+}
+
+// normalizeSSHKeys 校验主密钥及额外密钥是否存在，未指定主密钥时取第一个，返回去重后的额外密钥
+func normalizeSSHKeys(primary string, extra []string) (string, []string, error) {
+	if primary == "" && len(extra) > 0 {
+		primary, extra = extra[0], extra[1:]
+	}
+	if primary == "" {
+		return "", nil, fmt.Errorf("请至少选择一个SSH密钥")
+	}
+
+	seen := map[string]bool{primary: true}
+	ids := []string{}
+	for _, id := range extra {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	var count int64
+	database.GetDB().Model(&models.SSHKey{}).Where("id IN ?", append([]string{primary}, ids...)).Count(&count)
+	if int(count) != len(ids)+1 {
+		return "", nil, fmt.Errorf("SSH密钥不存在")
+	}
+	return primary, ids, nil
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TrafficController struct {
+	quotaService   *services.TrafficQuotaService
+	historyService *services.TrafficHistoryService
+}
+
+func NewTrafficController(quotaService *services.TrafficQuotaService, historyService *services.TrafficHistoryService) *TrafficController {
+	return &TrafficController{
+		quotaService:   quotaService,
+		historyService: historyService,
+	}
+}
+
+type TrafficConfigRequest struct {
+	ConfigID string `json:"configId" binding:"required"`
+}
+
+type SetTrafficQuotaRequest struct {
+	ConfigID     string `json:"configId" binding:"required"`
+	InstanceID   string `json:"instanceId"`   // 为空时对整个配置生效
+	LimitBytes   int64  `json:"limitBytes"`   // 为 0 时使用 10TB
+	WarnPercents []int  `json:"warnPercents"` // 为空时使用 80、90
+	Action       string `json:"action"`       // none, stop, detach_ip, tighten_rules
+}
+
+type DeleteTrafficQuotaRequest struct {
+	ID string `json:"id" binding:"required"`
+}
+
+type TrafficQuotaLogsRequest struct {
+	ConfigID string `json:"configId" binding:"required"`
+	Limit    int    `json:"limit"`
+}
+
+type TrafficHistoryRequest struct {
+	ConfigID   string `json:"configId" binding:"required"`
+	InstanceID string `json:"instanceId"` // 为空时汇总整个配置
+	StartTime  string `json:"startTime"`  // 2006-01-02 15:04:05，默认结束时间前 24 小时
+	EndTime    string `json:"endTime"`    // 2006-01-02 15:04:05，默认当前时间
+	Resolution string `json:"resolution"` // auto, hour, day, month
+	Refresh    bool   `json:"refresh"`    // 查询前立即采集一次
+}
+
+// ListQuotas 获取配置的流量配额及上次检查的用量
+func (tc *TrafficController) ListQuotas(c *gin.Context) {
+	var req TrafficConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	quotas, err := tc.quotaService.ListQuotas(req.ConfigID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(quotas, "Success"))
+}
+
+// SetQuota 设置配置或实例的月度出站流量配额
+func (tc *TrafficController) SetQuota(c *gin.Context) {
+	var req SetTrafficQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	quota, err := tc.quotaService.SetQuota(services.SetTrafficQuotaParams{
+		ConfigID:     req.ConfigID,
+		InstanceID:   req.InstanceID,
+		LimitBytes:   req.LimitBytes,
+		WarnPercents: req.WarnPercents,
+		Action:       req.Action,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(quota, "流量配额已保存"))
+}
+
+// DeleteQuota 删除流量配额
+func (tc *TrafficController) DeleteQuota(c *gin.Context) {
+	var req DeleteTrafficQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	err := tc.quotaService.DeleteQuota(req.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "流量配额不存在"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "流量配额已删除"))
+}
+
+// CheckQuota 立即检查配置的流量配额，达到阈值时同样会通知和执行动作
+func (tc *TrafficController) CheckQuota(c *gin.Context) {
+	var req TrafficConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	quotas, err := tc.quotaService.Check(req.ConfigID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(quotas, "Success"))
+}
+
+// GetQuotaLogs 获取流量配额的告警和动作记录
+func (tc *TrafficController) GetQuotaLogs(c *gin.Context) {
+	var req TrafficQuotaLogsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	logs, err := tc.quotaService.ListLogs(req.ConfigID, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(logs, "Success"))
+}
+
+// GetTrafficHistory 查询本地保存的历史流量，返回完整时间戳和按实例的合计
+func (tc *TrafficController) GetTrafficHistory(c *gin.Context) {
+	var req TrafficHistoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	end := time.Now()
+	if req.EndTime != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", req.EndTime, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "结束时间格式错误"))
+			return
+		}
+		end = t
+	}
+	start := end.Add(-24 * time.Hour)
+	if req.StartTime != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", req.StartTime, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "开始时间格式错误"))
+			return
+		}
+		start = t
+	}
+
+	if req.Refresh {
+		var user models.OciUser
+		if err := database.GetDB().Where("id = ?", req.ConfigID).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse(404, "Configuration not found"))
+			return
+		}
+		if err := tc.historyService.Collect(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, err.Error()))
+			return
+		}
+	}
+
+	history, err := tc.historyService.History(req.ConfigID, req.InstanceID, start, end, req.Resolution)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(history, "Success"))
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/adiecho/oci-panel/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type UserDataController struct{}
+
+func NewUserDataController() *UserDataController {
+	return &UserDataController{}
+}
+
+type CreateUserDataRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Content     string `json:"content" binding:"required"`
+	Description string `json:"description"`
+}
+
+func (uc *UserDataController) CreateUserData(c *gin.Context) {
+	var req CreateUserDataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	if err := services.ValidateUserData(req.Content); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	tpl := &models.UserDataTemplate{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Content:     req.Content,
+		Description: req.Description,
+		CreateTime:  time.Now(),
+	}
+
+	if err := database.GetDB().Create(tpl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "创建模板失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(tpl, "创建成功"))
+}
+
+type UpdateUserDataRequest struct {
+	ID          string `json:"id" binding:"required"`
+	Name        string `json:"name" binding:"required"`
+	Content     string `json:"content" binding:"required"`
+	Description string `json:"description"`
+}
+
+func (uc *UserDataController) UpdateUserData(c *gin.Context) {
+	var req UpdateUserDataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	if err := services.ValidateUserData(req.Content); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	var tpl models.UserDataTemplate
+	if err := database.GetDB().First(&tpl, "id = ?", req.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "模板不存在"))
+		return
+	}
+
+	updates := map[string]interface{}{
+		"name":        req.Name,
+		"content":     req.Content,
+		"description": req.Description,
+	}
+
+	if err := database.GetDB().Model(&tpl).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "更新失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "更新成功"))
+}
+
+type DeleteUserDataRequest struct {
+	ID string `json:"id" binding:"required"`
+}
+
+func (uc *UserDataController) DeleteUserData(c *gin.Context) {
+	var req DeleteUserDataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	db := database.GetDB()
+
+	// 仍被预设或运行中任务引用的模板不允许删除
+	var refs int64
+	db.Model(&models.InstancePreset{}).Where("user_data_id = ?", req.ID).Count(&refs)
+	if refs == 0 {
+		db.Model(&models.OciCreateTask{}).Where("user_data_id = ? AND status IN ?", req.ID, []string{"running", "pending"}).Count(&refs)
+	}
+	if refs > 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "模板正在被预设或任务使用，无法删除"))
+		return
+	}
+
+	if err := db.Delete(&models.UserDataTemplate{}, "id = ?", req.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "删除失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(nil, "删除成功"))
+}
+
+func (uc *UserDataController) ListUserData(c *gin.Context) {
+	var list []models.UserDataTemplate
+	if err := database.GetDB().Order("create_time DESC").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse(500, "获取列表失败"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(list, "success"))
+}
+
+func (uc *UserDataController) GetUserData(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, "缺少ID参数"))
+		return
+	}
+
+	var tpl models.UserDataTemplate
+	if err := database.GetDB().First(&tpl, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse(404, "模板不存在"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse(tpl, "success"))
+}
+
+type PreviewUserDataRequest struct {
+	Content   string `json:"content" binding:"required"`
+	Hostname  string `json:"hostname"`
+	Region    string `json:"region"`
+	PublicKey string `json:"publicKey"`
+}
+
+// PreviewUserData 预览模板变量替换后的用户数据
+func (uc *UserDataController) PreviewUserData(c *gin.Context) {
+	var req PreviewUserDataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse(400, err.Error()))
+		return
+	}
+
+	rendered := services.RenderUserData(req.Content, services.UserDataVars{
+		Hostname:  req.Hostname,
+		Region:    req.Region,
+		PublicKey: req.PublicKey,
+	})
+
+	c.JSON(http.StatusOK, models.SuccessResponse(gin.H{"content": rendered}, "success"))
+}
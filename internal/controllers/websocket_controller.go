@@ -1,49 +1,165 @@
 package controllers
 
 import (
-	"log"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/adiecho/oci-panel/internal/config"
+	"github.com/adiecho/oci-panel/internal/logger"
+	"github.com/adiecho/oci-panel/internal/middleware"
+	"github.com/adiecho/oci-panel/internal/models"
 	"github.com/adiecho/oci-panel/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// wsAuthTimeout 未在查询参数中携带 token 时，等待首条认证消息的时间
+const wsAuthTimeout = 10 * time.Second
+
+// newUpgrader 创建 WebSocket upgrader，只允许同源、非浏览器客户端或配置中列出的来源
+// 未配置 websocket.allowed_origins 时使用 passkey.rp_origins
+func newUpgrader(cfg *config.Config) *websocket.Upgrader {
+	origins := cfg.WebSocket.AllowedOrigins
+	if len(origins) == 0 {
+		origins = cfg.Passkey.RPOrigins
+	}
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowed[strings.ToLower(strings.TrimRight(o, "/"))] = true
+	}
+
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			u, err := url.Parse(origin)
+			if err != nil {
+				return false
+			}
+			if strings.EqualFold(u.Host, r.Host) {
+				return true
+			}
+			return allowed[strings.ToLower(u.Scheme+"://"+u.Host)]
+		},
+	}
 }
 
 type WebSocketController struct {
 	wsService *services.WebSocketService
+	upgrader  *websocket.Upgrader
 }
 
-func NewWebSocketController(wsService *services.WebSocketService) *WebSocketController {
-	return &WebSocketController{wsService: wsService}
+func NewWebSocketController(cfg *config.Config, wsService *services.WebSocketService) *WebSocketController {
+	return &WebSocketController{
+		wsService: wsService,
+		upgrader:  newUpgrader(cfg),
+	}
+}
+
+// wsControlMessage 日志流客户端消息，type 为 auth / level / subscribe / unsubscribe
+type wsControlMessage struct {
+	Type   string   `json:"type"`
+	Token  string   `json:"token,omitempty"`
+	Level  string   `json:"level,omitempty"`
+	Topics []string `json:"topics,omitempty"`
 }
 
+// wsEvent 日志流服务端事件，type 为 connected / subscribed / error
+type wsEvent struct {
+	Type    string   `json:"type"`
+	Message string   `json:"message,omitempty"`
+	Level   string   `json:"level,omitempty"`
+	Topics  []string `json:"topics,omitempty"`
+}
+
+// HandleWebSocket 实时日志流
+// token 通过查询参数传递，或在连接后 10 秒内发送 {"type":"auth","token":"..."}
+// ?level= 设置最低日志级别（默认 info），?topics= 设置订阅主题（逗号分隔，如 task:<id>,job:<id>,rescue:<id>，默认 all）
 func (wc *WebSocketController) HandleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	queryToken := c.Query("token")
+	if queryToken != "" {
+		if _, err := middleware.ParseToken(queryToken); err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse(401, "Unauthorized"))
+			return
+		}
+	}
+
+	conn, err := wc.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		slog.WarnContext(c.Request.Context(), "Failed to upgrade log stream connection", "error", err)
+		return
+	}
+
+	if queryToken == "" && !wc.authenticate(conn) {
+		conn.Close()
 		return
 	}
 
-	wc.wsService.RegisterClient(conn)
+	level := logger.ParseLevel(c.Query("level"))
+	var topics []string
+	for _, t := range strings.Split(c.Query("topics"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			topics = append(topics, t)
+		}
+	}
+	wc.wsService.RegisterClient(conn, level, topics)
 	defer wc.wsService.UnregisterClient(conn)
 
-	wc.wsService.SendInfo("Connected to log stream")
+	wc.sendEvent(conn, wsEvent{Type: "connected", Message: "Connected to log stream", Level: logger.LevelName(level), Topics: wc.wsService.Subscribe(conn, nil)})
 
 	for {
-		_, _, err := conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				slog.WarnContext(c.Request.Context(), "Log stream connection error", "error", err)
 			}
 			break
 		}
+		var msg wsControlMessage
+		if json.Unmarshal(data, &msg) != nil {
+			wc.sendEvent(conn, wsEvent{Type: "error", Message: "无效的消息"})
+			continue
+		}
+		switch msg.Type {
+		case "level":
+			wc.wsService.SetClientLevel(conn, logger.ParseLevel(msg.Level))
+		case "subscribe":
+			wc.sendEvent(conn, wsEvent{Type: "subscribed", Topics: wc.wsService.Subscribe(conn, msg.Topics)})
+		case "unsubscribe":
+			wc.sendEvent(conn, wsEvent{Type: "subscribed", Topics: wc.wsService.Unsubscribe(conn, msg.Topics)})
+		case "auth":
+		default:
+			wc.sendEvent(conn, wsEvent{Type: "error", Message: "不支持的消息类型: " + msg.Type})
+		}
 	}
 }
+
+// authenticate 读取首条认证消息，此时连接尚未注册，可以直接写入
+func (wc *WebSocketController) authenticate(conn *websocket.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+	var msg wsControlMessage
+	err := conn.ReadJSON(&msg)
+	if err == nil && msg.Type == "auth" {
+		if _, err = middleware.ParseToken(msg.Token); err == nil {
+			conn.SetReadDeadline(time.Time{})
+			return true
+		}
+	}
+	data, _ := json.Marshal(wsEvent{Type: "error", Message: "Unauthorized"})
+	conn.SetWriteDeadline(time.Now().Add(wsAuthTimeout))
+	conn.WriteMessage(websocket.TextMessage, data)
+	return false
+}
+
+func (wc *WebSocketController) sendEvent(conn *websocket.Conn, event wsEvent) {
+	data, _ := json.Marshal(event)
+	wc.wsService.SendToClient(conn, data)
+}
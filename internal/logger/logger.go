@@ -0,0 +1,205 @@
+// Package logger 基于 slog 的结构化日志，按配置的级别输出到标准错误，并可同时转发到实时日志流
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Record 转发给日志流的单条日志
+type Record struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Attrs   map[string]any
+}
+
+// Sink 日志流接收端，Enabled 用于在没有订阅者时跳过格式化
+type Sink interface {
+	Enabled(level slog.Level) bool
+	Publish(record Record)
+}
+
+type sinkHolder struct {
+	sink Sink
+}
+
+var currentSink atomic.Pointer[sinkHolder]
+
+// SetSink 设置日志流接收端，传入 nil 取消转发
+func SetSink(sink Sink) {
+	if sink == nil {
+		currentSink.Store(nil)
+		return
+	}
+	currentSink.Store(&sinkHolder{sink: sink})
+}
+
+func loadSink() Sink {
+	if h := currentSink.Load(); h != nil {
+		return h.sink
+	}
+	return nil
+}
+
+// ParseLevel 解析配置中的日志级别，无法识别时返回 info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// LevelName 日志级别的小写名称
+func LevelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// Setup 按配置的级别初始化默认 logger，标准库 log 的输出同样经过该 logger
+func Setup(level string) {
+	slog.SetDefault(slog.New(newHandler(ParseLevel(level))))
+}
+
+type ctxKey struct{}
+
+// With 在 context 中附加日志字段，使用 *Context 方法记录日志时自动带上
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := append(contextAttrs(ctx), argsToAttrs(args)...)
+	return context.WithValue(ctx, ctxKey{}, attrs)
+}
+
+func contextAttrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return attrs[:len(attrs):len(attrs)]
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	var r slog.Record
+	r.Add(args...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// handler 输出到标准错误，同时把日志转发给 Sink
+type handler struct {
+	out    slog.Handler
+	level  slog.Level
+	attrs  []slog.Attr
+	prefix string
+}
+
+func newHandler(level slog.Level) *handler {
+	return &handler{
+		out:   slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}),
+		level: level,
+	}
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	if level >= h.level {
+		return true
+	}
+	sink := loadSink()
+	return sink != nil && sink.Enabled(level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if extra := contextAttrs(ctx); len(extra) > 0 {
+		r = r.Clone()
+		r.AddAttrs(extra...)
+	}
+
+	var err error
+	if r.Level >= h.level {
+		err = h.out.Handle(ctx, r)
+	}
+
+	if sink := loadSink(); sink != nil && sink.Enabled(r.Level) {
+		record := Record{Time: r.Time, Level: r.Level, Message: r.Message, Attrs: map[string]any{}}
+		for _, a := range h.attrs {
+			addAttr(record.Attrs, "", a)
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			addAttr(record.Attrs, h.prefix, a)
+			return true
+		})
+		sink.Publish(record)
+	}
+	return err
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.out = h.out.WithAttrs(attrs)
+	clone.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], prefixAttrs(h.prefix, attrs)...)
+	return &clone
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.out = h.out.WithGroup(name)
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func prefixAttrs(prefix string, attrs []slog.Attr) []slog.Attr {
+	if prefix == "" {
+		return attrs
+	}
+	result := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		result[i] = slog.Attr{Key: prefix + a.Key, Value: a.Value}
+	}
+	return result
+}
+
+// addAttr 展开分组字段，键名以点号连接
+func addAttr(dst map[string]any, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		p := prefix
+		if a.Key != "" {
+			p = prefix + a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			addAttr(dst, p, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	switch v.Kind() {
+	case slog.KindAny:
+		if e, ok := v.Any().(error); ok {
+			dst[prefix+a.Key] = e.Error()
+			return
+		}
+		dst[prefix+a.Key] = v.Any()
+	case slog.KindDuration:
+		dst[prefix+a.Key] = v.Duration().String()
+	case slog.KindTime:
+		dst[prefix+a.Key] = v.Time().Format("2006-01-02 15:04:05")
+	default:
+		dst[prefix+a.Key] = v.Any()
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader 请求 ID 的请求头和响应头
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID 为每个请求分配 ID，沿用客户端传入的 X-Request-ID，并附加到请求 context 的日志字段中
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = uuid.New().String()
+		}
+		c.Set("requestId", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logger.With(c.Request.Context(), "request_id", id))
+		c.Next()
+	}
+}
+
+// RequestLogger 记录请求日志，API 请求为 info，静态资源等其他请求为 debug，出错时提升级别
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelDebug
+		if strings.HasPrefix(c.Request.URL.Path, "/api") {
+			level = slog.LevelInfo
+		}
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if username := c.GetString("username"); username != "" {
+			attrs = append(attrs, slog.String("username", username))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "HTTP request", attrs...)
+	}
+}
@@ -17,6 +17,23 @@ type OciUser struct {
 	OciRegion        string     `gorm:"column:oci_region" json:"ociRegion"`
 	OciKeyPath       string     `gorm:"column:oci_key_path" json:"ociKeyPath"`
 	CreateTime       time.Time  `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+
+	// DefaultCompartmentID 默认区间，为空时使用租户根区间
+	DefaultCompartmentID string `gorm:"column:default_compartment_id" json:"defaultCompartmentId"`
+
+	// 凭据健康检查结果
+	HealthStatus    string     `gorm:"column:health_status" json:"healthStatus"` // ok / invalid / error，空表示未检查
+	HealthCheckTime *time.Time `gorm:"column:health_check_time" json:"healthCheckTime"`
+	LastOkTime      *time.Time `gorm:"column:last_ok_time" json:"lastOkTime"`
+	LastError       string     `gorm:"column:last_error;type:text" json:"lastError"`
+}
+
+// ResourceCompartmentID 浏览和创建资源使用的区间
+func (u *OciUser) ResourceCompartmentID() string {
+	if u.DefaultCompartmentID != "" {
+		return u.DefaultCompartmentID
+	}
+	return u.OciTenantID
 }
 
 // OciUserListResponse 配置列表响应
@@ -30,6 +47,14 @@ type OciUserListResponse struct {
 	CreateTime       string `json:"createTime"`
 	InstanceCount    int    `json:"instanceCount"`
 	RunningInstances int    `json:"runningInstances"`
+
+	DefaultCompartmentID string                `json:"defaultCompartmentId"`
+	Regions              []RegionResourceCount `json:"regions"`
+
+	HealthStatus    string `json:"healthStatus"`
+	HealthCheckTime string `json:"healthCheckTime"`
+	LastOkTime      string `json:"lastOkTime"`
+	LastError       string `json:"lastError"`
 }
 
 // OciConfigDetails 配置详情响应
@@ -45,6 +70,16 @@ type OciConfigDetails struct {
 	Instances   []InstanceInfo `json:"instances"`
 	Volumes     []VolumeInfo   `json:"volumes"`
 	VCNs        []VCNInfo      `json:"vcns"`
+
+	DefaultCompartmentID string                `json:"defaultCompartmentId"`
+	Regions              []RegionResourceCount `json:"regions"`
+
+	HealthStatus    string `json:"healthStatus"`
+	HealthCheckTime string `json:"healthCheckTime"`
+	LastOkTime      string `json:"lastOkTime"`
+	LastError       string `json:"lastError"`
+
+	Cost *CostUsageReport `json:"cost"` // 缓存的费用汇总，未获取时为 null
 }
 
 // InstanceInfo 实例信息
@@ -53,6 +88,7 @@ type InstanceInfo struct {
 	DisplayName        string     `json:"displayName"`
 	State              string     `json:"state"`
 	Shape              string     `json:"shape"`
+	CompartmentID      string     `json:"compartmentId"`
 	Ocpus              float32    `json:"ocpus"`
 	Memory             float32    `json:"memory"`
 	PublicIPs          []string   `json:"publicIps"`
@@ -65,6 +101,35 @@ type InstanceInfo struct {
 	ImageName          string     `json:"imageName"`
 	CreateTime         string     `json:"createTime"`
 	VnicList           []VnicInfo `json:"vnicList"`
+	HasRootPassword    bool       `json:"hasRootPassword"`
+	PasswordRevealed   bool       `json:"passwordRevealed"`
+	SSHPort            int        `json:"sshPort,omitempty"`
+	// Metrics 监控摘要，实例未运行或未启用 Compute Instance Monitoring 插件时为空
+	Metrics *InstanceMetricSummary `json:"metrics,omitempty"`
+}
+
+// InstanceMetricSummary 实例当前 CPU、内存使用率和 7 天空闲判断
+type InstanceMetricSummary struct {
+	CpuUtilization    *float64 `json:"cpuUtilization"`    // 最近 5 分钟平均值，百分比
+	MemoryUtilization *float64 `json:"memoryUtilization"` // 最近 5 分钟平均值，百分比
+	CpuP95            *float64 `json:"cpuP95"`            // 7 天小时均值的 95 分位
+	CoverageHours     int      `json:"coverageHours"`     // 7 天内有 CPU 数据的小时数
+	Idle              bool     `json:"idle"`              // CPU 95 分位低于回收阈值
+	UpdateTime        string   `json:"updateTime"`
+}
+
+// InstanceMetricPoint 监控数据点
+type InstanceMetricPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// InstanceMetricSeries 单个指标的时间序列
+type InstanceMetricSeries struct {
+	Metric    string                `json:"metric"`
+	Interval  string                `json:"interval"`
+	Statistic string                `json:"statistic"`
+	Points    []InstanceMetricPoint `json:"points"`
 }
 
 // VnicInfo VNIC信息
@@ -86,17 +151,31 @@ type VolumeInfo struct {
 	AvailabilityDomain string `json:"availabilityDomain"`
 	InstanceName       string `json:"instanceName"`
 	Attached           bool   `json:"attached"`
+	Region             string `json:"region"`
+	CompartmentID      string `json:"compartmentId"`
 	CreateTime         string `json:"createTime"`
 }
 
 // VCNInfo VCN信息
 type VCNInfo struct {
-	ID          string       `json:"id"`
-	DisplayName string       `json:"displayName"`
-	CIDRBlock   string       `json:"cidrBlock"`
-	State       string       `json:"state"`
-	CreateTime  string       `json:"createTime"`
-	Subnets     []SubnetInfo `json:"subnets"`
+	ID            string       `json:"id"`
+	DisplayName   string       `json:"displayName"`
+	CIDRBlock     string       `json:"cidrBlock"`
+	State         string       `json:"state"`
+	Region        string       `json:"region"`
+	CompartmentID string       `json:"compartmentId"`
+	CreateTime    string       `json:"createTime"`
+	Subnets       []SubnetInfo `json:"subnets"`
+}
+
+// RegionResourceCount 单个区域的资源统计
+type RegionResourceCount struct {
+	Region           string `json:"region"`
+	InstanceCount    int    `json:"instanceCount"`
+	RunningInstances int    `json:"runningInstances"`
+	VolumeCount      int    `json:"volumeCount"`
+	VcnCount         int    `json:"vcnCount"`
+	Error            string `json:"error,omitempty"`
 }
 
 // SubnetInfo 子网信息
@@ -144,6 +223,24 @@ type TenantInfo struct {
 	UserList             []TenantUserInfo `json:"userList"`
 }
 
+// CompartmentInfo 区间树节点
+type CompartmentInfo struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	ParentID    string            `json:"parentId"`
+	State       string            `json:"state"`
+	Children    []CompartmentInfo `json:"children"`
+}
+
+// RegionSubscriptionInfo 区域订阅状态
+type RegionSubscriptionInfo struct {
+	RegionName   string `json:"regionName"`
+	RegionKey    string `json:"regionKey"`
+	Status       string `json:"status"` // NOT_SUBSCRIBED / IN_PROGRESS / READY
+	IsHomeRegion bool   `json:"isHomeRegion"`
+}
+
 // TenantUserInfo 租户用户信息
 type TenantUserInfo struct {
 	ID                      string `json:"id"`
@@ -156,6 +253,88 @@ type TenantUserInfo struct {
 	LastSuccessfulLoginTime string `json:"lastSuccessfulLoginTime"`
 }
 
+// CostItem 费用明细项，Name 为服务名或日期
+type CostItem struct {
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+}
+
+// TrialCreditInfo 试用额度
+type TrialCreditInfo struct {
+	Amount     float64 `json:"amount"`
+	Used       float64 `json:"used"`
+	Remaining  float64 `json:"remaining"`
+	Currency   string  `json:"currency"`
+	Status     string  `json:"status"`
+	ExpireTime string  `json:"expireTime"`
+}
+
+// CostUsageReport 配置的本月费用汇总
+type CostUsageReport struct {
+	Currency         string           `json:"currency"`
+	PaymentModel     string           `json:"paymentModel"`
+	Period           string           `json:"period"` // 统计月份（UTC），2006-01
+	MonthToDate      float64          `json:"monthToDate"`
+	ForecastMonthEnd float64          `json:"forecastMonthEnd"` // 本月预计总费用，无法预测时为 0
+	ByService        []CostItem       `json:"byService"`
+	ByDay            []CostItem       `json:"byDay"`
+	TrialCredit      *TrialCreditInfo `json:"trialCredit,omitempty"`
+	UpdateTime       string           `json:"updateTime"`
+}
+
+// SecurityFinding 安全报告中的单项问题
+type SecurityFinding struct {
+	Check      string `json:"check"`    // 检查项，见 services.SecurityCheck*
+	Severity   string `json:"severity"` // high / medium / low
+	Resource   string `json:"resource"`
+	ResourceID string `json:"resourceId,omitempty"`
+	Region     string `json:"region,omitempty"`
+	Detail     string `json:"detail"`
+}
+
+// TenantSecurityReport 租户安全报告
+type TenantSecurityReport struct {
+	ConfigID    string            `json:"configId"`
+	Username    string            `json:"username"`
+	TenantName  string            `json:"tenantName"`
+	GeneratedAt string            `json:"generatedAt"`
+	UserCount   int               `json:"userCount"`
+	Findings    []SecurityFinding `json:"findings"`
+	Errors      []string          `json:"errors,omitempty"` // 未能完成的检查
+}
+
+// IAMUserInfo 新建的 IAM 用户
+type IAMUserInfo struct {
+	ID       string   `json:"id"`   // 经典模式为 OCID，Identity Domains 模式为域内 ID
+	Ocid     string   `json:"ocid"` // 用户 OCID
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Mode     string   `json:"mode"` // classic / domain
+	GroupIDs []string `json:"groupIds"`
+}
+
+// IAMGroupInfo IAM 组
+type IAMGroupInfo struct {
+	ID          string `json:"id"`
+	Ocid        string `json:"ocid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	Mode        string `json:"mode"`
+	CreateTime  string `json:"createTime"`
+}
+
+// IAMPolicyInfo IAM 策略
+type IAMPolicyInfo struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	CompartmentID string   `json:"compartmentId"`
+	Statements    []string `json:"statements"`
+	State         string   `json:"state"`
+	CreateTime    string   `json:"createTime"`
+}
+
 // TrafficData 流量数据
 type TrafficData struct {
 	Time     []string `json:"time"`
@@ -163,6 +342,33 @@ type TrafficData struct {
 	Outbound []string `json:"outbound"`
 }
 
+// TrafficHistoryPoint 历史流量时间点，Time 为时间段起点
+type TrafficHistoryPoint struct {
+	Time     time.Time `json:"time"`
+	Inbound  int64     `json:"inbound"`
+	Outbound int64     `json:"outbound"`
+}
+
+// TrafficHistoryTotal 实例在查询范围内的流量合计
+type TrafficHistoryTotal struct {
+	InstanceID   string `json:"instanceId"`
+	InstanceName string `json:"instanceName"`
+	Region       string `json:"region"`
+	Inbound      int64  `json:"inbound"`
+	Outbound     int64  `json:"outbound"`
+}
+
+// TrafficHistory 历史流量查询结果
+type TrafficHistory struct {
+	Resolution string                `json:"resolution"`
+	StartTime  time.Time             `json:"startTime"`
+	EndTime    time.Time             `json:"endTime"`
+	Points     []TrafficHistoryPoint `json:"points"`
+	Instances  []TrafficHistoryTotal `json:"instances"`
+	Inbound    int64                 `json:"inbound"`
+	Outbound   int64                 `json:"outbound"`
+}
+
 // TrafficCondition 流量查询条件
 type TrafficCondition struct {
 	Regions   []ValueLabel `json:"regions"`
@@ -184,16 +390,23 @@ type OciCreateTask struct {
 	UserID          string     `gorm:"column:user_id" json:"userId"`
 	Username        string     `gorm:"column:username" json:"username"`
 	OciRegion       string     `gorm:"column:oci_region" json:"ociRegion"`
+	CompartmentID   string     `gorm:"column:compartment_id" json:"compartmentId"` // 为空时使用配置的默认区间
 	Ocpus           float64    `gorm:"column:ocpus;default:1.0" json:"ocpus"`
 	Memory          float64    `gorm:"column:memory;default:6.0" json:"memory"`
 	Disk            int        `gorm:"column:disk;default:50" json:"disk"`
 	BootVolumeVpu   int64      `gorm:"column:boot_volume_vpu;default:10" json:"bootVolumeVpu"`
 	Architecture    string     `gorm:"column:architecture;default:ARM" json:"architecture"`
+	Shape           string     `gorm:"column:shape" json:"shape"`
 	Interval        int        `gorm:"column:interval;default:60" json:"interval"`
 	CreateNumbers   int        `gorm:"column:create_numbers;default:1" json:"createNumbers"`
 	SSHKeyID        string     `gorm:"column:ssh_key_id" json:"sshKeyId"`
+	SSHKeyIDs       []string   `gorm:"column:ssh_key_ids;serializer:json" json:"sshKeyIds"` // 额外注入的公钥
 	OperationSystem string     `gorm:"column:operation_system;default:Ubuntu" json:"operationSystem"`
 	ImageId         string     `gorm:"column:image_id" json:"imageId"`
+	UserDataID      string     `gorm:"column:user_data_id" json:"userDataId"`
+	EnableRootLogin bool       `gorm:"column:enable_root_login;default:false" json:"enableRootLogin"`
+	RootPassword    string     `gorm:"column:root_password;type:text" json:"-"` // 加密存储，为空时创建实例时随机生成
+	SSHPort         int        `gorm:"column:ssh_port;default:0" json:"sshPort"`
 	Status          string     `gorm:"column:status;default:running" json:"status"`
 	ExecuteCount    int        `gorm:"column:execute_count;default:0" json:"executeCount"`
 	SuccessCount    int        `gorm:"column:success_count;default:0" json:"successCount"`
@@ -225,12 +438,17 @@ type TaskListResponse struct {
 	UserID          string  `json:"userId"`
 	Username        string  `json:"username"`
 	OciRegion       string  `json:"ociRegion"`
+	CompartmentID   string  `json:"compartmentId"`
 	Ocpus           float64 `json:"ocpus"`
 	Memory          float64 `json:"memory"`
 	Disk            int     `json:"disk"`
 	Architecture    string  `json:"architecture"`
+	Shape           string  `json:"shape"`
 	Interval        int     `json:"interval"`
 	OperationSystem string  `json:"operationSystem"`
+	UserDataID      string  `json:"userDataId"`
+	EnableRootLogin bool    `json:"enableRootLogin"`
+	SSHPort         int     `json:"sshPort"`
 	Status          string  `json:"status"`
 	ExecuteCount    int     `json:"executeCount"`
 	SuccessCount    int     `json:"successCount"`
@@ -302,18 +520,167 @@ type OciConfigCache struct {
 	VolumesData      string    `gorm:"column:volumes_data;type:text" json:"volumesData"`
 	VcnsData         string    `gorm:"column:vcns_data;type:text" json:"vcnsData"`
 	TenantData       string    `gorm:"column:tenant_data;type:text" json:"tenantData"`
+	RegionsData      string    `gorm:"column:regions_data;type:text" json:"regionsData"`
 	UpdateTime       time.Time `gorm:"column:update_time" json:"updateTime"`
+
+	// 费用数据刷新频率低于资源缓存
+	CostData       string     `gorm:"column:cost_data;type:text" json:"costData"`
+	CostUpdateTime *time.Time `gorm:"column:cost_update_time" json:"costUpdateTime"`
 }
 
 func (OciConfigCache) TableName() string {
 	return "oci_config_cache"
 }
 
+// OciBudget 配置的月度预算
+type OciBudget struct {
+	ID          string  `gorm:"primaryKey;column:id" json:"id"`
+	ConfigID    string  `gorm:"column:config_id;uniqueIndex;not null" json:"configId"`
+	Amount      float64 `gorm:"column:amount;not null" json:"amount"`
+	AutoStop    bool    `gorm:"column:auto_stop;default:false" json:"autoStop"` // 达到 100% 时停止非免费实例
+	Mirror      bool    `gorm:"column:mirror" json:"mirror"`                    // 同步到 OCI Budgets
+	OciBudgetID string  `gorm:"column:oci_budget_id" json:"ociBudgetId"`
+	MirrorError string  `gorm:"column:mirror_error;type:text" json:"mirrorError"`
+
+	// 本月评估状态，跨月自动重置
+	Month           string     `gorm:"column:month" json:"month"` // 2006-01
+	NotifiedPercent int        `gorm:"column:notified_percent;default:0" json:"notifiedPercent"`
+	AutoStopped     bool       `gorm:"column:auto_stopped;default:false" json:"autoStopped"`
+	LastSpend       float64    `gorm:"column:last_spend;default:0" json:"lastSpend"`
+	LastEvaluated   *time.Time `gorm:"column:last_evaluated" json:"lastEvaluated"`
+
+	CreateTime time.Time `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+	UpdateTime time.Time `gorm:"column:update_time;autoUpdateTime" json:"updateTime"`
+}
+
+func (OciBudget) TableName() string {
+	return "oci_budget"
+}
+
+// OciTrafficQuota 月度出站流量配额，InstanceID 为空时对整个配置生效
+type OciTrafficQuota struct {
+	ID           string `gorm:"primaryKey;column:id" json:"id"`
+	ConfigID     string `gorm:"column:config_id;index;not null" json:"configId"`
+	InstanceID   string `gorm:"column:instance_id;index" json:"instanceId"`
+	InstanceName string `gorm:"column:instance_name" json:"instanceName"`
+	LimitBytes   int64  `gorm:"column:limit_bytes;not null" json:"limitBytes"`
+	WarnPercents []int  `gorm:"column:warn_percents;serializer:json" json:"warnPercents"`
+	Action       string `gorm:"column:action" json:"action"` // none, stop, detach_ip, tighten_rules
+
+	// 本月检查状态，跨月自动重置
+	Month           string     `gorm:"column:month" json:"month"` // 2006-01
+	NotifiedPercent int        `gorm:"column:notified_percent;default:0" json:"notifiedPercent"`
+	ActionTaken     bool       `gorm:"column:action_taken;default:false" json:"actionTaken"`
+	LastEgress      int64      `gorm:"column:last_egress;default:0" json:"lastEgress"`
+	LastChecked     *time.Time `gorm:"column:last_checked" json:"lastChecked"`
+
+	CreateTime time.Time `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+	UpdateTime time.Time `gorm:"column:update_time;autoUpdateTime" json:"updateTime"`
+}
+
+func (OciTrafficQuota) TableName() string {
+	return "oci_traffic_quota"
+}
+
+// OciTrafficQuotaLog 流量配额告警和执行动作的记录
+type OciTrafficQuotaLog struct {
+	ID         string    `gorm:"primaryKey;column:id" json:"id"`
+	QuotaID    string    `gorm:"column:quota_id;index" json:"quotaId"`
+	ConfigID   string    `gorm:"column:config_id;index" json:"configId"`
+	InstanceID string    `gorm:"column:instance_id" json:"instanceId"`
+	Event      string    `gorm:"column:event" json:"event"` // warn, action, error
+	Message    string    `gorm:"column:message;type:text" json:"message"`
+	CreateTime time.Time `gorm:"column:create_time;autoCreateTime;index" json:"createTime"`
+}
+
+func (OciTrafficQuotaLog) TableName() string {
+	return "oci_traffic_quota_log"
+}
+
+// OciTrafficSample VNIC 流量时间序列，按小时采集并汇总为天和月
+type OciTrafficSample struct {
+	ID           string    `gorm:"primaryKey;column:id" json:"id"`
+	ConfigID     string    `gorm:"column:config_id;index:idx_traffic_sample_config,priority:1;not null" json:"configId"`
+	InstanceID   string    `gorm:"column:instance_id;index" json:"instanceId"`
+	InstanceName string    `gorm:"column:instance_name" json:"instanceName"`
+	Region       string    `gorm:"column:region" json:"region"`
+	VnicID       string    `gorm:"column:vnic_id;uniqueIndex:idx_traffic_sample_bucket,priority:1;not null" json:"vnicId"`
+	Resolution   string    `gorm:"column:resolution;uniqueIndex:idx_traffic_sample_bucket,priority:2;index:idx_traffic_sample_config,priority:2;not null" json:"resolution"`  // hour, day, month
+	BucketTime   time.Time `gorm:"column:bucket_time;uniqueIndex:idx_traffic_sample_bucket,priority:3;index:idx_traffic_sample_config,priority:3;not null" json:"bucketTime"` // UTC 时间段起点
+	InBytes      int64     `gorm:"column:in_bytes;default:0" json:"inBytes"`
+	OutBytes     int64     `gorm:"column:out_bytes;default:0" json:"outBytes"`
+}
+
+func (OciTrafficSample) TableName() string {
+	return "oci_traffic_sample"
+}
+
+// OciIdleAssessment Always Free 实例的空闲回收风险评估，每个实例保存最近一次结果
+type OciIdleAssessment struct {
+	ID            string    `gorm:"primaryKey;column:id" json:"id"`
+	ConfigID      string    `gorm:"column:config_id;index;not null" json:"configId"`
+	InstanceID    string    `gorm:"column:instance_id;uniqueIndex;not null" json:"instanceId"`
+	InstanceName  string    `gorm:"column:instance_name" json:"instanceName"`
+	Region        string    `gorm:"column:region" json:"region"`
+	Shape         string    `gorm:"column:shape" json:"shape"`
+	CpuP95        *float64  `gorm:"column:cpu_p95" json:"cpuP95"`         // 7 天 CPU 使用率 95 分位
+	NetworkP95    *float64  `gorm:"column:network_p95" json:"networkP95"` // 7 天网络带宽使用率 95 分位
+	MemoryP95     *float64  `gorm:"column:memory_p95" json:"memoryP95"`   // 7 天内存使用率 95 分位，仅 A1 规格参与判断
+	CoverageHours int       `gorm:"column:coverage_hours;default:0" json:"coverageHours"`
+	Status        string    `gorm:"column:status;index" json:"status"` // ok, at_risk, idle, no_data
+	Reason        string    `gorm:"column:reason;type:text" json:"reason"`
+	UpdateTime    time.Time `gorm:"column:update_time" json:"updateTime"`
+}
+
+func (OciIdleAssessment) TableName() string {
+	return "oci_idle_assessment"
+}
+
+// OciOperation 进行中的长时间云操作，完成后删除；重启时仍存在的记录表示操作被中断
+type OciOperation struct {
+	ID         string     `gorm:"primaryKey;column:id" json:"id"`
+	Kind       string     `gorm:"column:kind;index" json:"kind"` // auto_rescue, enable_500mbps, delete_vcn 等
+	ConfigID   string     `gorm:"column:config_id;index" json:"configId"`
+	TargetID   string     `gorm:"column:target_id" json:"targetId"`  // 实例或 VCN 等操作对象
+	Status     string     `gorm:"column:status;index" json:"status"` // running, interrupted
+	Progress   string     `gorm:"column:progress;type:text" json:"progress"`
+	StartTime  time.Time  `gorm:"column:start_time" json:"startTime"`
+	UpdateTime time.Time  `gorm:"column:update_time" json:"updateTime"`
+	EndTime    *time.Time `gorm:"column:end_time" json:"endTime"`
+}
+
+func (OciOperation) TableName() string {
+	return "oci_operation"
+}
+
+// OciJob 后台任务，长时间的云操作在工作池中执行，状态、进度和结果持久化，重启后恢复未完成的任务
+type OciJob struct {
+	ID         string     `gorm:"primaryKey;column:id" json:"id"`
+	Kind       string     `gorm:"column:kind;index" json:"kind"` // auto_rescue, enable_500mbps, change_public_ip 等
+	ConfigID   string     `gorm:"column:config_id;index" json:"configId"`
+	TargetID   string     `gorm:"column:target_id;index" json:"targetId"` // 实例或 VCN 等操作对象
+	Params     string     `gorm:"column:params;type:text" json:"params"`  // JSON
+	Status     string     `gorm:"column:status;index" json:"status"`      // pending, running, succeeded, failed, cancelled
+	Progress   string     `gorm:"column:progress;type:text" json:"progress"`
+	Result     string     `gorm:"column:result;type:text" json:"result"` // JSON
+	Error      string     `gorm:"column:error;type:text" json:"error"`
+	Attempts   int        `gorm:"column:attempts;default:0" json:"attempts"`
+	CreateTime time.Time  `gorm:"column:create_time;index" json:"createTime"`
+	StartTime  *time.Time `gorm:"column:start_time" json:"startTime"`
+	UpdateTime time.Time  `gorm:"column:update_time" json:"updateTime"`
+	EndTime    *time.Time `gorm:"column:end_time" json:"endTime"`
+}
+
+func (OciJob) TableName() string {
+	return "oci_job"
+}
+
 // OciImageCache 镜像缓存表
 type OciImageCache struct {
 	ID           string    `gorm:"primaryKey;column:id" json:"id"`
 	Region       string    `gorm:"column:region;not null" json:"region"`
 	Architecture string    `gorm:"column:architecture;not null" json:"architecture"`
+	Shape        string    `gorm:"column:shape" json:"shape"`
 	ImagesData   string    `gorm:"column:images_data;type:text" json:"imagesData"`
 	UpdateTime   time.Time `gorm:"column:update_time" json:"updateTime"`
 }
@@ -322,15 +689,35 @@ func (OciImageCache) TableName() string {
 	return "oci_image_cache"
 }
 
+// OciSecurityReport 安全报告表，每个配置保存最近一次报告
+type OciSecurityReport struct {
+	ID           string    `gorm:"primaryKey;column:id" json:"id"`
+	ConfigID     string    `gorm:"column:config_id;uniqueIndex;not null" json:"configId"`
+	FindingCount int       `gorm:"column:finding_count;default:0" json:"findingCount"`
+	HighCount    int       `gorm:"column:high_count;default:0" json:"highCount"`
+	ReportData   string    `gorm:"column:report_data;type:text" json:"reportData"`
+	LastError    string    `gorm:"column:last_error;type:text" json:"lastError"` // 最近一次扫描失败的原因，成功后清空
+	CheckTime    time.Time `gorm:"column:check_time" json:"checkTime"`           // 最近一次扫描时间，失败也会更新
+	UpdateTime   time.Time `gorm:"column:update_time" json:"updateTime"`         // 最近一次成功生成报告的时间
+}
+
+func (OciSecurityReport) TableName() string {
+	return "oci_security_report"
+}
+
 // SSHKey SSH密钥表
 type SSHKey struct {
-	ID         string    `gorm:"primaryKey;column:id" json:"id"`
-	Name       string    `gorm:"column:name;not null" json:"name"`
-	PublicKey  string    `gorm:"column:public_key;type:text;not null" json:"publicKey"`
-	PrivateKey string    `gorm:"column:private_key;type:text" json:"privateKey"`
-	KeyType    string    `gorm:"column:key_type;not null" json:"keyType"` // config: 配置关联, standalone: 独立上传
-	ConfigID   string    `gorm:"column:config_id" json:"configId"`        // 关联的配置ID，独立上传时为空
-	CreateTime time.Time `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+	ID                string    `gorm:"primaryKey;column:id" json:"id"`
+	Name              string    `gorm:"column:name;not null" json:"name"`
+	PublicKey         string    `gorm:"column:public_key;type:text;not null" json:"publicKey"`
+	PrivateKey        string    `gorm:"column:private_key;type:text" json:"-"`   // 服务端生成的私钥，加密存储
+	KeyType           string    `gorm:"column:key_type;not null" json:"keyType"` // config: 配置关联, standalone: 独立上传
+	ConfigID          string    `gorm:"column:config_id" json:"configId"`        // 关联的配置ID，独立上传时为空
+	Algorithm         string    `gorm:"column:algorithm" json:"algorithm"`
+	Fingerprint       string    `gorm:"column:fingerprint;index" json:"fingerprint"` // 公钥 SHA256 指纹，用于重复检测
+	Generated         bool      `gorm:"column:generated;default:false" json:"generated"`
+	PrivateDownloaded bool      `gorm:"column:private_downloaded;default:false" json:"privateDownloaded"`
+	CreateTime        time.Time `gorm:"column:create_time;autoCreateTime" json:"createTime"`
 }
 
 func (SSHKey) TableName() string {
@@ -339,13 +726,17 @@ func (SSHKey) TableName() string {
 
 // SSHKeyResponse SSH密钥响应
 type SSHKeyResponse struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	PublicKey  string `json:"publicKey"`
-	KeyType    string `json:"keyType"`
-	ConfigID   string `json:"configId"`
-	ConfigName string `json:"configName"`
-	CreateTime string `json:"createTime"`
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	PublicKey         string `json:"publicKey"`
+	KeyType           string `json:"keyType"`
+	ConfigID          string `json:"configId"`
+	ConfigName        string `json:"configName"`
+	Algorithm         string `json:"algorithm"`
+	Fingerprint       string `json:"fingerprint"`
+	Generated         bool   `json:"generated"`
+	PrivateDownloaded bool   `json:"privateDownloaded"`
+	CreateTime        string `json:"createTime"`
 }
 
 // InstancePreset 实例预设配置
@@ -357,9 +748,15 @@ type InstancePreset struct {
 	Disk            int       `gorm:"column:disk;default:50" json:"disk"`
 	BootVolumeVpu   int64     `gorm:"column:boot_volume_vpu;default:10" json:"bootVolumeVpu"`
 	Architecture    string    `gorm:"column:architecture;default:ARM" json:"architecture"`
+	Shape           string    `gorm:"column:shape" json:"shape"`
 	OperationSystem string    `gorm:"column:operation_system;default:Ubuntu" json:"operationSystem"`
 	ImageID         string    `gorm:"column:image_id" json:"imageId"`
 	SSHKeyID        string    `gorm:"column:ssh_key_id" json:"sshKeyId"`
+	SSHKeyIDs       []string  `gorm:"column:ssh_key_ids;serializer:json" json:"sshKeyIds"` // 额外注入的公钥
+	UserDataID      string    `gorm:"column:user_data_id" json:"userDataId"`
+	EnableRootLogin bool      `gorm:"column:enable_root_login;default:false" json:"enableRootLogin"`
+	RootPassword    string    `gorm:"column:root_password;type:text" json:"-"` // 加密存储，为空时创建实例时随机生成
+	SSHPort         int       `gorm:"column:ssh_port;default:0" json:"sshPort"`
 	Description     string    `gorm:"column:description;type:text" json:"description"`
 	CreateTime      time.Time `gorm:"column:create_time;autoCreateTime" json:"createTime"`
 }
@@ -370,19 +767,85 @@ func (InstancePreset) TableName() string {
 
 // InstancePresetResponse 实例预设配置响应
 type InstancePresetResponse struct {
-	ID              string  `json:"id"`
-	Name            string  `json:"name"`
-	Ocpus           float64 `json:"ocpus"`
-	Memory          float64 `json:"memory"`
-	Disk            int     `json:"disk"`
-	BootVolumeVpu   int64   `json:"bootVolumeVpu"`
-	Architecture    string  `json:"architecture"`
-	OperationSystem string  `json:"operationSystem"`
-	ImageID         string  `json:"imageId"`
-	SSHKeyID        string  `json:"sshKeyId"`
-	SSHKeyName      string  `json:"sshKeyName"`
-	Description     string  `json:"description"`
-	CreateTime      string  `json:"createTime"`
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Ocpus           float64  `json:"ocpus"`
+	Memory          float64  `json:"memory"`
+	Disk            int      `json:"disk"`
+	BootVolumeVpu   int64    `json:"bootVolumeVpu"`
+	Architecture    string   `json:"architecture"`
+	Shape           string   `json:"shape"`
+	OperationSystem string   `json:"operationSystem"`
+	ImageID         string   `json:"imageId"`
+	SSHKeyID        string   `json:"sshKeyId"`
+	SSHKeyName      string   `json:"sshKeyName"`
+	SSHKeyIDs       []string `json:"sshKeyIds"`
+	UserDataID      string   `json:"userDataId"`
+	UserDataName    string   `json:"userDataName"`
+	EnableRootLogin bool     `json:"enableRootLogin"`
+	HasRootPassword bool     `json:"hasRootPassword"`
+	SSHPort         int      `json:"sshPort"`
+	Description     string   `json:"description"`
+	CreateTime      string   `json:"createTime"`
+}
+
+// UserDataTemplate 实例 cloud-init 用户数据模板
+// 内容支持变量 {{hostname}}、{{region}}、{{public_key}}，创建实例时替换
+type UserDataTemplate struct {
+	ID          string    `gorm:"primaryKey;column:id" json:"id"`
+	Name        string    `gorm:"column:name;not null" json:"name"`
+	Content     string    `gorm:"column:content;type:text;not null" json:"content"`
+	Description string    `gorm:"column:description;type:text" json:"description"`
+	CreateTime  time.Time `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+}
+
+func (UserDataTemplate) TableName() string {
+	return "user_data_template"
+}
+
+// InstanceCredential 创建实例时注入的 root 登录凭据
+type InstanceCredential struct {
+	ID           string     `gorm:"primaryKey;column:id" json:"id"`
+	InstanceID   string     `gorm:"column:instance_id;uniqueIndex;not null" json:"instanceId"`
+	InstanceName string     `gorm:"column:instance_name" json:"instanceName"`
+	UserID       string     `gorm:"column:user_id;index" json:"userId"`
+	TaskID       string     `gorm:"column:task_id" json:"taskId"`
+	Region       string     `gorm:"column:region" json:"region"`
+	Username     string     `gorm:"column:username;default:root" json:"username"`
+	Password     string     `gorm:"column:password;type:text" json:"-"` // 加密存储
+	SSHPort      int        `gorm:"column:ssh_port;default:22" json:"sshPort"`
+	Revealed     bool       `gorm:"column:revealed;default:false" json:"revealed"`
+	RevealTime   *time.Time `gorm:"column:reveal_time" json:"revealTime"`
+	CreateTime   time.Time  `gorm:"column:create_time;autoCreateTime" json:"createTime"`
+}
+
+func (InstanceCredential) TableName() string {
+	return "instance_credential"
+}
+
+// SSHSessionAudit Web SSH 终端会话审计
+type SSHSessionAudit struct {
+	ID                 string     `gorm:"primaryKey;column:id" json:"id"`
+	ConfigID           string     `gorm:"column:config_id;index" json:"configId"`
+	InstanceID         string     `gorm:"column:instance_id;index" json:"instanceId"`
+	Host               string     `gorm:"column:host" json:"host"`
+	Port               int        `gorm:"column:port" json:"port"`
+	Username           string     `gorm:"column:username" json:"username"`
+	AuthType           string     `gorm:"column:auth_type" json:"authType"` // key / password
+	KeyID              string     `gorm:"column:key_id" json:"keyId"`
+	Operator           string     `gorm:"column:operator" json:"operator"`
+	ClientIP           string     `gorm:"column:client_ip" json:"clientIp"`
+	HostKeyFingerprint string     `gorm:"column:host_key_fingerprint" json:"hostKeyFingerprint"`
+	Status             string     `gorm:"column:status" json:"status"` // connecting / connected / failed / closed
+	Message            string     `gorm:"column:message;type:text" json:"message"`
+	BytesIn            int64      `gorm:"column:bytes_in" json:"bytesIn"`
+	BytesOut           int64      `gorm:"column:bytes_out" json:"bytesOut"`
+	StartTime          time.Time  `gorm:"column:start_time;index" json:"startTime"`
+	EndTime            *time.Time `gorm:"column:end_time" json:"endTime"`
+}
+
+func (SSHSessionAudit) TableName() string {
+	return "ssh_session_audit"
 }
 
 type ResponseData struct {
@@ -420,7 +883,18 @@ func AutoMigrate(db *gorm.DB) error {
 		&SysSetting{},
 		&OciConfigCache{},
 		&OciImageCache{},
+		&OciSecurityReport{},
+		&OciBudget{},
+		&OciTrafficQuota{},
+		&OciTrafficQuotaLog{},
+		&OciTrafficSample{},
+		&OciIdleAssessment{},
+		&OciOperation{},
+		&OciJob{},
 		&SSHKey{},
 		&InstancePreset{},
+		&UserDataTemplate{},
+		&InstanceCredential{},
+		&SSHSessionAudit{},
 	)
 }
@@ -3,18 +3,28 @@ package router
 import (
 	"github.com/adiecho/oci-panel/internal/config"
 	"github.com/adiecho/oci-panel/internal/controllers"
+	"github.com/adiecho/oci-panel/internal/logger"
 	"github.com/adiecho/oci-panel/internal/middleware"
 	"github.com/adiecho/oci-panel/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
 type Services struct {
-	Scheduler *services.SchedulerService
-	Task      *services.TaskService
-	Telegram  *services.TelegramService
+	Scheduler  *services.SchedulerService
+	Task       *services.TaskService
+	Telegram   *services.TelegramService
+	Health     *services.HealthService
+	Security   *services.SecurityReportService
+	Traffic    *services.TrafficHistoryService
+	IdleGuard  *services.IdleGuardService
+	Jobs       *services.JobService
+	Operations *services.OperationRegistry
 }
 
 func Setup(r *gin.Engine, cfg *config.Config) *Services {
+	r.Use(middleware.RequestID())
+	r.Use(middleware.RequestLogger())
+	r.Use(gin.Recovery())
 	r.Use(middleware.CORS())
 	r.Use(middleware.AuthMiddleware())
 
@@ -32,16 +42,38 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 	ipService := services.NewIpService(ociService)
 	_ = services.NewVolumeService(ociService)
 	wsService := services.NewWebSocketService()
+	logger.SetSink(wsService)
 	schedulerService := services.NewSchedulerService(ociService)
-	taskService := services.NewTaskService(ociService)
 	telegramService := services.NewTelegramService(ociService)
+	taskService := services.NewTaskService(ociService, telegramService)
+	operations := services.NewOperationRegistry()
+	taskService.SetOperationRegistry(operations)
+	healthService := services.NewHealthService(ociService, taskService, telegramService)
+	telegramService.SetHealthService(healthService)
+	securityService := services.NewSecurityReportService(ociService, telegramService)
+	budgetService := services.NewBudgetService(ociService, telegramService)
+	schedulerService.SetBudgetService(budgetService)
+	trafficQuotaService := services.NewTrafficQuotaService(ociService, telegramService)
+	schedulerService.SetTrafficQuotaService(trafficQuotaService)
+	trafficHistoryService := services.NewTrafficHistoryService(ociService)
+	idleGuardService := services.NewIdleGuardService(ociService, telegramService)
+	jobService := services.NewJobService(operations, telegramService, cfg.Jobs.Workers)
+	services.RegisterJobHandlers(jobService, ociService, instanceService)
+	services.RegisterSecurityReportJob(jobService, securityService)
 
-	wsCtrl := controllers.NewWebSocketController(wsService)
+	wsCtrl := controllers.NewWebSocketController(cfg, wsService)
 	r.GET("/ws/logs", wsCtrl.HandleWebSocket)
 
+	// Prometheus 抓取端点在 /api 之外，使用独立的抓取令牌
+	metricsCtrl := controllers.NewMetricsController(cfg)
+	r.GET("/metrics", metricsCtrl.Scrape)
+
+	sshCtrl := controllers.NewSSHController(cfg, services.NewSSHTerminalService(ociService))
+	r.GET("/ws/ssh", sshCtrl.HandleTerminal)
+
 	api := r.Group("/api")
 	{
-		sysCtrl := controllers.NewSysController(cfg, schedulerService)
+		sysCtrl := controllers.NewSysController(cfg, schedulerService, operations)
 		sys := api.Group("/sys")
 		{
 			sys.POST("/login", sysCtrl.Login)
@@ -54,6 +86,8 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 			sys.POST("/generateMfaSecret", sysCtrl.GenerateMfaSecret)
 			sys.POST("/enableMfa", sysCtrl.EnableMfa)
 			sys.POST("/disableMfa", sysCtrl.DisableMfa)
+			sys.POST("/operations", sysCtrl.GetOperations)
+			sys.POST("/clearInterruptedOperations", sysCtrl.ClearInterruptedOperations)
 		}
 
 		passkeyCtrl := controllers.NewPasskeyController(cfg)
@@ -67,11 +101,19 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 			passkey.POST("/disable", passkeyCtrl.Disable)
 		}
 
-		ociCtrl := controllers.NewOciController(ociService, schedulerService)
+		ociCtrl := controllers.NewOciController(ociService, schedulerService, healthService, jobService)
+		securityCtrl := controllers.NewSecurityController(securityService, jobService)
+		budgetCtrl := controllers.NewBudgetController(budgetService)
+		trafficCtrl := controllers.NewTrafficController(trafficQuotaService, trafficHistoryService)
+		idleCtrl := controllers.NewIdleController(idleGuardService)
 		oci := api.Group("/oci")
 		{
 			oci.POST("/userPage", ociCtrl.UserPage)
 			oci.POST("/addCfg", ociCtrl.AddCfg)
+			oci.POST("/importCfg", ociCtrl.ImportCfg)
+			oci.POST("/healthCheck", ociCtrl.HealthCheck)
+			oci.POST("/rotateApiKey", ociCtrl.RotateApiKey)
+			oci.POST("/exportCfg", ociCtrl.ExportCfg)
 			oci.POST("/updateCfgName", ociCtrl.UpdateCfgName)
 			oci.POST("/removeCfg", ociCtrl.RemoveCfg)
 			oci.POST("/createInstance", ociCtrl.CreateInstance)
@@ -82,24 +124,49 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 			oci.POST("/details/volumes", ociCtrl.GetConfigVolumes)
 			oci.POST("/details/vcns", ociCtrl.GetConfigVCNs)
 			oci.POST("/details/clearCache", ociCtrl.ClearConfigCache)
+			oci.POST("/cost", ociCtrl.GetCostUsage)
+			oci.POST("/budget/get", budgetCtrl.GetBudget)
+			oci.POST("/budget/set", budgetCtrl.SetBudget)
+			oci.POST("/budget/delete", budgetCtrl.DeleteBudget)
 			oci.POST("/tenant/info", ociCtrl.GetTenantInfo)
+			oci.POST("/compartments", ociCtrl.ListCompartments)
+			oci.POST("/compartments/setDefault", ociCtrl.SetDefaultCompartment)
+			oci.POST("/regions", ociCtrl.ListRegions)
+			oci.POST("/regions/subscribe", ociCtrl.SubscribeRegion)
 			oci.POST("/tenant/updatePwdEx", ociCtrl.UpdatePasswordExpiry)
 			oci.POST("/tenant/updateUserInfo", ociCtrl.UpdateUserInfo)
 			oci.POST("/tenant/deleteUser", ociCtrl.DeleteUser)
 			oci.POST("/tenant/resetPassword", ociCtrl.ResetPassword)
 			oci.POST("/tenant/deleteMfaDevice", ociCtrl.DeleteMfaDevice)
 			oci.POST("/tenant/deleteApiKey", ociCtrl.DeleteApiKey)
+			oci.POST("/tenant/createUser", ociCtrl.CreateIAMUser)
+			oci.POST("/tenant/groups", ociCtrl.ListIAMGroups)
+			oci.POST("/tenant/createGroup", ociCtrl.CreateIAMGroup)
+			oci.POST("/tenant/addUserToGroup", ociCtrl.AddUserToGroup)
+			oci.POST("/tenant/policies", ociCtrl.ListPolicies)
+			oci.POST("/tenant/previewPolicy", ociCtrl.PreviewPolicy)
+			oci.POST("/tenant/createPolicy", ociCtrl.CreatePolicy)
+			oci.POST("/tenant/updatePolicy", ociCtrl.UpdatePolicy)
+			oci.POST("/tenant/securityReport", securityCtrl.GetSecurityReport)
 			oci.POST("/traffic/data", ociCtrl.GetTrafficData)
 			oci.GET("/traffic/condition", ociCtrl.GetTrafficCondition)
 			oci.GET("/traffic/vnics", ociCtrl.GetInstanceVnics)
+			oci.POST("/traffic/history", trafficCtrl.GetTrafficHistory)
+			oci.POST("/traffic/quota/list", trafficCtrl.ListQuotas)
+			oci.POST("/traffic/quota/set", trafficCtrl.SetQuota)
+			oci.POST("/traffic/quota/delete", trafficCtrl.DeleteQuota)
+			oci.POST("/traffic/quota/check", trafficCtrl.CheckQuota)
+			oci.POST("/traffic/quota/logs", trafficCtrl.GetQuotaLogs)
+			oci.POST("/idle/list", idleCtrl.ListIdleInstances)
 			oci.POST("/vcn/securityList", ociCtrl.GetSecurityList)
 			oci.POST("/vcn/addSecurityRule", ociCtrl.AddSecurityRule)
 			oci.POST("/vcn/releaseSecurityRules", ociCtrl.ReleaseSecurityRules)
 			oci.POST("/vcn/delete", ociCtrl.DeleteVcn)
 			oci.POST("/images", ociCtrl.ListImages)
+			oci.POST("/shapes", ociCtrl.ListShapes)
 		}
 
-		instanceCtrl := controllers.NewInstanceController(instanceService)
+		instanceCtrl := controllers.NewInstanceController(instanceService, jobService)
 		instance := api.Group("/instance")
 		{
 			instance.POST("/list", instanceCtrl.ListInstances)
@@ -117,6 +184,9 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 			instance.POST("/check500MbpsSupport", instanceCtrl.Check500MbpsSupport)
 			instance.POST("/enable500Mbps", instanceCtrl.Enable500Mbps)
 			instance.POST("/disable500Mbps", instanceCtrl.Disable500Mbps)
+			instance.POST("/revealPassword", instanceCtrl.RevealPassword)
+			instance.POST("/metrics", instanceCtrl.GetInstanceMetrics)
+			instance.POST("/bulk", instanceCtrl.BulkAction)
 		}
 
 		bootVolume := api.Group("/bootVolume")
@@ -124,6 +194,15 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 			bootVolume.POST("/update", instanceCtrl.UpdateBootVolumeById)
 		}
 
+		jobCtrl := controllers.NewJobController(jobService)
+		jobs := api.Group("/jobs")
+		{
+			jobs.POST("/list", jobCtrl.ListJobs)
+			jobs.POST("/get", jobCtrl.GetJob)
+			jobs.POST("/cancel", jobCtrl.CancelJob)
+			jobs.POST("/retry", jobCtrl.RetryJob)
+		}
+
 		ipCtrl := controllers.NewIpController(ipService)
 		ip := api.Group("/ip")
 		{
@@ -136,10 +215,12 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 		{
 			key.POST("/list", keyCtrl.ListKeys)
 			key.POST("/create", keyCtrl.CreateKey)
+			key.POST("/generate", keyCtrl.GenerateKey)
 			key.POST("/update", keyCtrl.UpdateKey)
 			key.POST("/delete", keyCtrl.DeleteKey)
 			key.GET("/standalone", keyCtrl.GetAllStandaloneKeys)
 			key.GET("/detail", keyCtrl.GetKeyByID)
+			key.GET("/downloadPrivateKey", keyCtrl.DownloadPrivateKey)
 		}
 
 		taskCtrl := controllers.NewTaskController(taskService)
@@ -165,6 +246,22 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 			preset.GET("/detail", presetCtrl.GetPreset)
 		}
 
+		userDataCtrl := controllers.NewUserDataController()
+		userData := api.Group("/userData")
+		{
+			userData.POST("/create", userDataCtrl.CreateUserData)
+			userData.POST("/update", userDataCtrl.UpdateUserData)
+			userData.POST("/delete", userDataCtrl.DeleteUserData)
+			userData.POST("/preview", userDataCtrl.PreviewUserData)
+			userData.GET("/list", userDataCtrl.ListUserData)
+			userData.GET("/detail", userDataCtrl.GetUserData)
+		}
+
+		ssh := api.Group("/ssh")
+		{
+			ssh.POST("/sessions", sshCtrl.ListSessions)
+		}
+
 		telegramCtrl := controllers.NewTelegramController(telegramService)
 		telegram := api.Group("/telegram")
 		{
@@ -184,8 +281,14 @@ func Setup(r *gin.Engine, cfg *config.Config) *Services {
 	})
 
 	return &Services{
-		Scheduler: schedulerService,
-		Task:      taskService,
-		Telegram:  telegramService,
+		Scheduler:  schedulerService,
+		Task:       taskService,
+		Telegram:   telegramService,
+		Health:     healthService,
+		Security:   securityService,
+		Traffic:    trafficHistoryService,
+		IdleGuard:  idleGuardService,
+		Jobs:       jobService,
+		Operations: operations,
 	}
 }
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+const (
+	// apiKeyBits 轮换生成的 API 密钥长度
+	apiKeyBits = 2048
+	// apiKeyVerifyTimeout 新密钥生效等待时间，上传后通常需要几秒到几十秒才能用于认证
+	apiKeyVerifyTimeout = 90 * time.Second
+	// apiKeyVerifyInterval 新密钥校验重试间隔
+	apiKeyVerifyInterval = 5 * time.Second
+)
+
+// rotatingConfigs 正在轮换密钥的配置，防止同一配置并发轮换
+var rotatingConfigs sync.Map
+
+// ApiKeyRotationResult API 密钥轮换结果
+type ApiKeyRotationResult struct {
+	OldFingerprint string `json:"oldFingerprint"`
+	NewFingerprint string `json:"newFingerprint"`
+	OldKeyDeleted  bool   `json:"oldKeyDeleted"`
+	Warning        string `json:"warning,omitempty"`
+}
+
+// generateAPIKeyPair 生成 RSA 密钥对，返回 PKCS#8 私钥 PEM 和 PKIX 公钥 PEM
+func generateAPIKeyPair() (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, apiKeyBits)
+	if err != nil {
+		return "", "", fmt.Errorf("生成密钥失败: %w", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return string(privatePEM), string(publicPEM), nil
+}
+
+// RotateApiKey 轮换配置的 API 密钥：生成新密钥并上传，确认新密钥可用后更新配置，可选删除旧密钥
+// 新密钥校验或保存失败时删除已上传的新密钥并保持原配置不变
+func (s *OCIService) RotateApiKey(ctx context.Context, configID string, deleteOldKey bool) (*ApiKeyRotationResult, error) {
+	if _, loaded := rotatingConfigs.LoadOrStore(configID, struct{}{}); loaded {
+		return nil, fmt.Errorf("该配置正在轮换密钥")
+	}
+	defer rotatingConfigs.Delete(configID)
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", configID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("配置不存在")
+	}
+
+	// 先确认当前凭据可用，否则无法上传新密钥，也无法回滚
+	oldUser := s.homeRegionUser(ctx, &user)
+	if _, err := s.CheckCredentials(ctx, oldUser); err != nil {
+		return nil, fmt.Errorf("当前凭据不可用，无法轮换密钥: %w", err)
+	}
+	identityClient, err := s.GetIdentityClient(oldUser)
+	if err != nil {
+		return nil, err
+	}
+
+	privatePEM, publicPEM, err := generateAPIKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	uploadResp, err := identityClient.UploadApiKey(ctx, identity.UploadApiKeyRequest{
+		UserId:              &user.OciUserID,
+		CreateApiKeyDetails: identity.CreateApiKeyDetails{Key: &publicPEM},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("上传公钥失败（每个用户最多 3 个 API 密钥）: %w", err)
+	}
+	newFingerprint := stringValue(uploadResp.Fingerprint)
+	if newFingerprint == "" {
+		newFingerprint, _ = APIKeyFingerprint(privatePEM)
+	}
+
+	// rollback 使用旧凭据删除新上传的公钥
+	rollback := func(reason error) error {
+		_, err := identityClient.DeleteApiKey(context.Background(), identity.DeleteApiKeyRequest{
+			UserId:      &user.OciUserID,
+			Fingerprint: &newFingerprint,
+		})
+		if err != nil {
+			slog.Error("Failed to roll back API key", "config", user.Username, "config_id", user.ID, "fingerprint", newFingerprint, "error", err)
+			return fmt.Errorf("%w；回滚失败，请在控制台手动删除指纹为 %s 的密钥", reason, newFingerprint)
+		}
+		return reason
+	}
+
+	keyFile, err := SaveAPIKey(privatePEM)
+	if err != nil {
+		return nil, rollback(err)
+	}
+	keyFilePath := filepath.Join(OCIKeysDir, keyFile)
+
+	newUser := *oldUser
+	newUser.OciFingerprint = newFingerprint
+	newUser.OciKeyPath = keyFile
+	if err := s.waitApiKeyActive(ctx, &newUser); err != nil {
+		os.Remove(keyFilePath)
+		return nil, rollback(fmt.Errorf("新密钥校验失败: %w", err))
+	}
+
+	// 以旧指纹为条件更新，防止与其他修改并发
+	now := time.Now()
+	result := db.Model(&models.OciUser{}).
+		Where("id = ? AND oci_fingerprint = ?", user.ID, user.OciFingerprint).
+		Updates(map[string]interface{}{
+			"oci_fingerprint":   newFingerprint,
+			"oci_key_path":      keyFile,
+			"health_status":     HealthStatusOK,
+			"health_check_time": now,
+			"last_ok_time":      now,
+			"last_error":        "",
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		os.Remove(keyFilePath)
+		return nil, rollback(fmt.Errorf("保存配置失败，配置可能已被修改"))
+	}
+
+	rotation := &ApiKeyRotationResult{
+		OldFingerprint: user.OciFingerprint,
+		NewFingerprint: newFingerprint,
+	}
+	if !deleteOldKey {
+		return rotation, nil
+	}
+
+	// 旧密钥用新凭据删除，失败不影响轮换结果
+	newClient, err := s.GetIdentityClient(&newUser)
+	if err == nil {
+		_, err = newClient.DeleteApiKey(ctx, identity.DeleteApiKeyRequest{
+			UserId:      &user.OciUserID,
+			Fingerprint: &user.OciFingerprint,
+		})
+	}
+	if err != nil {
+		rotation.Warning = fmt.Sprintf("新密钥已生效，但删除旧密钥失败: %v", err)
+		return rotation, nil
+	}
+	rotation.OldKeyDeleted = true
+	if user.OciKeyPath != "" {
+		os.Remove(filepath.Join(OCIKeysDir, user.OciKeyPath))
+	}
+	return rotation, nil
+}
+
+// waitApiKeyActive 轮询直到新密钥可以通过认证
+func (s *OCIService) waitApiKeyActive(ctx context.Context, user *models.OciUser) error {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyVerifyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(apiKeyVerifyInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := s.VerifyCredentials(ctx, user)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+	"github.com/oracle/oci-go-sdk/v65/budget"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"gorm.io/gorm"
+)
+
+// budgetDisplayName 面板同步到 OCI Budgets 的预算名称
+const budgetDisplayName = "oci-panel-monthly"
+
+// budgetThresholds 预算告警阈值（百分比），从低到高
+var budgetThresholds = []int{50, 80, 100}
+
+// Always Free 计算额度，整个租户共享且仅限主区域
+const (
+	freeTierA1Shape     = "VM.Standard.A1.Flex"
+	freeTierA1OCPUs     = 4
+	freeTierA1MemoryGBs = 24
+	freeTierMicroShape  = "VM.Standard.E2.1.Micro"
+	freeTierMicroCount  = 2
+)
+
+// freeTierInstanceIDs 返回主区域中完全处于 Always Free 额度内的运行实例
+// 按创建时间先后占用额度：A1.Flex 合计 4 OCPU / 24 GB，E2.1.Micro 最多 2 台，超出部分按付费实例处理
+func freeTierInstanceIDs(homeInstances []core.Instance) map[string]bool {
+	running := make([]core.Instance, 0, len(homeInstances))
+	for _, inst := range homeInstances {
+		if inst.Id != nil && inst.LifecycleState == core.InstanceLifecycleStateRunning {
+			running = append(running, inst)
+		}
+	}
+	sort.SliceStable(running, func(i, j int) bool {
+		if running[i].TimeCreated == nil || running[j].TimeCreated == nil {
+			return running[j].TimeCreated == nil && running[i].TimeCreated != nil
+		}
+		return running[i].TimeCreated.Before(running[j].TimeCreated.Time)
+	})
+
+	result := map[string]bool{}
+	var ocpus, memory float32
+	micro := 0
+	for _, inst := range running {
+		switch stringValue(inst.Shape) {
+		case freeTierMicroShape:
+			if micro < freeTierMicroCount {
+				micro++
+				result[*inst.Id] = true
+			}
+		case freeTierA1Shape:
+			if inst.ShapeConfig == nil || inst.ShapeConfig.Ocpus == nil || inst.ShapeConfig.MemoryInGBs == nil {
+				continue
+			}
+			if ocpus+*inst.ShapeConfig.Ocpus <= freeTierA1OCPUs && memory+*inst.ShapeConfig.MemoryInGBs <= freeTierA1MemoryGBs {
+				ocpus += *inst.ShapeConfig.Ocpus
+				memory += *inst.ShapeConfig.MemoryInGBs
+				result[*inst.Id] = true
+			}
+		}
+	}
+	return result
+}
+
+func (s *OCIService) GetBudgetClient(user *models.OciUser) (budget.BudgetClient, error) {
+	configProvider, err := s.GetConfigProvider(user)
+	if err != nil {
+		return budget.BudgetClient{}, err
+	}
+
+	client, err := budget.NewBudgetClientWithConfigurationProvider(configProvider)
+	if err != nil {
+		return budget.BudgetClient{}, err
+	}
+	instrumentClient(&client.BaseClient)
+
+	return client, nil
+}
+
+// UpsertOCIBudget 在租户根区间创建或更新月度预算，budgetID 为空或已被删除时重新创建
+func (s *OCIService) UpsertOCIBudget(ctx context.Context, user *models.OciUser, budgetID string, amount float64) (string, error) {
+	homeUser := s.homeRegionUser(ctx, user)
+	client, err := s.GetBudgetClient(homeUser)
+	if err != nil {
+		return "", err
+	}
+
+	value := float32(amount)
+	if budgetID != "" {
+		_, err := client.UpdateBudget(ctx, budget.UpdateBudgetRequest{
+			BudgetId:            &budgetID,
+			UpdateBudgetDetails: budget.UpdateBudgetDetails{Amount: &value},
+		})
+		if err == nil {
+			return budgetID, nil
+		}
+		if classifyHealthError(err) != HealthStatusInvalid {
+			return "", fmt.Errorf("failed to update budget: %w", err)
+		}
+	}
+
+	resp, err := client.CreateBudget(ctx, budget.CreateBudgetRequest{CreateBudgetDetails: budget.CreateBudgetDetails{
+		CompartmentId: &homeUser.OciTenantID,
+		Amount:        &value,
+		ResetPeriod:   budget.ResetPeriodMonthly,
+		TargetType:    budget.TargetTypeCompartment,
+		Targets:       []string{homeUser.OciTenantID},
+		DisplayName:   stringPtr(budgetDisplayName),
+		Description:   stringPtr("Managed by oci-panel"),
+	}})
+	if err != nil {
+		return "", fmt.Errorf("failed to create budget: %w", err)
+	}
+	return stringValue(resp.Id), nil
+}
+
+// DeleteOCIBudget 删除 OCI 上的预算
+func (s *OCIService) DeleteOCIBudget(ctx context.Context, user *models.OciUser, budgetID string) error {
+	client, err := s.GetBudgetClient(s.homeRegionUser(ctx, user))
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteBudget(ctx, budget.DeleteBudgetRequest{BudgetId: &budgetID}); err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+	return nil
+}
+
+// BudgetStatus 预算及本月使用情况
+type BudgetStatus struct {
+	models.OciBudget
+	Spend    float64 `json:"spend"`
+	Percent  float64 `json:"percent"`
+	Currency string  `json:"currency"`
+}
+
+type BudgetService struct {
+	ociService *OCIService
+	telegram   *TelegramService
+	evalLocks  sync.Map // configID -> *sync.Mutex，同一配置的评估串行执行
+}
+
+func NewBudgetService(ociService *OCIService, telegram *TelegramService) *BudgetService {
+	return &BudgetService{
+		ociService: ociService,
+		telegram:   telegram,
+	}
+}
+
+// SetBudget 创建或更新配置的预算，mirror 为 true 时同步到 OCI Budgets，同步失败只记录错误
+func (s *BudgetService) SetBudget(configID string, amount float64, autoStop, mirror bool) (*models.OciBudget, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("预算金额必须大于 0")
+	}
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", configID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("配置不存在")
+	}
+
+	var record models.OciBudget
+	err := db.Where("config_id = ?", configID).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	isNew := err != nil
+	if isNew {
+		record = models.OciBudget{ID: uuid.New().String(), ConfigID: configID}
+	}
+	// 金额调整后重新评估阈值
+	if record.Amount != amount {
+		record.NotifiedPercent = 0
+		record.AutoStopped = false
+	}
+	record.Amount = amount
+	record.AutoStop = autoStop
+	record.Mirror = mirror
+	record.MirrorError = ""
+
+	ctx := context.Background()
+	if mirror {
+		budgetID, err := s.ociService.UpsertOCIBudget(ctx, &user, record.OciBudgetID, amount)
+		if err != nil {
+			record.MirrorError = err.Error()
+		} else {
+			record.OciBudgetID = budgetID
+		}
+	} else if record.OciBudgetID != "" {
+		if err := s.ociService.DeleteOCIBudget(ctx, &user, record.OciBudgetID); err != nil {
+			record.MirrorError = err.Error()
+		} else {
+			record.OciBudgetID = ""
+		}
+	}
+
+	if isNew {
+		err = db.Create(&record).Error
+	} else {
+		err = db.Save(&record).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// GetBudget 获取配置的预算和缓存中的本月费用
+func (s *BudgetService) GetBudget(configID string) (*BudgetStatus, error) {
+	db := database.GetDB()
+	var record models.OciBudget
+	if err := db.Where("config_id = ?", configID).First(&record).Error; err != nil {
+		return nil, err
+	}
+	status := &BudgetStatus{OciBudget: record, Spend: record.LastSpend}
+	if record.Month != CurrentCostPeriod() {
+		status.Spend = 0
+	}
+	var cache models.OciConfigCache
+	if db.Where("config_id = ?", configID).First(&cache).Error == nil {
+		if cost := CachedCost(&cache); cost != nil && cost.Period == CurrentCostPeriod() {
+			status.Spend = cost.MonthToDate
+			status.Currency = cost.Currency
+		}
+	}
+	status.Percent = roundAmount(status.Spend / record.Amount * 100)
+	return status, nil
+}
+
+// DeleteBudget 删除预算，同时删除 OCI 上的镜像预算
+func (s *BudgetService) DeleteBudget(configID string) error {
+	db := database.GetDB()
+	var record models.OciBudget
+	if err := db.Where("config_id = ?", configID).First(&record).Error; err != nil {
+		return err
+	}
+	if record.OciBudgetID != "" {
+		var user models.OciUser
+		if db.Where("id = ?", configID).First(&user).Error == nil {
+			if err := s.ociService.DeleteOCIBudget(context.Background(), &user, record.OciBudgetID); err != nil {
+				slog.Warn("Failed to delete OCI budget", "config", user.Username, "config_id", user.ID, "error", err)
+			}
+		}
+	}
+	return db.Delete(&record).Error
+}
+
+// Evaluate 用最新费用评估预算阈值，由缓存刷新调用
+// 每个阈值每月只通知一次，达到 100% 且开启自动停机时停止非免费实例
+// 费用不属于当前月份时只重置月度状态，不做评估
+func (s *BudgetService) Evaluate(user *models.OciUser, cost *models.CostUsageReport) {
+	if cost == nil {
+		return
+	}
+	lock, _ := s.evalLocks.LoadOrStore(user.ID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	db := database.GetDB()
+	var record models.OciBudget
+	if err := db.Where("config_id = ?", user.ID).First(&record).Error; err != nil || record.Amount <= 0 {
+		return
+	}
+
+	month := CurrentCostPeriod()
+	if record.Month != month {
+		record.Month = month
+		record.NotifiedPercent = 0
+		record.AutoStopped = false
+		record.LastSpend = 0
+	}
+	if cost.Period != month {
+		db.Save(&record)
+		return
+	}
+
+	now := time.Now()
+	record.LastSpend = cost.MonthToDate
+	record.LastEvaluated = &now
+	percent := cost.MonthToDate / record.Amount * 100
+
+	crossed := 0
+	for _, threshold := range budgetThresholds {
+		if percent >= float64(threshold) {
+			crossed = threshold
+		}
+	}
+	if crossed > record.NotifiedPercent {
+		record.NotifiedPercent = crossed
+		s.notify(fmt.Sprintf("💸 预算已使用 %d%%", crossed), fmt.Sprintf("配置：%s\n本月费用：%.2f %s\n预算：%.2f\n预计月底：%.2f",
+			html.EscapeString(user.Username), cost.MonthToDate, cost.Currency, record.Amount, cost.ForecastMonthEnd))
+	}
+
+	if crossed >= 100 && record.AutoStop && !record.AutoStopped {
+		record.AutoStopped = true
+		stopped, errs := s.stopPaidInstances(user)
+		message := fmt.Sprintf("配置：%s\n已停止实例：%d 台", html.EscapeString(user.Username), len(stopped))
+		if len(stopped) > 0 {
+			message += "\n" + html.EscapeString(strings.Join(stopped, "\n"))
+		}
+		if len(errs) > 0 {
+			message += "\n失败：\n" + html.EscapeString(strings.Join(errs, "\n"))
+		}
+		slog.Warn("Budget exceeded, instances stopped", "config", user.Username, "config_id", user.ID, "stopped", len(stopped))
+		s.notify("🛑 预算超限，已自动停止付费实例", message)
+	}
+
+	db.Save(&record)
+}
+
+// stopPaidInstances 停止所有区域中运行的付费实例，主区域内 Always Free 额度覆盖的实例保留
+func (s *BudgetService) stopPaidInstances(user *models.OciUser) ([]string, []string) {
+	ctx := context.Background()
+	compartments, err := s.ociService.ResolveCompartments(ctx, user, user.OciTenantID, true)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	homeRegion := s.ociService.homeRegionUser(ctx, user).OciRegion
+	var errs []string
+	regionInstances := map[string][]core.Instance{}
+	regions := s.ociService.ListSubscribedRegions(ctx, user)
+	for _, region := range regions {
+		regionUser := *user
+		regionUser.OciRegion = region
+		for _, compartmentID := range compartments {
+			instances, err := s.ociService.ListInstances(ctx, &regionUser, compartmentID)
+			if err != nil {
+				// 区域列表不完整时无法判断免费额度，跳过该区域
+				errs = append(errs, fmt.Sprintf("%s: %v", region, err))
+				delete(regionInstances, region)
+				break
+			}
+			regionInstances[region] = append(regionInstances[region], instances...)
+		}
+	}
+	free := freeTierInstanceIDs(regionInstances[homeRegion])
+
+	var stopped []string
+	for _, region := range regions {
+		regionUser := *user
+		regionUser.OciRegion = region
+		for _, instance := range regionInstances[region] {
+			if instance.LifecycleState != core.InstanceLifecycleStateRunning || instance.Id == nil || free[*instance.Id] {
+				continue
+			}
+			label := fmt.Sprintf("%s（%s, %s）", stringValue(instance.DisplayName), stringValue(instance.Shape), region)
+			if err := s.ociService.InstanceAction(ctx, &regionUser, *instance.Id, string(core.InstanceActionActionSoftstop)); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", label, err))
+				continue
+			}
+			stopped = append(stopped, label)
+		}
+	}
+	return stopped, errs
+}
+
+func (s *BudgetService) notify(title, message string) {
+	if s.telegram == nil {
+		return
+	}
+	if err := s.telegram.SendNotification(title, message); err != nil {
+		slog.Warn("Failed to send budget notification", "error", err)
+	}
+}
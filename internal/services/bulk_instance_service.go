@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/logger"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// 批量实例操作
+const (
+	BulkActionStart     = "start"
+	BulkActionStop      = "stop"
+	BulkActionReboot    = "reboot"
+	BulkActionTerminate = "terminate"
+	BulkActionChangeIP  = "changeIP"
+	BulkActionRename    = "rename"
+
+	// BulkDefaultConcurrency 批量操作默认同时处理的实例数
+	BulkDefaultConcurrency = 5
+	// BulkMaxConcurrency 批量操作允许的最大并发数
+	BulkMaxConcurrency = 20
+)
+
+// 批量操作单个实例的结果状态
+const (
+	BulkItemPlanned   = "planned"
+	BulkItemSkipped   = "skipped"
+	BulkItemSucceeded = "succeeded"
+	BulkItemFailed    = "failed"
+)
+
+var ErrEmptySelector = errors.New("请至少指定一个筛选条件")
+
+// BulkInstanceSelector 跨配置选择实例的条件，多个条件同时满足
+type BulkInstanceSelector struct {
+	ConfigIDs   []string `json:"configIds"`   // 为空时选择所有配置
+	InstanceIDs []string `json:"instanceIds"` // 只选择这些实例
+	Shape       string   `json:"shape"`       // 实例规格，支持通配符，如 VM.Standard.A1.*
+	State       string   `json:"state"`       // RUNNING、STOPPED 等，默认排除已终止的实例
+	NamePattern string   `json:"namePattern"` // 实例名称通配符，如 web-*，不区分大小写
+	AllRegions  bool     `json:"allRegions"`  // 查询所有订阅区域，默认只查询配置所在区域
+}
+
+func (sel *BulkInstanceSelector) isEmpty() bool {
+	return len(sel.ConfigIDs) == 0 && len(sel.InstanceIDs) == 0 && sel.Shape == "" && sel.State == "" && sel.NamePattern == ""
+}
+
+// BulkInstanceTarget 选中的实例
+type BulkInstanceTarget struct {
+	ConfigID    string `json:"configId"`
+	ConfigName  string `json:"configName"`
+	Region      string `json:"region"`
+	InstanceID  string `json:"instanceId"`
+	DisplayName string `json:"displayName"`
+	Shape       string `json:"shape"`
+	State       string `json:"state"`
+}
+
+// BulkItemResult 单个实例的执行计划或结果
+type BulkItemResult struct {
+	BulkInstanceTarget
+	Status  string `json:"status"` // planned, skipped, succeeded, failed
+	Message string `json:"message,omitempty"`
+	NewName string `json:"newName,omitempty"`
+	NewIP   string `json:"newIp,omitempty"`
+}
+
+// BulkActionResult 批量操作的预览或执行结果
+type BulkActionResult struct {
+	Action    string           `json:"action"`
+	DryRun    bool             `json:"dryRun"`
+	Total     int              `json:"total"`
+	Planned   int              `json:"planned"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Skipped   int              `json:"skipped"`
+	Items     []BulkItemResult `json:"items"`
+	Errors    []string         `json:"errors,omitempty"` // 查询失败的配置或区域
+}
+
+// BulkActionParams 批量操作任务参数，执行时只处理计划中状态为 planned 的实例
+type BulkActionParams struct {
+	Action      string           `json:"action"`
+	Concurrency int              `json:"concurrency"`
+	Items       []BulkItemResult `json:"items"`
+	Errors      []string         `json:"errors,omitempty"`
+}
+
+// IsBulkAction 是否为支持的批量操作
+func IsBulkAction(action string) bool {
+	switch action {
+	case BulkActionStart, BulkActionStop, BulkActionReboot, BulkActionTerminate, BulkActionChangeIP, BulkActionRename:
+		return true
+	}
+	return false
+}
+
+// SelectInstances 按条件跨配置、跨区域查询实例，返回选中的实例和查询失败的配置或区域
+func (s *InstanceService) SelectInstances(ctx context.Context, sel BulkInstanceSelector) ([]BulkInstanceTarget, []string, error) {
+	if sel.isEmpty() {
+		return nil, nil, ErrEmptySelector
+	}
+	shapePattern := strings.ToLower(sel.Shape)
+	namePattern := strings.ToLower(sel.NamePattern)
+	for _, p := range []string{shapePattern, namePattern} {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, nil, fmt.Errorf("通配符格式错误: %s", p)
+		}
+	}
+	instanceIDs := make(map[string]bool, len(sel.InstanceIDs))
+	for _, id := range sel.InstanceIDs {
+		instanceIDs[id] = true
+	}
+
+	var users []models.OciUser
+	query := database.GetDB()
+	if len(sel.ConfigIDs) > 0 {
+		query = query.Where("id IN ?", sel.ConfigIDs)
+	}
+	if err := query.Order("create_time").Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+
+	matches := func(inst core.Instance) bool {
+		state := string(inst.LifecycleState)
+		switch {
+		case inst.Id == nil:
+			return false
+		case len(instanceIDs) > 0 && !instanceIDs[*inst.Id]:
+			return false
+		case sel.State != "" && !strings.EqualFold(state, sel.State):
+			return false
+		case sel.State == "" && inst.LifecycleState == core.InstanceLifecycleStateTerminated:
+			return false
+		}
+		if shapePattern != "" {
+			if ok, _ := path.Match(shapePattern, strings.ToLower(stringValue(inst.Shape))); !ok {
+				return false
+			}
+		}
+		if namePattern != "" {
+			if ok, _ := path.Match(namePattern, strings.ToLower(stringValue(inst.DisplayName))); !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	var (
+		mu      sync.Mutex
+		targets []BulkInstanceTarget
+		errs    []string
+		wg      sync.WaitGroup
+	)
+	semaphore := make(chan struct{}, regionConcurrency)
+	for i := range users {
+		user := &users[i]
+		regions := []string{user.OciRegion}
+		if sel.AllRegions {
+			regions = s.ociService.ListSubscribedRegions(ctx, user)
+		}
+		for _, region := range regions {
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(region string) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+
+				regionUser := *user
+				regionUser.OciRegion = region
+				compartments, err := s.ociService.ResolveCompartments(ctx, &regionUser, "", true)
+				var found []BulkInstanceTarget
+				for _, compartmentID := range compartments {
+					if err != nil {
+						break
+					}
+					var instances []core.Instance
+					if instances, err = s.ociService.ListInstances(ctx, &regionUser, compartmentID); err != nil {
+						break
+					}
+					for _, inst := range instances {
+						if !matches(inst) {
+							continue
+						}
+						found = append(found, BulkInstanceTarget{
+							ConfigID:    user.ID,
+							ConfigName:  user.Username,
+							Region:      region,
+							InstanceID:  *inst.Id,
+							DisplayName: stringValue(inst.DisplayName),
+							Shape:       stringValue(inst.Shape),
+							State:       string(inst.LifecycleState),
+						})
+					}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s/%s: %v", user.Username, region, err))
+					return
+				}
+				targets = append(targets, found...)
+			}(region)
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i], targets[j]
+		if a.ConfigName != b.ConfigName {
+			return a.ConfigName < b.ConfigName
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.DisplayName < b.DisplayName
+	})
+	sort.Strings(errs)
+	return targets, errs, nil
+}
+
+// PlanBulkAction 生成批量操作计划，状态不适用的实例标记为跳过
+// newName 为重命名模板，支持 {name}、{index}（从 1 开始）、{config}、{region}、{shape}
+func PlanBulkAction(action, newName string, targets []BulkInstanceTarget) *BulkActionResult {
+	result := &BulkActionResult{Action: action, DryRun: true, Items: make([]BulkItemResult, 0, len(targets))}
+	for i, target := range targets {
+		item := BulkItemResult{BulkInstanceTarget: target, Status: BulkItemPlanned}
+		state := core.InstanceLifecycleStateEnum(target.State)
+		switch action {
+		case BulkActionStart:
+			if state != core.InstanceLifecycleStateStopped {
+				item.Status, item.Message = BulkItemSkipped, "实例未处于已停止状态"
+			}
+		case BulkActionStop, BulkActionReboot:
+			if state != core.InstanceLifecycleStateRunning {
+				item.Status, item.Message = BulkItemSkipped, "实例未处于运行状态"
+			}
+		case BulkActionTerminate:
+			if state == core.InstanceLifecycleStateTerminating || state == core.InstanceLifecycleStateTerminated {
+				item.Status, item.Message = BulkItemSkipped, "实例已终止"
+			}
+		case BulkActionChangeIP:
+			if state != core.InstanceLifecycleStateRunning && state != core.InstanceLifecycleStateStopped {
+				item.Status, item.Message = BulkItemSkipped, "实例状态为 "+target.State+"，无法更换 IP"
+			}
+		case BulkActionRename:
+			item.NewName = strings.NewReplacer(
+				"{name}", target.DisplayName,
+				"{index}", strconv.Itoa(i+1),
+				"{config}", target.ConfigName,
+				"{region}", target.Region,
+				"{shape}", target.Shape,
+			).Replace(newName)
+			if item.NewName == target.DisplayName {
+				item.Status, item.Message = BulkItemSkipped, "名称未变化"
+			}
+		}
+		result.Items = append(result.Items, item)
+	}
+	result.count()
+	return result
+}
+
+func (r *BulkActionResult) count() {
+	r.Total = len(r.Items)
+	r.Planned, r.Succeeded, r.Failed, r.Skipped = 0, 0, 0, 0
+	for _, item := range r.Items {
+		switch item.Status {
+		case BulkItemPlanned:
+			r.Planned++
+		case BulkItemSucceeded:
+			r.Succeeded++
+		case BulkItemFailed:
+			r.Failed++
+		case BulkItemSkipped:
+			r.Skipped++
+		}
+	}
+}
+
+// ExecuteBulkAction 按计划并发执行批量操作，progress 在每个实例完成后回调
+// ctx 取消后尚未开始的实例标记为失败
+func (s *InstanceService) ExecuteBulkAction(ctx context.Context, params BulkActionParams, progress func(done, total int)) *BulkActionResult {
+	concurrency := params.Concurrency
+	if concurrency <= 0 {
+		concurrency = BulkDefaultConcurrency
+	}
+	if concurrency > BulkMaxConcurrency {
+		concurrency = BulkMaxConcurrency
+	}
+
+	result := &BulkActionResult{Action: params.Action, Items: params.Items, Errors: params.Errors}
+	users := map[string]*models.OciUser{}
+	var pending []int
+	for i, item := range result.Items {
+		if item.Status != BulkItemPlanned {
+			continue
+		}
+		pending = append(pending, i)
+		if _, ok := users[item.ConfigID]; !ok {
+			var user models.OciUser
+			if err := database.GetDB().Where("id = ?", item.ConfigID).First(&user).Error; err == nil {
+				users[item.ConfigID] = &user
+			} else {
+				users[item.ConfigID] = nil
+			}
+		}
+	}
+
+	var (
+		mu   sync.Mutex
+		done int
+		wg   sync.WaitGroup
+	)
+	semaphore := make(chan struct{}, concurrency)
+	for _, idx := range pending {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(item *BulkItemResult) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			var err error
+			if user := users[item.ConfigID]; user == nil {
+				err = errors.New("配置不存在")
+			} else if err = ctx.Err(); err == nil {
+				regionUser := *user
+				regionUser.OciRegion = item.Region
+				itemCtx := logger.With(ctx, "config_id", item.ConfigID, "instance_id", item.InstanceID)
+				item.NewIP, err = s.runBulkItem(itemCtx, &regionUser, params.Action, item)
+				if err != nil {
+					slog.WarnContext(itemCtx, "Bulk instance action failed", "action", params.Action, "error", err)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				item.Status, item.Message = BulkItemFailed, err.Error()
+			} else {
+				item.Status = BulkItemSucceeded
+			}
+			done++
+			if progress != nil {
+				progress(done, len(pending))
+			}
+		}(&result.Items[idx])
+	}
+	wg.Wait()
+
+	result.count()
+	return result
+}
+
+func (s *InstanceService) runBulkItem(ctx context.Context, user *models.OciUser, action string, item *BulkItemResult) (string, error) {
+	switch action {
+	case BulkActionStart:
+		return "", s.ociService.InstanceAction(ctx, user, item.InstanceID, "START")
+	case BulkActionStop:
+		return "", s.ociService.InstanceAction(ctx, user, item.InstanceID, "STOP")
+	case BulkActionReboot:
+		return "", s.ociService.InstanceAction(ctx, user, item.InstanceID, "RESET")
+	case BulkActionTerminate:
+		return "", s.ociService.TerminateInstance(ctx, user, item.InstanceID)
+	case BulkActionChangeIP:
+		return s.changePublicIP(ctx, user, item.InstanceID)
+	case BulkActionRename:
+		return "", s.ociService.UpdateInstance(ctx, user, item.InstanceID, item.NewName)
+	}
+	return "", fmt.Errorf("不支持的操作: %s", action)
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+// listAllCompartments 获取租户下所有可访问的活动区间（不含根区间）
+// compartmentIdInSubtree 只能在根区间上使用，因此始终从租户根开始查询
+func (s *OCIService) listAllCompartments(ctx context.Context, user *models.OciUser) ([]identity.Compartment, error) {
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var compartments []identity.Compartment
+	req := identity.ListCompartmentsRequest{
+		CompartmentId:          &user.OciTenantID,
+		CompartmentIdInSubtree: common.Bool(true),
+		AccessLevel:            identity.ListCompartmentsAccessLevelAccessible,
+		LifecycleState:         identity.CompartmentLifecycleStateActive,
+	}
+	for {
+		resp, err := identityClient.ListCompartments(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("获取区间列表失败: %w", err)
+		}
+		compartments = append(compartments, resp.Items...)
+		if resp.OpcNextPage == nil {
+			break
+		}
+		req.Page = resp.OpcNextPage
+	}
+	return compartments, nil
+}
+
+// ListCompartmentTree 获取以租户根区间为根的区间树
+func (s *OCIService) ListCompartmentTree(ctx context.Context, user *models.OciUser) (*models.CompartmentInfo, error) {
+	compartments, err := s.listAllCompartments(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	rootName := user.TenantName
+	if rootName == "" {
+		rootName = "root"
+	}
+	root := &models.CompartmentInfo{
+		ID:       user.OciTenantID,
+		Name:     rootName + " (root)",
+		State:    string(identity.CompartmentLifecycleStateActive),
+		Children: []models.CompartmentInfo{},
+	}
+
+	children := make(map[string][]identity.Compartment)
+	for _, c := range compartments {
+		if c.Id == nil || c.CompartmentId == nil {
+			continue
+		}
+		children[*c.CompartmentId] = append(children[*c.CompartmentId], c)
+	}
+
+	var build func(node *models.CompartmentInfo)
+	build = func(node *models.CompartmentInfo) {
+		items := children[node.ID]
+		sort.Slice(items, func(i, j int) bool {
+			return stringValue(items[i].Name) < stringValue(items[j].Name)
+		})
+		for _, c := range items {
+			child := models.CompartmentInfo{
+				ID:          *c.Id,
+				Name:        stringValue(c.Name),
+				Description: stringValue(c.Description),
+				ParentID:    node.ID,
+				State:       string(c.LifecycleState),
+				Children:    []models.CompartmentInfo{},
+			}
+			build(&child)
+			node.Children = append(node.Children, child)
+		}
+	}
+	build(root)
+
+	return root, nil
+}
+
+// ResolveCompartments 返回要查询的区间列表，recursive 为 true 时包含所有子区间
+func (s *OCIService) ResolveCompartments(ctx context.Context, user *models.OciUser, compartmentID string, recursive bool) ([]string, error) {
+	if compartmentID == "" {
+		compartmentID = user.ResourceCompartmentID()
+	}
+	if !recursive {
+		return []string{compartmentID}, nil
+	}
+
+	compartments, err := s.listAllCompartments(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]string)
+	for _, c := range compartments {
+		if c.Id != nil && c.CompartmentId != nil {
+			children[*c.CompartmentId] = append(children[*c.CompartmentId], *c.Id)
+		}
+	}
+
+	result := []string{compartmentID}
+	for i := 0; i < len(result); i++ {
+		result = append(result, children[result[i]]...)
+	}
+	return result, nil
+}
+
+// stringValue 安全解引用字符串指针
+func stringValue(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
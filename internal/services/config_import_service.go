@@ -0,0 +1,385 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+// OCIKeysDir API 私钥保存目录
+const OCIKeysDir = "./keys"
+
+// OCIProfile OCI CLI 配置文件中的一个 profile
+type OCIProfile struct {
+	Name        string
+	User        string
+	Fingerprint string
+	Tenancy     string
+	Region      string
+	KeyFile     string
+	PassPhrase  string
+}
+
+// ProfileImportResult 单个 profile 的导入结果
+type ProfileImportResult struct {
+	Profile  string `json:"profile"`
+	Success  bool   `json:"success"`
+	ConfigID string `json:"configId,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ParseOCIConfig 解析 INI 格式的 OCI CLI 配置，其他 profile 继承 DEFAULT 中的值
+func ParseOCIConfig(content string) ([]OCIProfile, error) {
+	sections := make(map[string]map[string]string)
+	var order []string
+	var current map[string]string
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, fmt.Errorf("第 %d 行: profile 名称为空", lineNo)
+			}
+			if _, ok := sections[name]; !ok {
+				sections[name] = make(map[string]string)
+				order = append(order, name)
+			}
+			current = sections[name]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("第 %d 行: 无法解析 %q", lineNo, line)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("第 %d 行: 配置项不在任何 profile 中", lineNo)
+		}
+		current[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	defaults := sections["DEFAULT"]
+	var profiles []OCIProfile
+	for _, name := range order {
+		values := sections[name]
+		get := func(key string) string {
+			if v, ok := values[key]; ok {
+				return v
+			}
+			return defaults[key]
+		}
+		profile := OCIProfile{
+			Name:        name,
+			User:        get("user"),
+			Fingerprint: get("fingerprint"),
+			Tenancy:     get("tenancy"),
+			Region:      get("region"),
+			KeyFile:     get("key_file"),
+			PassPhrase:  get("pass_phrase"),
+		}
+		// DEFAULT 只提供公共配置项时不算一个 profile
+		if name == "DEFAULT" && profile.User == "" {
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("配置文件中没有 profile")
+	}
+	return profiles, nil
+}
+
+// Validate 检查 profile 必填项
+func (p OCIProfile) Validate() error {
+	var missing []string
+	for _, field := range []struct{ name, value string }{
+		{"user", p.User},
+		{"fingerprint", p.Fingerprint},
+		{"tenancy", p.Tenancy},
+		{"region", p.Region},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少配置项: %s", strings.Join(missing, ", "))
+	}
+	if p.PassPhrase != "" {
+		return fmt.Errorf("暂不支持带密码的私钥")
+	}
+	return nil
+}
+
+// findProfileKey 按 key_file 完整路径、文件名或 profile 名称查找上传的私钥
+func findProfileKey(profile OCIProfile, keys map[string]string) (string, bool) {
+	if profile.KeyFile != "" {
+		if key, ok := keys[profile.KeyFile]; ok {
+			return key, true
+		}
+		// key_file 可能是 Windows 路径
+		base := path.Base(strings.ReplaceAll(profile.KeyFile, "\\", "/"))
+		if key, ok := keys[base]; ok {
+			return key, true
+		}
+	}
+	key, ok := keys[profile.Name]
+	return key, ok
+}
+
+// APIKeyFingerprint 计算 API 私钥对应公钥的指纹（OCI 格式：公钥 DER 的 MD5）
+func APIKeyFingerprint(privateKeyPEM string) (string, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return "", fmt.Errorf("私钥格式无效，需要 PEM 格式")
+	}
+	if strings.Contains(block.Type, "ENCRYPTED") || block.Headers["Proc-Type"] != "" {
+		return "", fmt.Errorf("暂不支持带密码的私钥")
+	}
+
+	var publicKey *rsa.PublicKey
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		publicKey = &key.PublicKey
+	} else if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("OCI API 密钥必须为 RSA 私钥")
+		}
+		publicKey = &rsaKey.PublicKey
+	} else {
+		return "", fmt.Errorf("解析私钥失败: %w", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// SaveAPIKey 将私钥保存到 keys 目录，返回相对文件名
+func SaveAPIKey(privateKeyPEM string) (string, error) {
+	if err := os.MkdirAll(OCIKeysDir, 0755); err != nil {
+		return "", fmt.Errorf("创建密钥目录失败: %w", err)
+	}
+	filename := uuid.New().String() + ".pem"
+	if err := os.WriteFile(filepath.Join(OCIKeysDir, filename), []byte(privateKeyPEM), 0600); err != nil {
+		return "", fmt.Errorf("保存私钥失败: %w", err)
+	}
+	return filename, nil
+}
+
+// VerifyCredentials 通过身份服务实时校验 API 凭据，返回租户名称和创建时间
+func (s *OCIService) VerifyCredentials(ctx context.Context, user *models.OciUser) (*models.TenantInfo, error) {
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := identityClient.GetUser(ctx, identity.GetUserRequest{UserId: &user.OciUserID}); err != nil {
+		return nil, fmt.Errorf("凭据校验失败: %w", err)
+	}
+	tenancy, err := identityClient.GetTenancy(ctx, identity.GetTenancyRequest{TenancyId: &user.OciTenantID})
+	if err != nil {
+		return nil, fmt.Errorf("获取租户信息失败: %w", err)
+	}
+
+	info := &models.TenantInfo{ID: user.OciTenantID}
+	if tenancy.Name != nil {
+		info.Name = *tenancy.Name
+	}
+	compartment, err := identityClient.GetCompartment(ctx, identity.GetCompartmentRequest{CompartmentId: &user.OciTenantID})
+	if err == nil && compartment.TimeCreated != nil {
+		info.CreateTime = compartment.TimeCreated.Format("2006-01-02 15:04:05")
+	}
+	return info, nil
+}
+
+// ImportOCIConfig 导入 OCI CLI 配置中的 profile，keys 为 key_file 路径/文件名/profile 名称到私钥内容的映射
+// onlyProfiles 非空时只导入指定的 profile
+func (s *OCIService) ImportOCIConfig(ctx context.Context, content string, keys map[string]string, onlyProfiles []string) ([]ProfileImportResult, error) {
+	profiles, err := ParseOCIConfig(content)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(onlyProfiles))
+	for _, name := range onlyProfiles {
+		selected[name] = true
+	}
+
+	results := make([]ProfileImportResult, 0, len(profiles))
+	for _, profile := range profiles {
+		if len(selected) > 0 && !selected[profile.Name] {
+			continue
+		}
+		result := ProfileImportResult{Profile: profile.Name}
+		user, err := s.importProfile(ctx, profile, keys)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			result.ConfigID = user.ID
+			result.Tenant = user.TenantName
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *OCIService) importProfile(ctx context.Context, profile OCIProfile, keys map[string]string) (*models.OciUser, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := findProfileKey(profile, keys)
+	if !ok {
+		return nil, fmt.Errorf("未找到私钥文件: %s", profile.KeyFile)
+	}
+	fingerprint, err := APIKeyFingerprint(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(fingerprint, profile.Fingerprint) {
+		return nil, fmt.Errorf("私钥与指纹不匹配（私钥指纹 %s）", fingerprint)
+	}
+
+	db := database.GetDB()
+	var count int64
+	db.Model(&models.OciUser{}).
+		Where("oci_tenant_id = ? AND oci_user_id = ? AND oci_fingerprint = ? AND oci_region = ?",
+			profile.Tenancy, profile.User, profile.Fingerprint, profile.Region).
+		Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("配置已存在")
+	}
+
+	keyFile, err := SaveAPIKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.OciUser{
+		ID:             uuid.New().String(),
+		Username:       profile.Name,
+		OciTenantID:    profile.Tenancy,
+		OciUserID:      profile.User,
+		OciFingerprint: profile.Fingerprint,
+		OciRegion:      profile.Region,
+		OciKeyPath:     keyFile,
+		CreateTime:     time.Now(),
+	}
+
+	tenantInfo, err := s.VerifyCredentials(ctx, user)
+	if err != nil {
+		os.Remove(filepath.Join(OCIKeysDir, keyFile))
+		return nil, err
+	}
+	user.TenantName = tenantInfo.Name
+	user.HealthStatus = HealthStatusOK
+	user.HealthCheckTime = &user.CreateTime
+	user.LastOkTime = &user.CreateTime
+	if parsedTime, err := time.Parse("2006-01-02 15:04:05", tenantInfo.CreateTime); err == nil {
+		user.TenantCreateTime = &parsedTime
+	}
+
+	if err := db.Create(user).Error; err != nil {
+		os.Remove(filepath.Join(OCIKeysDir, keyFile))
+		return nil, fmt.Errorf("保存配置失败: %w", err)
+	}
+	return user, nil
+}
+
+var profileNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ExportOCIConfig 将配置导出为 zip：config 为 OCI CLI 配置文件，includeKeys 时附带 keys/<profile>.pem
+func ExportOCIConfig(users []models.OciUser, includeKeys bool) ([]byte, error) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	var config strings.Builder
+	used := make(map[string]int)
+	for _, user := range users {
+		name := profileNameSanitizer.ReplaceAllString(user.Username, "_")
+		if name == "" {
+			name = "profile"
+		}
+		// profile 名称必须唯一
+		if n := used[name]; n > 0 {
+			used[name] = n + 1
+			name = fmt.Sprintf("%s_%d", name, n+1)
+		} else {
+			used[name] = 1
+		}
+
+		keyName := name + ".pem"
+		fmt.Fprintf(&config, "[%s]\n", name)
+		fmt.Fprintf(&config, "user=%s\n", user.OciUserID)
+		fmt.Fprintf(&config, "fingerprint=%s\n", user.OciFingerprint)
+		fmt.Fprintf(&config, "tenancy=%s\n", user.OciTenantID)
+		fmt.Fprintf(&config, "region=%s\n", user.OciRegion)
+		fmt.Fprintf(&config, "key_file=~/.oci/keys/%s\n\n", keyName)
+
+		if !includeKeys {
+			continue
+		}
+		key, err := os.ReadFile(filepath.Join(OCIKeysDir, user.OciKeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 的私钥失败: %w", user.Username, err)
+		}
+		w, err := archive.Create("keys/" + keyName)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(key); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := archive.Create("config")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte(config.String())); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/tenantmanagercontrolplane"
+	"github.com/oracle/oci-go-sdk/v65/usageapi"
+)
+
+// CostRefreshInterval 费用数据刷新间隔，Usage API 数据本身有数小时延迟，无需随资源缓存频繁刷新
+const CostRefreshInterval = 6 * time.Hour
+
+func (s *OCIService) GetUsageapiClient(user *models.OciUser) (usageapi.UsageapiClient, error) {
+	configProvider, err := s.GetConfigProvider(user)
+	if err != nil {
+		return usageapi.UsageapiClient{}, err
+	}
+
+	client, err := usageapi.NewUsageapiClientWithConfigurationProvider(configProvider)
+	if err != nil {
+		return usageapi.UsageapiClient{}, err
+	}
+	instrumentClient(&client.BaseClient)
+
+	return client, nil
+}
+
+func (s *OCIService) GetSubscriptionClient(user *models.OciUser) (tenantmanagercontrolplane.SubscriptionClient, error) {
+	configProvider, err := s.GetConfigProvider(user)
+	if err != nil {
+		return tenantmanagercontrolplane.SubscriptionClient{}, err
+	}
+
+	client, err := tenantmanagercontrolplane.NewSubscriptionClientWithConfigurationProvider(configProvider)
+	if err != nil {
+		return tenantmanagercontrolplane.SubscriptionClient{}, err
+	}
+	instrumentClient(&client.BaseClient)
+
+	return client, nil
+}
+
+// CurrentCostPeriod 当前费用统计月份，Usage API 按 UTC 划分月份
+func CurrentCostPeriod() string {
+	return time.Now().UTC().Format("2006-01")
+}
+
+func roundAmount(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// GetCostUsage 查询本月费用：按服务、按天汇总，月底预测，以及试用额度剩余
+// 试用额度查询失败不影响费用结果
+func (s *OCIService) GetCostUsage(ctx context.Context, user *models.OciUser) (*models.CostUsageReport, error) {
+	// Usage API 只能在主区域调用
+	homeUser := s.homeRegionUser(ctx, user)
+	client, err := s.GetUsageapiClient(homeUser)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := monthStart.AddDate(0, 1, 0)
+
+	items, err := s.summarizeCost(ctx, client, user.OciTenantID, monthStart, tomorrow, []string{"service"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+
+	report := &models.CostUsageReport{
+		Period:     monthStart.Format("2006-01"),
+		ByService:  []models.CostItem{},
+		ByDay:      []models.CostItem{},
+		UpdateTime: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	byService := map[string]float64{}
+	byDay := map[string]float64{}
+	for _, item := range items {
+		amount := float64(0)
+		if item.ComputedAmount != nil {
+			amount = float64(*item.ComputedAmount)
+		}
+		if report.Currency == "" && item.Currency != nil {
+			report.Currency = *item.Currency
+		}
+		service := stringValue(item.Service)
+		if service == "" {
+			service = "Other"
+		}
+		byService[service] += amount
+		if item.TimeUsageStarted != nil {
+			byDay[item.TimeUsageStarted.Format("2006-01-02")] += amount
+		}
+		report.MonthToDate += amount
+	}
+	for name, amount := range byService {
+		report.ByService = append(report.ByService, models.CostItem{Name: name, Amount: roundAmount(amount)})
+	}
+	sort.Slice(report.ByService, func(i, j int) bool { return report.ByService[i].Amount > report.ByService[j].Amount })
+	for day, amount := range byDay {
+		report.ByDay = append(report.ByDay, models.CostItem{Name: day, Amount: roundAmount(amount)})
+	}
+	sort.Slice(report.ByDay, func(i, j int) bool { return report.ByDay[i].Name < report.ByDay[j].Name })
+	report.MonthToDate = roundAmount(report.MonthToDate)
+
+	// 月底预测：已发生费用加上剩余天数的预测值，当天为月末时无需预测
+	report.ForecastMonthEnd = report.MonthToDate
+	if tomorrow.Before(nextMonth) {
+		forecast := &usageapi.Forecast{
+			ForecastType:        usageapi.ForecastForecastTypeBasic,
+			TimeForecastStarted: &common.SDKTime{Time: tomorrow},
+			TimeForecastEnded:   &common.SDKTime{Time: nextMonth},
+		}
+		forecastItems, err := s.summarizeCost(ctx, client, user.OciTenantID, monthStart, tomorrow, nil, forecast)
+		if err == nil {
+			predicted := float64(0)
+			for _, item := range forecastItems {
+				if item.IsForecast != nil && *item.IsForecast && item.ComputedAmount != nil {
+					predicted += float64(*item.ComputedAmount)
+				}
+			}
+			report.ForecastMonthEnd = roundAmount(report.MonthToDate + predicted)
+		}
+	}
+
+	s.fillTrialCredit(ctx, homeUser, client, report)
+	return report, nil
+}
+
+// summarizeCost 按天查询费用，自动翻页
+func (s *OCIService) summarizeCost(ctx context.Context, client usageapi.UsageapiClient, tenancyID string, start, end time.Time, groupBy []string, forecast *usageapi.Forecast) ([]usageapi.UsageSummary, error) {
+	req := usageapi.RequestSummarizedUsagesRequest{
+		RequestSummarizedUsagesDetails: usageapi.RequestSummarizedUsagesDetails{
+			TenantId:         &tenancyID,
+			TimeUsageStarted: &common.SDKTime{Time: start},
+			TimeUsageEnded:   &common.SDKTime{Time: end},
+			Granularity:      usageapi.RequestSummarizedUsagesDetailsGranularityDaily,
+			QueryType:        usageapi.RequestSummarizedUsagesDetailsQueryTypeCost,
+			GroupBy:          groupBy,
+			Forecast:         forecast,
+		},
+	}
+
+	var items []usageapi.UsageSummary
+	for {
+		resp, err := client.RequestSummarizedUsages(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, resp.Items...)
+		if resp.OpcNextPage == nil {
+			return items, nil
+		}
+		req.Page = resp.OpcNextPage
+	}
+}
+
+// fillTrialCredit 从订阅的促销信息中获取试用额度，并用促销开始以来的费用估算剩余额度
+func (s *OCIService) fillTrialCredit(ctx context.Context, user *models.OciUser, usageClient usageapi.UsageapiClient, report *models.CostUsageReport) {
+	client, err := s.GetSubscriptionClient(user)
+	if err != nil {
+		return
+	}
+	resp, err := client.ListSubscriptions(ctx, tenantmanagercontrolplane.ListSubscriptionsRequest{CompartmentId: &user.OciTenantID})
+	if err != nil {
+		return
+	}
+
+	for _, summary := range resp.Items {
+		if _, ok := summary.(tenantmanagercontrolplane.ClassicSubscriptionSummary); !ok {
+			continue
+		}
+		subResp, err := client.GetSubscription(ctx, tenantmanagercontrolplane.GetSubscriptionRequest{SubscriptionId: summary.GetId()})
+		if err != nil {
+			continue
+		}
+		subscription, ok := subResp.Subscription.(tenantmanagercontrolplane.ClassicSubscription)
+		if !ok {
+			continue
+		}
+		if report.PaymentModel == "" {
+			report.PaymentModel = stringValue(subscription.PaymentModel)
+		}
+
+		for _, promotion := range subscription.Promotion {
+			if promotion.Status != tenantmanagercontrolplane.PromotionStatusActive || promotion.Amount == nil {
+				continue
+			}
+			credit := &models.TrialCreditInfo{
+				Amount:   roundAmount(float64(*promotion.Amount)),
+				Currency: stringValue(promotion.CurrencyUnit),
+				Status:   string(promotion.Status),
+			}
+			if promotion.TimeExpired != nil {
+				credit.ExpireTime = promotion.TimeExpired.Format("2006-01-02 15:04:05")
+			}
+			if promotion.TimeStarted != nil {
+				start := promotion.TimeStarted.UTC()
+				start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+				now := time.Now().UTC()
+				end := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+				if items, err := s.summarizeCost(ctx, usageClient, user.OciTenantID, start, end, nil, nil); err == nil {
+					for _, item := range items {
+						if item.ComputedAmount != nil {
+							credit.Used += float64(*item.ComputedAmount)
+						}
+					}
+				}
+			}
+			credit.Used = roundAmount(credit.Used)
+			credit.Remaining = roundAmount(math.Max(credit.Amount-credit.Used, 0))
+			report.TrialCredit = credit
+			return
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+const (
+	// HealthStatusOK 凭据有效
+	HealthStatusOK = "ok"
+	// HealthStatusInvalid 凭据失效（认证失败、用户或密钥被删除、账号被停用）
+	HealthStatusInvalid = "invalid"
+	// HealthStatusError 检查失败但无法确认凭据失效（网络错误、服务端错误等）
+	HealthStatusError = "error"
+
+	// HealthCheckInterval 定时健康检查间隔
+	HealthCheckInterval = 30 * time.Minute
+	// healthCheckTimeout 单个配置的检查超时
+	healthCheckTimeout = 20 * time.Second
+	// healthCheckConcurrency 并发检查的配置数
+	healthCheckConcurrency = 5
+)
+
+// ErrFingerprintMismatch 私钥与配置的指纹不一致
+var ErrFingerprintMismatch = errors.New("私钥与指纹不匹配")
+
+// CheckCredentials 校验配置的私钥与指纹一致，并通过身份服务确认用户和租户存在
+func (s *OCIService) CheckCredentials(ctx context.Context, user *models.OciUser) (*models.TenantInfo, error) {
+	privateKey, err := os.ReadFile(filepath.Join(OCIKeysDir, user.OciKeyPath))
+	if err != nil {
+		return nil, fmt.Errorf("读取私钥失败: %w", err)
+	}
+	fingerprint, err := APIKeyFingerprint(string(privateKey))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(fingerprint, user.OciFingerprint) {
+		return nil, fmt.Errorf("%w（私钥指纹 %s）", ErrFingerprintMismatch, fingerprint)
+	}
+	return s.VerifyCredentials(ctx, user)
+}
+
+// classifyHealthError 区分凭据失效和临时性错误，只有确认失效才暂停任务
+func classifyHealthError(err error) string {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrFingerprintMismatch) {
+		return HealthStatusInvalid
+	}
+	var serviceErr common.ServiceError
+	if errors.As(err, &serviceErr) {
+		switch serviceErr.GetHTTPStatusCode() {
+		case 401, 403, 404:
+			return HealthStatusInvalid
+		}
+		return HealthStatusError
+	}
+	return HealthStatusError
+}
+
+// HealthCheckResult 单个配置的检查结果
+type HealthCheckResult struct {
+	ConfigID string `json:"configId"`
+	Username string `json:"username"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+type HealthService struct {
+	ociService  *OCIService
+	taskService *TaskService
+	telegram    *TelegramService
+	stopChan    chan struct{}
+	running     bool
+	mutex       sync.Mutex
+}
+
+func NewHealthService(ociService *OCIService, taskService *TaskService, telegram *TelegramService) *HealthService {
+	return &HealthService{
+		ociService:  ociService,
+		taskService: taskService,
+		telegram:    telegram,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+func (s *HealthService) Start() {
+	s.mutex.Lock()
+	if s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.mutex.Unlock()
+
+	go s.run()
+	slog.Info("Health check service started")
+}
+
+func (s *HealthService) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		return
+	}
+	close(s.stopChan)
+	s.running = false
+	slog.Info("Health check service stopped")
+}
+
+func (s *HealthService) run() {
+	// 启动后稍等片刻再做第一次检查，避免与缓存刷新同时压向 OCI
+	first := time.NewTimer(time.Minute)
+	defer first.Stop()
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-first.C:
+			s.CheckAll()
+		case <-ticker.C:
+			s.CheckAll()
+		}
+	}
+}
+
+// CheckAll 并发检查所有配置
+func (s *HealthService) CheckAll() []HealthCheckResult {
+	var users []models.OciUser
+	database.GetDB().Find(&users)
+
+	results := make([]HealthCheckResult, len(users))
+	semaphore := make(chan struct{}, healthCheckConcurrency)
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(idx int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[idx] = s.Check(&users[idx])
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// CheckConfig 按 ID 检查单个配置
+func (s *HealthService) CheckConfig(configID string) (HealthCheckResult, error) {
+	var user models.OciUser
+	if err := database.GetDB().Where("id = ?", configID).First(&user).Error; err != nil {
+		return HealthCheckResult{}, err
+	}
+	return s.Check(&user), nil
+}
+
+// Check 检查配置凭据并记录结果，状态变化时发送通知并暂停或恢复任务
+func (s *HealthService) Check(user *models.OciUser) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	result := HealthCheckResult{ConfigID: user.ID, Username: user.Username, Status: HealthStatusOK}
+	if _, err := s.ociService.CheckCredentials(ctx, user); err != nil {
+		result.Status = classifyHealthError(err)
+		result.Error = err.Error()
+	}
+	s.record(user, result)
+	return result
+}
+
+func (s *HealthService) record(user *models.OciUser, result HealthCheckResult) {
+	now := time.Now()
+	previous := user.HealthStatus
+	updates := map[string]interface{}{
+		"health_status":     result.Status,
+		"health_check_time": now,
+		"last_error":        result.Error,
+	}
+	if result.Status == HealthStatusOK {
+		updates["last_ok_time"] = now
+	}
+	database.GetDB().Model(&models.OciUser{}).Where("id = ?", user.ID).Updates(updates)
+
+	switch {
+	case result.Status == HealthStatusInvalid && previous != HealthStatusInvalid:
+		paused := s.taskService.PauseUserTasks(user.ID, "配置凭据失效")
+		slog.Warn("Config credentials invalid, tasks paused", "config", user.Username, "config_id", user.ID, "paused", paused, "error", result.Error)
+		s.notify("⚠️ 配置凭据失效", fmt.Sprintf("配置：%s\n错误：%s\n已暂停任务：%d 个",
+			html.EscapeString(user.Username), html.EscapeString(result.Error), paused))
+	case result.Status == HealthStatusOK && previous == HealthStatusInvalid:
+		resumed := s.taskService.ResumeUserTasks(user.ID)
+		slog.Info("Config credentials recovered, tasks resumed", "config", user.Username, "config_id", user.ID, "resumed", resumed)
+		s.notify("✅ 配置凭据已恢复", fmt.Sprintf("配置：%s\n已恢复任务：%d 个", html.EscapeString(user.Username), resumed))
+	}
+}
+
+func (s *HealthService) notify(title, message string) {
+	if s.telegram == nil {
+		return
+	}
+	if err := s.telegram.SendNotification(title, message); err != nil {
+		slog.Warn("Failed to send health notification", "error", err)
+	}
+}
@@ -0,0 +1,532 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+	"github.com/oracle/oci-go-sdk/v65/identitydomains"
+)
+
+const (
+	// IAMModeClassic 通过经典 IAM 接口管理用户和组
+	IAMModeClassic = "classic"
+	// IAMModeDomain 通过 Identity Domains (SCIM) 接口管理用户和组
+	IAMModeDomain = "domain"
+
+	// maxPolicyStatements 单个策略允许的最大语句数
+	maxPolicyStatements = 50
+
+	scimUserSchema    = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema   = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimPatchOpSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+)
+
+// policyVerbs 策略语句允许的开头关键字
+var policyVerbs = []string{"allow", "define", "endorse", "admit"}
+
+// CreateIAMUserParams 创建 IAM 用户参数
+type CreateIAMUserParams struct {
+	Mode        string
+	Name        string
+	Email       string
+	Description string
+	GroupIDs    []string
+}
+
+// CreateIAMGroupParams 创建 IAM 组参数
+type CreateIAMGroupParams struct {
+	Mode        string
+	Name        string
+	Description string
+}
+
+// PolicyStatement 结构化的策略语句，用于策略编辑器拼装语句
+type PolicyStatement struct {
+	Subject   string `json:"subject"`   // 例如 group Administrators、any-user
+	Verb      string `json:"verb"`      // inspect / read / use / manage
+	Resource  string `json:"resource"`  // 例如 instance-family、all-resources
+	Location  string `json:"location"`  // tenancy 或 compartment <name>
+	Condition string `json:"condition"` // 可选 where 条件
+}
+
+// String 拼装为 Allow 语句
+func (p PolicyStatement) String() string {
+	statement := fmt.Sprintf("Allow %s to %s %s in %s",
+		strings.TrimSpace(p.Subject), strings.TrimSpace(p.Verb), strings.TrimSpace(p.Resource), strings.TrimSpace(p.Location))
+	if condition := strings.TrimSpace(p.Condition); condition != "" {
+		statement += " where " + condition
+	}
+	return statement
+}
+
+// Validate 校验结构化语句的必填字段和权限动词
+func (p PolicyStatement) Validate() error {
+	if strings.TrimSpace(p.Subject) == "" || strings.TrimSpace(p.Resource) == "" || strings.TrimSpace(p.Location) == "" {
+		return fmt.Errorf("策略语句的主体、资源和位置不能为空")
+	}
+	switch strings.ToLower(strings.TrimSpace(p.Verb)) {
+	case "inspect", "read", "use", "manage":
+		return nil
+	}
+	return fmt.Errorf("无效的权限动词: %s", p.Verb)
+}
+
+// BuildPolicyStatements 合并原始语句和结构化语句，去除空行并校验每条语句
+func BuildPolicyStatements(raw []string, structured []PolicyStatement) ([]string, error) {
+	var statements []string
+	for _, line := range raw {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		verb := strings.ToLower(strings.Fields(line)[0])
+		valid := false
+		for _, v := range policyVerbs {
+			if verb == v {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("无效的策略语句: %s", line)
+		}
+		statements = append(statements, line)
+	}
+	for _, p := range structured {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		statements = append(statements, p.String())
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("策略至少需要一条语句")
+	}
+	if len(statements) > maxPolicyStatements {
+		return nil, fmt.Errorf("单个策略最多 %d 条语句", maxPolicyStatements)
+	}
+	return statements, nil
+}
+
+func normalizeIAMMode(mode string) (string, error) {
+	switch mode {
+	case "", IAMModeClassic:
+		return IAMModeClassic, nil
+	case IAMModeDomain:
+		return IAMModeDomain, nil
+	}
+	return "", fmt.Errorf("无效的模式: %s", mode)
+}
+
+// domainsClient 获取主区域下第一个可用 Identity Domain 的客户端
+func (s *OCIService) domainsClient(ctx context.Context, user *models.OciUser) (identitydomains.IdentityDomainsClient, error) {
+	domainURL, err := s.GetDomainURL(ctx, user)
+	if err != nil {
+		return identitydomains.IdentityDomainsClient{}, err
+	}
+	return s.GetIdentityDomainsClient(user, domainURL)
+}
+
+// CreateIAMUser 创建 IAM 用户并加入指定的组
+func (s *OCIService) CreateIAMUser(ctx context.Context, user *models.OciUser, params CreateIAMUserParams) (*models.IAMUserInfo, error) {
+	mode, err := normalizeIAMMode(params.Mode)
+	if err != nil {
+		return nil, err
+	}
+	homeUser := s.homeRegionUser(ctx, user)
+	description := params.Description
+	if description == "" {
+		description = params.Name
+	}
+
+	var created *models.IAMUserInfo
+	if mode == IAMModeDomain {
+		created, err = s.createDomainUser(ctx, homeUser, params.Name, params.Email, description)
+	} else {
+		created, err = s.createClassicUser(ctx, homeUser, params.Name, params.Email, description)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 加组失败不回滚用户，返回已创建的用户并提示失败的组
+	for _, groupID := range params.GroupIDs {
+		if err := s.addUserToGroup(ctx, homeUser, mode, created.ID, groupID); err != nil {
+			return created, fmt.Errorf("用户已创建，但加入组 %s 失败: %w", groupID, err)
+		}
+		created.GroupIDs = append(created.GroupIDs, groupID)
+	}
+	return created, nil
+}
+
+func (s *OCIService) createClassicUser(ctx context.Context, user *models.OciUser, name, email, description string) (*models.IAMUserInfo, error) {
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return nil, err
+	}
+	details := identity.CreateUserDetails{
+		CompartmentId: &user.OciTenantID,
+		Name:          &name,
+		Description:   &description,
+	}
+	if email != "" {
+		details.Email = &email
+	}
+	resp, err := identityClient.CreateUser(ctx, identity.CreateUserRequest{CreateUserDetails: details})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return &models.IAMUserInfo{
+		ID:    stringValue(resp.Id),
+		Ocid:  stringValue(resp.Id),
+		Name:  stringValue(resp.Name),
+		Email: stringValue(resp.Email),
+		Mode:  IAMModeClassic,
+	}, nil
+}
+
+func (s *OCIService) createDomainUser(ctx context.Context, user *models.OciUser, name, email, description string) (*models.IAMUserInfo, error) {
+	domainsClient, err := s.domainsClient(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	domainUser := identitydomains.User{
+		Schemas:     []string{scimUserSchema},
+		UserName:    &name,
+		Description: &description,
+		Name:        &identitydomains.UserName{FamilyName: &name, GivenName: &name},
+	}
+	if email != "" {
+		domainUser.Emails = []identitydomains.UserEmails{{
+			Value:   &email,
+			Type:    identitydomains.UserEmailsTypeWork,
+			Primary: boolPtr(true),
+		}}
+	}
+	resp, err := domainsClient.CreateUser(ctx, identitydomains.CreateUserRequest{User: domainUser})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return &models.IAMUserInfo{
+		ID:    stringValue(resp.Id),
+		Ocid:  stringValue(resp.Ocid),
+		Name:  stringValue(resp.UserName),
+		Email: email,
+		Mode:  IAMModeDomain,
+	}, nil
+}
+
+// CreateIAMGroup 创建 IAM 组
+func (s *OCIService) CreateIAMGroup(ctx context.Context, user *models.OciUser, params CreateIAMGroupParams) (*models.IAMGroupInfo, error) {
+	mode, err := normalizeIAMMode(params.Mode)
+	if err != nil {
+		return nil, err
+	}
+	homeUser := s.homeRegionUser(ctx, user)
+	description := params.Description
+	if description == "" {
+		description = params.Name
+	}
+
+	if mode == IAMModeDomain {
+		domainsClient, err := s.domainsClient(ctx, homeUser)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := domainsClient.CreateGroup(ctx, identitydomains.CreateGroupRequest{Group: identitydomains.Group{
+			Schemas:     []string{scimGroupSchema},
+			DisplayName: &params.Name,
+			UrnIetfParamsScimSchemasOracleIdcsExtensionGroupGroup: &identitydomains.ExtensionGroupGroup{
+				Description: &description,
+			},
+		}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create group: %w", err)
+		}
+		return &models.IAMGroupInfo{
+			ID:          stringValue(resp.Id),
+			Ocid:        stringValue(resp.Ocid),
+			Name:        stringValue(resp.DisplayName),
+			Description: description,
+			Mode:        IAMModeDomain,
+		}, nil
+	}
+
+	identityClient, err := s.GetIdentityClient(homeUser)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := identityClient.CreateGroup(ctx, identity.CreateGroupRequest{CreateGroupDetails: identity.CreateGroupDetails{
+		CompartmentId: &homeUser.OciTenantID,
+		Name:          &params.Name,
+		Description:   &description,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+	return classicGroupInfo(resp.Group), nil
+}
+
+func classicGroupInfo(group identity.Group) *models.IAMGroupInfo {
+	info := &models.IAMGroupInfo{
+		ID:          stringValue(group.Id),
+		Ocid:        stringValue(group.Id),
+		Name:        stringValue(group.Name),
+		Description: stringValue(group.Description),
+		State:       string(group.LifecycleState),
+		Mode:        IAMModeClassic,
+	}
+	if group.TimeCreated != nil {
+		info.CreateTime = group.TimeCreated.Format("2006-01-02 15:04:05")
+	}
+	return info
+}
+
+// ListIAMGroups 列出租户下的组
+func (s *OCIService) ListIAMGroups(ctx context.Context, user *models.OciUser, mode string) ([]models.IAMGroupInfo, error) {
+	mode, err := normalizeIAMMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []models.IAMGroupInfo{}
+	if mode == IAMModeDomain {
+		domainsClient, err := s.domainsClient(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		startIndex := 1
+		for {
+			resp, err := domainsClient.ListGroups(ctx, identitydomains.ListGroupsRequest{
+				StartIndex: &startIndex,
+				Count:      common.Int(100),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list groups: %w", err)
+			}
+			for _, g := range resp.Resources {
+				info := models.IAMGroupInfo{
+					ID:   stringValue(g.Id),
+					Ocid: stringValue(g.Ocid),
+					Name: stringValue(g.DisplayName),
+					Mode: IAMModeDomain,
+				}
+				if g.UrnIetfParamsScimSchemasOracleIdcsExtensionGroupGroup != nil {
+					info.Description = stringValue(g.UrnIetfParamsScimSchemasOracleIdcsExtensionGroupGroup.Description)
+				}
+				if g.Meta != nil {
+					info.CreateTime = stringValue(g.Meta.Created)
+				}
+				groups = append(groups, info)
+			}
+			if len(resp.Resources) == 0 || resp.TotalResults == nil || startIndex+len(resp.Resources) > *resp.TotalResults {
+				break
+			}
+			startIndex += len(resp.Resources)
+		}
+		return groups, nil
+	}
+
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return nil, err
+	}
+	req := identity.ListGroupsRequest{CompartmentId: &user.OciTenantID}
+	for {
+		resp, err := identityClient.ListGroups(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list groups: %w", err)
+		}
+		for _, g := range resp.Items {
+			groups = append(groups, *classicGroupInfo(g))
+		}
+		if resp.OpcNextPage == nil {
+			break
+		}
+		req.Page = resp.OpcNextPage
+	}
+	return groups, nil
+}
+
+// AddUserToGroup 将用户加入组，Identity Domains 模式下也接受 OCID
+func (s *OCIService) AddUserToGroup(ctx context.Context, user *models.OciUser, mode, userID, groupID string) error {
+	mode, err := normalizeIAMMode(mode)
+	if err != nil {
+		return err
+	}
+	return s.addUserToGroup(ctx, s.homeRegionUser(ctx, user), mode, userID, groupID)
+}
+
+func (s *OCIService) addUserToGroup(ctx context.Context, user *models.OciUser, mode, userID, groupID string) error {
+	if mode == IAMModeClassic {
+		identityClient, err := s.GetIdentityClient(user)
+		if err != nil {
+			return err
+		}
+		_, err = identityClient.AddUserToGroup(ctx, identity.AddUserToGroupRequest{
+			AddUserToGroupDetails: identity.AddUserToGroupDetails{UserId: &userID, GroupId: &groupID},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add user to group: %w", err)
+		}
+		return nil
+	}
+
+	domainsClient, err := s.domainsClient(ctx, user)
+	if err != nil {
+		return err
+	}
+	userID, err = resolveDomainUserID(ctx, domainsClient, userID)
+	if err != nil {
+		return err
+	}
+	groupID, err = resolveDomainGroupID(ctx, domainsClient, groupID)
+	if err != nil {
+		return err
+	}
+
+	var members interface{} = []map[string]string{{"value": userID, "type": string(identitydomains.GroupMembersTypeUser)}}
+	_, err = domainsClient.PatchGroup(ctx, identitydomains.PatchGroupRequest{
+		GroupId: &groupID,
+		PatchOp: identitydomains.PatchOp{
+			Schemas: []string{scimPatchOpSchema},
+			Operations: []identitydomains.Operations{{
+				Op:    identitydomains.OperationsOpAdd,
+				Path:  stringPtr("members"),
+				Value: &members,
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add user to group: %w", err)
+	}
+	return nil
+}
+
+// resolveDomainUserID 将用户 OCID 转换为 Identity Domains 内部 ID
+func resolveDomainUserID(ctx context.Context, client identitydomains.IdentityDomainsClient, id string) (string, error) {
+	if !strings.HasPrefix(id, "ocid1.") {
+		return id, nil
+	}
+	resp, err := client.ListUsers(ctx, identitydomains.ListUsersRequest{
+		Filter: stringPtr(fmt.Sprintf("ocid eq \"%s\"", id)),
+		Count:  common.Int(1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find user: %w", err)
+	}
+	if len(resp.Resources) == 0 || resp.Resources[0].Id == nil {
+		return "", fmt.Errorf("用户不存在: %s", id)
+	}
+	return *resp.Resources[0].Id, nil
+}
+
+// resolveDomainGroupID 将组 OCID 转换为 Identity Domains 内部 ID
+func resolveDomainGroupID(ctx context.Context, client identitydomains.IdentityDomainsClient, id string) (string, error) {
+	if !strings.HasPrefix(id, "ocid1.") {
+		return id, nil
+	}
+	resp, err := client.ListGroups(ctx, identitydomains.ListGroupsRequest{
+		Filter: stringPtr(fmt.Sprintf("ocid eq \"%s\"", id)),
+		Count:  common.Int(1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find group: %w", err)
+	}
+	if len(resp.Resources) == 0 || resp.Resources[0].Id == nil {
+		return "", fmt.Errorf("组不存在: %s", id)
+	}
+	return *resp.Resources[0].Id, nil
+}
+
+func policyInfo(policy identity.Policy) models.IAMPolicyInfo {
+	info := models.IAMPolicyInfo{
+		ID:            stringValue(policy.Id),
+		Name:          stringValue(policy.Name),
+		Description:   stringValue(policy.Description),
+		CompartmentID: stringValue(policy.CompartmentId),
+		Statements:    policy.Statements,
+		State:         string(policy.LifecycleState),
+	}
+	if policy.TimeCreated != nil {
+		info.CreateTime = policy.TimeCreated.Format("2006-01-02 15:04:05")
+	}
+	return info
+}
+
+// ListPolicies 列出区间下的策略，compartmentID 为空时使用租户根区间
+func (s *OCIService) ListPolicies(ctx context.Context, user *models.OciUser, compartmentID string) ([]models.IAMPolicyInfo, error) {
+	if compartmentID == "" {
+		compartmentID = user.OciTenantID
+	}
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []models.IAMPolicyInfo{}
+	req := identity.ListPoliciesRequest{CompartmentId: &compartmentID}
+	for {
+		resp, err := identityClient.ListPolicies(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list policies: %w", err)
+		}
+		for _, p := range resp.Items {
+			policies = append(policies, policyInfo(p))
+		}
+		if resp.OpcNextPage == nil {
+			break
+		}
+		req.Page = resp.OpcNextPage
+	}
+	return policies, nil
+}
+
+// CreatePolicy 创建策略，策略只能通过经典 IAM 接口管理
+func (s *OCIService) CreatePolicy(ctx context.Context, user *models.OciUser, compartmentID, name, description string, statements []string) (*models.IAMPolicyInfo, error) {
+	if compartmentID == "" {
+		compartmentID = user.OciTenantID
+	}
+	if description == "" {
+		description = name
+	}
+	identityClient, err := s.GetIdentityClient(s.homeRegionUser(ctx, user))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := identityClient.CreatePolicy(ctx, identity.CreatePolicyRequest{CreatePolicyDetails: identity.CreatePolicyDetails{
+		CompartmentId: &compartmentID,
+		Name:          &name,
+		Description:   &description,
+		Statements:    statements,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create policy: %w", err)
+	}
+	info := policyInfo(resp.Policy)
+	return &info, nil
+}
+
+// UpdatePolicy 替换策略语句，description 为空时保持不变
+func (s *OCIService) UpdatePolicy(ctx context.Context, user *models.OciUser, policyID, description string, statements []string) (*models.IAMPolicyInfo, error) {
+	identityClient, err := s.GetIdentityClient(s.homeRegionUser(ctx, user))
+	if err != nil {
+		return nil, err
+	}
+	details := identity.UpdatePolicyDetails{Statements: statements}
+	if description != "" {
+		details.Description = &description
+	}
+	resp, err := identityClient.UpdatePolicy(ctx, identity.UpdatePolicyRequest{
+		PolicyId:            &policyID,
+		UpdatePolicyDetails: details,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update policy: %w", err)
+	}
+	info := policyInfo(resp.Policy)
+	return &info, nil
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/monitoring"
+)
+
+const (
+	IdleStatusOK     = "ok"
+	IdleStatusAtRisk = "at_risk"
+	IdleStatusIdle   = "idle"
+	IdleStatusNoData = "no_data"
+)
+
+const (
+	// IdleGuardInterval 空闲回收风险评估间隔
+	IdleGuardInterval = 6 * time.Hour
+	// idleRiskMargin 95 分位低于阈值的该倍数时视为接近回收
+	idleRiskMargin = 1.25
+	// idleRecentWindow 近期趋势的统计窗口，近期已满足回收条件时提前告警
+	idleRecentWindow = 48 * time.Hour
+	// idleGuardConcurrency 并发评估的配置数
+	idleGuardConcurrency = 3
+)
+
+// idleSample 小时粒度的监控数据点
+type idleSample struct {
+	time  time.Time
+	value float64
+}
+
+// samplesByResource 按资源收集带时间戳的数据点
+func samplesByResource(items []monitoring.MetricData) map[string][]idleSample {
+	result := map[string][]idleSample{}
+	for _, item := range items {
+		id := item.Dimensions["resourceId"]
+		for _, dp := range item.AggregatedDatapoints {
+			if dp.Timestamp != nil && dp.Value != nil {
+				result[id] = append(result[id], idleSample{time: dp.Timestamp.Time, value: *dp.Value})
+			}
+		}
+	}
+	return result
+}
+
+// p95Since 计算 since 之后数据点的 95 分位，没有数据时返回 nil
+func p95Since(samples []idleSample, since time.Time) *float64 {
+	var values []float64
+	for _, sample := range samples {
+		if !sample.time.Before(since) {
+			values = append(values, sample.value)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	v := roundAmount(percentileValue(values, 0.95))
+	return &v
+}
+
+// networkUtilization 将每小时的收发字节数换算为占实例带宽的百分比，取收发中较大的一方
+func networkUtilization(in, out []idleSample, bandwidthGbps float32) []idleSample {
+	if bandwidthGbps <= 0 {
+		return nil
+	}
+	hourly := map[time.Time]float64{}
+	for _, sample := range append(append([]idleSample{}, in...), out...) {
+		key := sample.time.Truncate(time.Hour)
+		if sample.value > hourly[key] {
+			hourly[key] = sample.value
+		}
+	}
+	capacity := float64(bandwidthGbps) * 1e9
+	result := make([]idleSample, 0, len(hourly))
+	for t, bytes := range hourly {
+		result = append(result, idleSample{time: t, value: bytes * 8 / 3600 / capacity * 100})
+	}
+	return result
+}
+
+// AssessIdleInstances 评估主区域中运行的 Always Free 实例被回收的风险，免费额度只存在于主区域
+// Oracle 的回收条件：7 天内 CPU、网络使用率的 95 分位均低于 20%，A1 规格还要求内存低于 20%
+func (s *OCIService) AssessIdleInstances(ctx context.Context, user *models.OciUser) ([]models.OciIdleAssessment, []string) {
+	compartments, err := s.ResolveCompartments(ctx, user, user.OciTenantID, true)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	homeUser := s.homeRegionUser(ctx, user)
+	assessments, err := s.assessRegionIdle(ctx, homeUser, compartments)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("%s: %v", homeUser.OciRegion, err)}
+	}
+	return assessments, nil
+}
+
+func (s *OCIService) assessRegionIdle(ctx context.Context, user *models.OciUser, compartments []string) ([]models.OciIdleAssessment, error) {
+	var all []core.Instance
+	for _, compartmentID := range compartments {
+		items, err := s.ListInstances(ctx, user, compartmentID)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	free := freeTierInstanceIDs(all)
+	var instances []core.Instance
+	for _, inst := range all {
+		if inst.Id != nil && free[*inst.Id] {
+			instances = append(instances, inst)
+		}
+	}
+	if len(instances) == 0 {
+		return nil, nil
+	}
+
+	client, err := s.getMonitoringClient(user)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	start := now.Add(-IdleWindow)
+	queries := []string{
+		"CpuUtilization[1h].groupBy(resourceId).mean()",
+		"MemoryUtilization[1h].groupBy(resourceId).mean()",
+		"NetworksBytesIn[1h].groupBy(resourceId).sum()",
+		"NetworksBytesOut[1h].groupBy(resourceId).sum()",
+	}
+	series := make([]map[string][]idleSample, len(queries))
+	for i, query := range queries {
+		items, err := s.summarizeComputeAgentMetric(ctx, client, user.OciTenantID, true, query, start, now)
+		if err != nil {
+			return nil, err
+		}
+		series[i] = samplesByResource(items)
+	}
+	cpu, mem, netIn, netOut := series[0], series[1], series[2], series[3]
+
+	result := make([]models.OciIdleAssessment, 0, len(instances))
+	for _, inst := range instances {
+		id := *inst.Id
+		var bandwidth float32
+		if inst.ShapeConfig != nil && inst.ShapeConfig.NetworkingBandwidthInGbps != nil {
+			bandwidth = *inst.ShapeConfig.NetworkingBandwidthInGbps
+		}
+		assessment := assessIdle(stringValue(inst.Shape), cpu[id], mem[id], networkUtilization(netIn[id], netOut[id], bandwidth), now)
+		assessment.ConfigID = user.ID
+		assessment.InstanceID = id
+		assessment.InstanceName = stringValue(inst.DisplayName)
+		assessment.Region = user.OciRegion
+		assessment.Shape = stringValue(inst.Shape)
+		assessment.UpdateTime = now
+		result = append(result, assessment)
+	}
+	return result, nil
+}
+
+// assessIdle 根据 7 天和近 48 小时的 95 分位判断回收风险
+func assessIdle(shape string, cpu, mem, network []idleSample, now time.Time) models.OciIdleAssessment {
+	assessment := models.OciIdleAssessment{CoverageHours: len(cpu)}
+	if len(cpu) == 0 {
+		assessment.Status = IdleStatusNoData
+		assessment.Reason = "没有 CPU 监控数据，请确认已启用 Compute Instance Monitoring 插件"
+		return assessment
+	}
+
+	weekStart := now.Add(-IdleWindow)
+	recentStart := now.Add(-idleRecentWindow)
+	assessment.CpuP95 = p95Since(cpu, weekStart)
+	assessment.NetworkP95 = p95Since(network, weekStart)
+	// 内存条件只适用于 A1 规格
+	checkMemory := shape == "VM.Standard.A1.Flex"
+	if checkMemory {
+		assessment.MemoryP95 = p95Since(mem, weekStart)
+	}
+
+	type criterion struct {
+		name   string
+		week   *float64
+		recent *float64
+	}
+	criteria := []criterion{{"CPU", assessment.CpuP95, p95Since(cpu, recentStart)}}
+	if assessment.NetworkP95 != nil {
+		criteria = append(criteria, criterion{"网络", assessment.NetworkP95, p95Since(network, recentStart)})
+	}
+	if checkMemory && assessment.MemoryP95 != nil {
+		criteria = append(criteria, criterion{"内存", assessment.MemoryP95, p95Since(mem, recentStart)})
+	}
+
+	idle, near, recentIdle := true, true, true
+	var parts []string
+	for _, c := range criteria {
+		parts = append(parts, fmt.Sprintf("%s %.1f%%", c.name, *c.week))
+		idle = idle && *c.week < IdleCpuThreshold
+		near = near && *c.week < IdleCpuThreshold*idleRiskMargin
+		recentIdle = recentIdle && c.recent != nil && *c.recent < IdleCpuThreshold
+	}
+	summary := "7 天 95 分位：" + strings.Join(parts, "，")
+
+	switch {
+	case idle && assessment.CoverageHours >= idleMinCoverageHours:
+		assessment.Status = IdleStatusIdle
+		assessment.Reason = summary + "，均低于 20%，可能被回收"
+	case idle || recentIdle:
+		assessment.Status = IdleStatusAtRisk
+		assessment.Reason = summary + "，近 48 小时已满足回收条件"
+	case near:
+		assessment.Status = IdleStatusAtRisk
+		assessment.Reason = summary + "，接近 20% 回收阈值"
+	default:
+		assessment.Status = IdleStatusOK
+		assessment.Reason = summary
+	}
+	return assessment
+}
+
+func isIdleRisk(status string) bool {
+	return status == IdleStatusAtRisk || status == IdleStatusIdle
+}
+
+type IdleGuardService struct {
+	ociService *OCIService
+	telegram   *TelegramService
+	stopChan   chan struct{}
+	running    bool
+	mutex      sync.Mutex
+
+	lastRun time.Time
+	busy    sync.Mutex
+}
+
+func NewIdleGuardService(ociService *OCIService, telegram *TelegramService) *IdleGuardService {
+	return &IdleGuardService{
+		ociService: ociService,
+		telegram:   telegram,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+func (s *IdleGuardService) Start() {
+	s.mutex.Lock()
+	if s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.mutex.Unlock()
+
+	go s.run()
+	slog.Info("Idle guard service started")
+}
+
+func (s *IdleGuardService) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		return
+	}
+	close(s.stopChan)
+	s.running = false
+	slog.Info("Idle guard service stopped")
+}
+
+func (s *IdleGuardService) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.runDue()
+		}
+	}
+}
+
+func (s *IdleGuardService) runDue() {
+	if !s.busy.TryLock() {
+		return
+	}
+	due := time.Since(s.lastRun) >= IdleGuardInterval
+	s.busy.Unlock()
+	if due {
+		s.AssessAll(true)
+	}
+}
+
+// AssessAll 评估所有配置，notify 为 true 时对新进入风险状态的实例发送通知
+// 上一轮评估未结束时直接返回
+func (s *IdleGuardService) AssessAll(notify bool) {
+	if !s.busy.TryLock() {
+		return
+	}
+	defer s.busy.Unlock()
+	s.lastRun = time.Now()
+
+	var users []models.OciUser
+	database.GetDB().Find(&users)
+
+	semaphore := make(chan struct{}, idleGuardConcurrency)
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(user *models.OciUser) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if _, err := s.Assess(user, notify); err != nil {
+				slog.Error("Failed to assess idle instances", "config", user.Username, "config_id", user.ID, "error", err)
+			}
+		}(&users[i])
+	}
+	wg.Wait()
+}
+
+// Assess 评估单个配置并保存结果，全部区域成功时清理已不存在实例的旧记录
+func (s *IdleGuardService) Assess(user *models.OciUser, notify bool) ([]models.OciIdleAssessment, error) {
+	assessments, errs := s.ociService.AssessIdleInstances(context.Background(), user)
+	if len(assessments) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	db := database.GetDB()
+	var previous []models.OciIdleAssessment
+	db.Where("config_id = ?", user.ID).Find(&previous)
+	prevByID := map[string]models.OciIdleAssessment{}
+	for _, p := range previous {
+		prevByID[p.InstanceID] = p
+	}
+
+	var alerts []string
+	seen := map[string]bool{}
+	for i := range assessments {
+		a := &assessments[i]
+		seen[a.InstanceID] = true
+		prev, exists := prevByID[a.InstanceID]
+		if exists {
+			a.ID = prev.ID
+		} else {
+			a.ID = uuid.New().String()
+		}
+		if err := db.Save(a).Error; err != nil {
+			return nil, err
+		}
+		// 新进入风险状态，或从接近回收升级为满足回收条件时通知
+		if isIdleRisk(a.Status) && (!exists || !isIdleRisk(prev.Status) || (a.Status == IdleStatusIdle && prev.Status != IdleStatusIdle)) {
+			alerts = append(alerts, fmt.Sprintf("%s（%s, %s）\n%s", a.InstanceName, a.Shape, a.Region, a.Reason))
+		}
+	}
+	if len(errs) == 0 {
+		for _, p := range previous {
+			if !seen[p.InstanceID] {
+				db.Delete(&p)
+			}
+		}
+	}
+
+	if notify && len(alerts) > 0 && s.telegram != nil {
+		message := fmt.Sprintf("配置：%s\n\n%s", html.EscapeString(user.Username), html.EscapeString(strings.Join(alerts, "\n\n")))
+		if err := s.telegram.SendNotification("😴 Always Free 实例有被回收风险", message); err != nil {
+			slog.Warn("Failed to send idle guard notification", "config", user.Username, "error", err)
+		}
+	}
+
+	sort.Slice(assessments, func(i, j int) bool { return assessments[i].InstanceName < assessments[j].InstanceName })
+	return assessments, nil
+}
+
+// AssessConfig 立即评估单个配置，不发送通知
+func (s *IdleGuardService) AssessConfig(configID string) ([]models.OciIdleAssessment, error) {
+	var user models.OciUser
+	if err := database.GetDB().Where("id = ?", configID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("配置不存在")
+	}
+	return s.Assess(&user, false)
+}
+
+// List 获取保存的评估结果，all 为 false 时只返回有回收风险的实例
+func (s *IdleGuardService) List(configID string, all bool) ([]models.OciIdleAssessment, error) {
+	query := database.GetDB().Model(&models.OciIdleAssessment{})
+	if configID != "" {
+		query = query.Where("config_id = ?", configID)
+	}
+	if !all {
+		query = query.Where("status IN ?", []string{IdleStatusAtRisk, IdleStatusIdle})
+	}
+	var result []models.OciIdleAssessment
+	err := query.Order("config_id, instance_name").Find(&result).Error
+	return result, err
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/monitoring"
+)
+
+const (
+	// IdleCpuThreshold Oracle 回收 Always Free 实例的 CPU 95 分位阈值（百分比）
+	IdleCpuThreshold = 20.0
+	// IdleWindow 空闲判断的统计窗口
+	IdleWindow = 7 * 24 * time.Hour
+	// idleMinCoverageHours 空闲判断至少需要的数据小时数，避免刚创建或刚启用监控的实例被误判
+	idleMinCoverageHours = 24
+	// metricMaxPoints 单个指标查询返回的最大数据点数
+	metricMaxPoints = 10000
+)
+
+// computeAgentMetrics oci_computeagent 命名空间中支持查询的指标
+var computeAgentMetrics = map[string]bool{
+	"CpuUtilization":         true,
+	"MemoryUtilization":      true,
+	"MemoryAllocationStalls": true,
+	"LoadAverage":            true,
+	"DiskBytesRead":          true,
+	"DiskBytesWritten":       true,
+	"DiskIopsRead":           true,
+	"DiskIopsWritten":        true,
+	"NetworksBytesIn":        true,
+	"NetworksBytesOut":       true,
+}
+
+// metricStatistics 统计方式到 MQL 函数的映射
+var metricStatistics = map[string]string{
+	"mean":  "mean()",
+	"max":   "max()",
+	"min":   "min()",
+	"sum":   "sum()",
+	"count": "count()",
+	"rate":  "rate()",
+	"p50":   "percentile(0.5)",
+	"p90":   "percentile(0.9)",
+	"p95":   "percentile(0.95)",
+	"p99":   "percentile(0.99)",
+}
+
+var metricIntervalPattern = regexp.MustCompile(`^([1-9][0-9]*)([mhd])$`)
+
+// instanceOCIDPattern 实例 OCID 格式，拼入 MQL 前校验，防止引号、花括号等字符改写查询
+var instanceOCIDPattern = regexp.MustCompile(`^ocid1\.instance\.[A-Za-z0-9._-]+$`)
+
+// parseMetricInterval 解析 MQL 时间间隔，支持 1m 到 1d
+func parseMetricInterval(interval string) (time.Duration, error) {
+	match := metricIntervalPattern.FindStringSubmatch(interval)
+	if match == nil {
+		return 0, fmt.Errorf("不支持的时间间隔: %s", interval)
+	}
+	n, _ := strconv.Atoi(match[1])
+	unit := map[string]time.Duration{"m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}[match[2]]
+	d := time.Duration(n) * unit
+	if d < time.Minute || d > 24*time.Hour {
+		return 0, fmt.Errorf("时间间隔必须在 1m 到 1d 之间: %s", interval)
+	}
+	return d, nil
+}
+
+// InstanceMetricsQuery 实例监控查询参数
+type InstanceMetricsQuery struct {
+	InstanceID string
+	Region     string // 为空时使用配置所在区域
+	Metrics    []string
+	Interval   string // 默认 5m
+	Statistic  string // 默认 mean
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+// GetInstanceMetrics 查询实例的 oci_computeagent 指标，需要实例启用 Compute Instance Monitoring 插件
+func (s *OCIService) GetInstanceMetrics(ctx context.Context, user *models.OciUser, query InstanceMetricsQuery) ([]models.InstanceMetricSeries, error) {
+	if !instanceOCIDPattern.MatchString(query.InstanceID) {
+		return nil, fmt.Errorf("无效的实例ID: %s", query.InstanceID)
+	}
+	if query.Interval == "" {
+		query.Interval = "5m"
+	}
+	if query.Statistic == "" {
+		query.Statistic = "mean"
+	}
+	if len(query.Metrics) == 0 {
+		query.Metrics = []string{"CpuUtilization", "MemoryUtilization"}
+	}
+	interval, err := parseMetricInterval(query.Interval)
+	if err != nil {
+		return nil, err
+	}
+	statistic, ok := metricStatistics[query.Statistic]
+	if !ok {
+		return nil, fmt.Errorf("不支持的统计方式: %s", query.Statistic)
+	}
+	for _, metric := range query.Metrics {
+		if !computeAgentMetrics[metric] {
+			return nil, fmt.Errorf("不支持的指标: %s", metric)
+		}
+	}
+	if !query.EndTime.After(query.StartTime) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	if query.EndTime.Sub(query.StartTime)/interval > metricMaxPoints {
+		return nil, fmt.Errorf("数据点过多，请缩小时间范围或增大时间间隔")
+	}
+
+	regionUser := *user
+	if query.Region != "" {
+		regionUser.OciRegion = query.Region
+	}
+	monitoringClient, err := s.getMonitoringClient(&regionUser)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.InstanceMetricSeries, 0, len(query.Metrics))
+	for _, metric := range query.Metrics {
+		mql := fmt.Sprintf("%s[%s]{resourceId = \"%s\"}.%s", metric, query.Interval, query.InstanceID, statistic)
+		items, err := s.summarizeComputeAgentMetric(ctx, monitoringClient, user.OciTenantID, true, mql, query.StartTime, query.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		series := models.InstanceMetricSeries{
+			Metric:    metric,
+			Interval:  query.Interval,
+			Statistic: query.Statistic,
+			Points:    []models.InstanceMetricPoint{},
+		}
+		for _, item := range items {
+			for _, dp := range item.AggregatedDatapoints {
+				if dp.Timestamp != nil && dp.Value != nil {
+					series.Points = append(series.Points, models.InstanceMetricPoint{Time: dp.Timestamp.Time, Value: *dp.Value})
+				}
+			}
+		}
+		sort.Slice(series.Points, func(i, j int) bool { return series.Points[i].Time.Before(series.Points[j].Time) })
+		result = append(result, series)
+	}
+	return result, nil
+}
+
+func (s *OCIService) getMonitoringClient(user *models.OciUser) (monitoring.MonitoringClient, error) {
+	configProvider, err := s.GetConfigProvider(user)
+	if err != nil {
+		return monitoring.MonitoringClient{}, err
+	}
+	client, err := monitoring.NewMonitoringClientWithConfigurationProvider(configProvider)
+	if err != nil {
+		return monitoring.MonitoringClient{}, err
+	}
+	instrumentClient(&client.BaseClient)
+	return client, nil
+}
+
+// summarizeComputeAgentMetric 在 oci_computeagent 命名空间中执行 MQL 查询
+// inSubtree 只能在租户根区间上使用
+func (s *OCIService) summarizeComputeAgentMetric(ctx context.Context, client monitoring.MonitoringClient, compartmentID string, inSubtree bool, query string, start, end time.Time) ([]monitoring.MetricData, error) {
+	resp, err := client.SummarizeMetricsData(ctx, monitoring.SummarizeMetricsDataRequest{
+		CompartmentId:          &compartmentID,
+		CompartmentIdInSubtree: &inSubtree,
+		SummarizeMetricsDataDetails: monitoring.SummarizeMetricsDataDetails{
+			Namespace: stringPtr("oci_computeagent"),
+			Query:     &query,
+			StartTime: &common.SDKTime{Time: start},
+			EndTime:   &common.SDKTime{Time: end},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics: %w", err)
+	}
+	return resp.Items, nil
+}
+
+// percentileValue 最近秩法计算分位数，values 会被排序
+func percentileValue(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(p*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
+
+// latestByResource 取每个资源最后一个数据点的值
+func latestByResource(items []monitoring.MetricData) map[string]float64 {
+	result := map[string]float64{}
+	for _, item := range items {
+		var latest time.Time
+		for _, dp := range item.AggregatedDatapoints {
+			if dp.Timestamp != nil && dp.Value != nil && !dp.Timestamp.Before(latest) {
+				latest = dp.Timestamp.Time
+				result[item.Dimensions["resourceId"]] = *dp.Value
+			}
+		}
+	}
+	return result
+}
+
+// valuesByResource 按资源收集所有数据点的值
+func valuesByResource(items []monitoring.MetricData) map[string][]float64 {
+	result := map[string][]float64{}
+	for _, item := range items {
+		id := item.Dimensions["resourceId"]
+		for _, dp := range item.AggregatedDatapoints {
+			if dp.Value != nil {
+				result[id] = append(result[id], *dp.Value)
+			}
+		}
+	}
+	return result
+}
+
+// fillInstanceMetricSummaries 为区间中运行的实例填充监控摘要，每个区间只查询三次
+// 查询失败时保持摘要为空，不影响实例列表
+func (s *OCIService) fillInstanceMetricSummaries(ctx context.Context, user *models.OciUser, compartmentID string, instances []models.InstanceInfo) {
+	running := false
+	for _, inst := range instances {
+		if inst.State == "RUNNING" {
+			running = true
+			break
+		}
+	}
+	if !running {
+		return
+	}
+
+	client, err := s.getMonitoringClient(user)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	recentStart := now.Add(-30 * time.Minute)
+	cpuItems, err := s.summarizeComputeAgentMetric(ctx, client, compartmentID, false, "CpuUtilization[5m].groupBy(resourceId).mean()", recentStart, now)
+	if err != nil {
+		return
+	}
+	memItems, _ := s.summarizeComputeAgentMetric(ctx, client, compartmentID, false, "MemoryUtilization[5m].groupBy(resourceId).mean()", recentStart, now)
+	weekItems, _ := s.summarizeComputeAgentMetric(ctx, client, compartmentID, false, "CpuUtilization[1h].groupBy(resourceId).mean()", now.Add(-IdleWindow), now)
+
+	cpu := latestByResource(cpuItems)
+	mem := latestByResource(memItems)
+	week := valuesByResource(weekItems)
+	updateTime := now.Format("2006-01-02 15:04:05")
+	for i := range instances {
+		inst := &instances[i]
+		if inst.State != "RUNNING" {
+			continue
+		}
+		summary := &models.InstanceMetricSummary{UpdateTime: updateTime}
+		if v, ok := cpu[inst.ID]; ok {
+			summary.CpuUtilization = common.Float64(roundAmount(v))
+		}
+		if v, ok := mem[inst.ID]; ok {
+			summary.MemoryUtilization = common.Float64(roundAmount(v))
+		}
+		if values := week[inst.ID]; len(values) > 0 {
+			summary.CoverageHours = len(values)
+			p95 := roundAmount(percentileValue(values, 0.95))
+			summary.CpuP95 = &p95
+			summary.Idle = summary.CoverageHours >= idleMinCoverageHours && p95 < IdleCpuThreshold
+		}
+		if summary.CpuUtilization == nil && summary.MemoryUtilization == nil && summary.CpuP95 == nil {
+			continue
+		}
+		inst.Metrics = summary
+	}
+}
+
+// GetInstanceMetrics 查询实例监控指标
+func (s *InstanceService) GetInstanceMetrics(userId string, query InstanceMetricsQuery) ([]models.InstanceMetricSeries, error) {
+	var user models.OciUser
+	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	return s.ociService.GetInstanceMetrics(context.Background(), &user, query)
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/adiecho/oci-panel/internal/database"
 	"github.com/adiecho/oci-panel/internal/models"
@@ -55,62 +56,82 @@ func (s *InstanceService) ListInstances(userId string, compartmentId string) ([]
 	return result, nil
 }
 
-func (s *InstanceService) StartInstance(userId string, instanceId string) error {
+func (s *InstanceService) StartInstance(userId string, instanceId string, region string) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	return s.ociService.InstanceAction(context.Background(), &user, instanceId, "START")
 }
 
-func (s *InstanceService) StopInstance(userId string, instanceId string) error {
+func (s *InstanceService) StopInstance(userId string, instanceId string, region string) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	return s.ociService.InstanceAction(context.Background(), &user, instanceId, "STOP")
 }
 
-func (s *InstanceService) RebootInstance(userId string, instanceId string) error {
+func (s *InstanceService) RebootInstance(userId string, instanceId string, region string) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	return s.ociService.InstanceAction(context.Background(), &user, instanceId, "RESET")
 }
 
-func (s *InstanceService) TerminateInstance(userId string, instanceId string) error {
+func (s *InstanceService) TerminateInstance(userId string, instanceId string, region string) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	return s.ociService.TerminateInstance(context.Background(), &user, instanceId)
 }
 
-func (s *InstanceService) UpdateInstanceName(userId string, instanceId string, displayName string) error {
+func (s *InstanceService) UpdateInstanceName(userId string, instanceId string, region string, displayName string) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	return s.ociService.UpdateInstance(context.Background(), &user, instanceId, displayName)
 }
 
 // ChangePublicIP 更改实例公网IP
-func (s *InstanceService) ChangePublicIP(userId string, instanceId string) (string, error) {
+func (s *InstanceService) ChangePublicIP(ctx context.Context, userId string, instanceId string, region string) (string, error) {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return "", fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
-	ctx := context.Background()
+	return s.changePublicIP(ctx, &user, instanceId)
+}
 
+func (s *InstanceService) changePublicIP(ctx context.Context, user *models.OciUser, instanceId string) (string, error) {
 	// 获取实例详情以找到VNIC
-	details, err := s.ociService.GetInstanceDetails(ctx, &user, instanceId)
+	details, err := s.ociService.GetInstanceDetails(ctx, user, instanceId)
 	if err != nil {
 		return "", fmt.Errorf("failed to get instance details: %w", err)
 	}
@@ -121,7 +142,7 @@ func (s *InstanceService) ChangePublicIP(userId string, instanceId string) (stri
 
 	// 使用第一个VNIC更改IP
 	vnicId := details.VnicList[0].VnicID
-	newIP, err := s.ociService.ChangePublicIP(ctx, &user, vnicId)
+	newIP, err := s.ociService.ChangePublicIP(ctx, user, vnicId)
 	if err != nil {
 		return "", fmt.Errorf("failed to change public IP: %w", err)
 	}
@@ -131,21 +152,27 @@ func (s *InstanceService) ChangePublicIP(userId string, instanceId string) (stri
 
 // UpdateInstanceConfig 更新实例配置（CPU和内存）
 // autoRestart: 是否在更新后自动重启实例（如果实例原来是运行状态）
-func (s *InstanceService) UpdateInstanceConfig(userId string, instanceId string, ocpus float32, memoryInGBs float32, autoRestart bool) error {
+func (s *InstanceService) UpdateInstanceConfig(userId string, instanceId string, region string, ocpus float32, memoryInGBs float32, autoRestart bool) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	return s.ociService.UpdateInstanceShape(context.Background(), &user, instanceId, ocpus, memoryInGBs, autoRestart)
 }
 
 // UpdateBootVolumeConfig 更新引导卷配置（通过实例ID）
-func (s *InstanceService) UpdateBootVolumeConfig(userId string, instanceId string, sizeInGBs int64, vpusPerGB int64) error {
+func (s *InstanceService) UpdateBootVolumeConfig(userId string, instanceId string, region string, sizeInGBs int64, vpusPerGB int64) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	ctx := context.Background()
 
@@ -191,11 +218,14 @@ func (s *InstanceService) UpdateBootVolumeById(userId string, bootVolumeId strin
 }
 
 // CreateCloudShellConnection 创建Cloud Shell连接
-func (s *InstanceService) CreateCloudShellConnection(userId string, instanceId string, publicKey string) (map[string]string, error) {
+func (s *InstanceService) CreateCloudShellConnection(userId string, instanceId string, region string, publicKey string) (map[string]string, error) {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	ctx := context.Background()
 
@@ -220,11 +250,14 @@ func (s *InstanceService) CreateCloudShellConnection(userId string, instanceId s
 }
 
 // AttachIPv6 为实例附加IPv6地址
-func (s *InstanceService) AttachIPv6(userId string, instanceId string) (string, error) {
+func (s *InstanceService) AttachIPv6(userId string, instanceId string, region string) (string, error) {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return "", fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	ctx := context.Background()
 	ipv6Address, err := s.ociService.CreateIpv6ByInstanceId(ctx, &user, instanceId)
@@ -236,11 +269,14 @@ func (s *InstanceService) AttachIPv6(userId string, instanceId string) (string,
 }
 
 // AutoRescue 自动救援/缩小硬盘
-func (s *InstanceService) AutoRescue(userId string, instanceId string, instanceName string, keepBackup bool, progressChan chan<- AutoRescueProgress) error {
+func (s *InstanceService) AutoRescue(ctx context.Context, userId string, instanceId string, region string, instanceName string, keepBackup bool, progressChan chan<- AutoRescueProgress) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
 	params := AutoRescueParams{
 		InstanceID:       instanceId,
@@ -248,36 +284,112 @@ func (s *InstanceService) AutoRescue(userId string, instanceId string, instanceN
 		KeepBackupVolume: keepBackup,
 	}
 
-	return s.ociService.AutoRescue(&user, params, progressChan)
+	return s.ociService.AutoRescue(ctx, &user, params, progressChan)
 }
 
 // Enable500Mbps 一键开启下行500Mbps
-func (s *InstanceService) Enable500Mbps(userId string, instanceId string, sshPort int) (string, error) {
+func (s *InstanceService) Enable500Mbps(ctx context.Context, userId string, instanceId string, region string, sshPort int) (string, error) {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return "", fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
-	return s.ociService.Enable500Mbps(&user, instanceId, sshPort)
+	return s.ociService.Enable500Mbps(ctx, &user, instanceId, sshPort)
 }
 
 // Disable500Mbps 关闭下行500Mbps
-func (s *InstanceService) Disable500Mbps(userId string, instanceId string, retainNatGw, retainNlb bool) error {
+func (s *InstanceService) Disable500Mbps(ctx context.Context, userId string, instanceId string, region string, retainNatGw, retainNlb bool) error {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
 
-	return s.ociService.Disable500Mbps(&user, instanceId, retainNatGw, retainNlb)
+	return s.ociService.Disable500Mbps(ctx, &user, instanceId, retainNatGw, retainNlb)
 }
 
 // Check500MbpsSupport 检查实例是否支持500Mbps功能
 // 仅 VM.Standard.E2.1.Micro (AMD) 实例支持此功能
-func (s *InstanceService) Check500MbpsSupport(userId string, instanceId string) (bool, string, error) {
+func (s *InstanceService) Check500MbpsSupport(userId string, instanceId string, region string) (bool, string, error) {
 	var user models.OciUser
 	if err := database.GetDB().Where("id = ?", userId).First(&user).Error; err != nil {
 		return false, "", fmt.Errorf("user not found: %w", err)
 	}
+	if region != "" {
+		user.OciRegion = region
+	}
+
+	return s.ociService.Check500MbpsSupport(context.Background(), &user, instanceId)
+}
+
+// ApplyInstanceCredentials 标记实例是否保存了 root 凭据及是否已查看
+func ApplyInstanceCredentials(instances []models.InstanceInfo) {
+	if len(instances) == 0 {
+		return
+	}
+	ids := make([]string, len(instances))
+	for i, inst := range instances {
+		ids[i] = inst.ID
+	}
+
+	var credentials []models.InstanceCredential
+	database.GetDB().Where("instance_id IN ?", ids).Find(&credentials)
+	credMap := make(map[string]models.InstanceCredential, len(credentials))
+	for _, cred := range credentials {
+		credMap[cred.InstanceID] = cred
+	}
+
+	for i := range instances {
+		if cred, ok := credMap[instances[i].ID]; ok {
+			instances[i].HasRootPassword = true
+			instances[i].PasswordRevealed = cred.Revealed
+			instances[i].SSHPort = cred.SSHPort
+		}
+	}
+}
+
+// InstanceCredentialResult 实例 root 凭据查看结果
+type InstanceCredentialResult struct {
+	InstanceID string `json:"instanceId"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	SSHPort    int    `json:"sshPort"`
+}
+
+// RevealInstancePassword 查看实例 root 密码，每个实例仅允许查看一次
+func (s *InstanceService) RevealInstancePassword(userId string, instanceId string) (*InstanceCredentialResult, error) {
+	db := database.GetDB()
+	var cred models.InstanceCredential
+	if err := db.Where("instance_id = ? AND user_id = ?", instanceId, userId).First(&cred).Error; err != nil {
+		return nil, fmt.Errorf("该实例没有保存的root密码")
+	}
+
+	// 条件更新保证并发请求时只有一个能成功查看
+	now := time.Now()
+	result := db.Model(&models.InstanceCredential{}).
+		Where("id = ? AND revealed = ?", cred.ID, false).
+		Updates(map[string]interface{}{"revealed": true, "reveal_time": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("root密码已查看过，无法再次显示")
+	}
+
+	password, err := DecryptSecret(cred.Password)
+	if err != nil {
+		return nil, err
+	}
 
-	return s.ociService.Check500MbpsSupport(&user, instanceId)
+	return &InstanceCredentialResult{
+		InstanceID: cred.InstanceID,
+		Username:   cred.Username,
+		Password:   password,
+		SSHPort:    cred.SSHPort,
+	}, nil
 }
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+// regionConcurrency 跨区域查询的并发上限
+const regionConcurrency = 4
+
+// InventoryOptions 跨区域资源汇总选项
+type InventoryOptions struct {
+	Instances bool
+	Volumes   bool
+	VCNs      bool
+	// Details 为 true 时返回资源明细，否则只统计数量
+	Details bool
+	// CompartmentID 查询的区间，为空时使用配置的默认区间
+	CompartmentID string
+	// Recursive 为 true 时同时查询所有子区间
+	Recursive bool
+}
+
+// InventoryResult 跨区域资源汇总结果
+type InventoryResult struct {
+	Instances []models.InstanceInfo
+	Volumes   []models.VolumeInfo
+	VCNs      []models.VCNInfo
+	Regions   []models.RegionResourceCount
+}
+
+// Totals 汇总所有区域的实例数量
+func (r *InventoryResult) Totals() (instanceCount, runningInstances int) {
+	for _, region := range r.Regions {
+		instanceCount += region.InstanceCount
+		runningInstances += region.RunningInstances
+	}
+	return
+}
+
+// ListSubscribedRegions 获取租户已订阅且可用的区域，配置所在区域排在首位
+// 查询失败时仅返回配置所在区域
+func (s *OCIService) ListSubscribedRegions(ctx context.Context, user *models.OciUser) []string {
+	regions := []string{user.OciRegion}
+
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return regions
+	}
+	resp, err := identityClient.ListRegionSubscriptions(ctx, identity.ListRegionSubscriptionsRequest{TenancyId: &user.OciTenantID})
+	if err != nil {
+		return regions
+	}
+
+	for _, sub := range resp.Items {
+		if sub.RegionName == nil || *sub.RegionName == user.OciRegion {
+			continue
+		}
+		if sub.Status != identity.RegionSubscriptionStatusReady {
+			continue
+		}
+		regions = append(regions, *sub.RegionName)
+	}
+	return regions
+}
+
+// homeRegionUser 返回切换到主区域的配置副本，IAM 写操作需要在主区域执行
+// 查询失败时返回配置本身所在区域的副本
+func (s *OCIService) homeRegionUser(ctx context.Context, user *models.OciUser) *models.OciUser {
+	homeUser := *user
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return &homeUser
+	}
+	resp, err := identityClient.ListRegionSubscriptions(ctx, identity.ListRegionSubscriptionsRequest{TenancyId: &user.OciTenantID})
+	if err != nil {
+		return &homeUser
+	}
+	for _, sub := range resp.Items {
+		if sub.IsHomeRegion != nil && *sub.IsHomeRegion && sub.RegionName != nil {
+			homeUser.OciRegion = *sub.RegionName
+			break
+		}
+	}
+	return &homeUser
+}
+
+// CollectInventory 汇总多个区域的实例、引导卷和 VCN，regions 为空时查询全部订阅区域
+// 单个区域失败时记录在该区域的 Error 中，全部区域失败才返回错误
+func (s *OCIService) CollectInventory(ctx context.Context, user *models.OciUser, regions []string, opts InventoryOptions) (*InventoryResult, error) {
+	if len(regions) == 0 {
+		regions = s.ListSubscribedRegions(ctx, user)
+	}
+	compartments, err := s.ResolveCompartments(ctx, user, opts.CompartmentID, opts.Recursive)
+	if err != nil {
+		return &InventoryResult{}, err
+	}
+
+	type regionResult struct {
+		count     models.RegionResourceCount
+		instances []models.InstanceInfo
+		volumes   []models.VolumeInfo
+		vcns      []models.VCNInfo
+	}
+	results := make([]regionResult, len(regions))
+
+	semaphore := make(chan struct{}, regionConcurrency)
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(idx int, region string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			// 使用配置副本切换区域，避免并发修改同一个配置
+			regionUser := *user
+			regionUser.OciRegion = region
+			result := &results[idx]
+			result.count.Region = region
+
+			var errs []string
+			if opts.Instances {
+				if err := s.collectRegionInstances(ctx, &regionUser, compartments, opts.Details, &result.count, &result.instances); err != nil {
+					errs = append(errs, "实例: "+err.Error())
+				}
+			}
+			if opts.Volumes {
+				if err := s.collectRegionVolumes(ctx, &regionUser, compartments, opts.Details, &result.count, &result.volumes); err != nil {
+					errs = append(errs, "引导卷: "+err.Error())
+				}
+			}
+			if opts.VCNs {
+				if err := s.collectRegionVCNs(ctx, &regionUser, compartments, opts.Details, &result.count, &result.vcns); err != nil {
+					errs = append(errs, "VCN: "+err.Error())
+				}
+			}
+			result.count.Error = strings.Join(errs, "; ")
+		}(i, region)
+	}
+	wg.Wait()
+
+	inventory := &InventoryResult{
+		Instances: []models.InstanceInfo{},
+		Volumes:   []models.VolumeInfo{},
+		VCNs:      []models.VCNInfo{},
+		Regions:   make([]models.RegionResourceCount, 0, len(results)),
+	}
+	failed := 0
+	for _, result := range results {
+		if result.count.Error != "" {
+			failed++
+		}
+		inventory.Regions = append(inventory.Regions, result.count)
+		inventory.Instances = append(inventory.Instances, result.instances...)
+		inventory.Volumes = append(inventory.Volumes, result.volumes...)
+		inventory.VCNs = append(inventory.VCNs, result.vcns...)
+	}
+
+	if failed == len(results) && failed > 0 {
+		return inventory, fmt.Errorf("所有区域查询失败: %s", results[0].count.Error)
+	}
+	return inventory, nil
+}
+
+func (s *OCIService) collectRegionInstances(ctx context.Context, user *models.OciUser, compartments []string, details bool, count *models.RegionResourceCount, out *[]models.InstanceInfo) error {
+	for _, compartmentID := range compartments {
+		instances, err := s.ListInstances(ctx, user, compartmentID)
+		if err != nil {
+			return err
+		}
+
+		count.InstanceCount += len(instances)
+		var infos []models.InstanceInfo
+		for _, inst := range instances {
+			if inst.LifecycleState == core.InstanceLifecycleStateRunning {
+				count.RunningInstances++
+			}
+			if !details || inst.Id == nil {
+				continue
+			}
+			if detail, err := s.GetInstanceDetails(ctx, user, *inst.Id); err == nil {
+				infos = append(infos, *detail)
+			}
+		}
+		s.fillInstanceMetricSummaries(ctx, user, compartmentID, infos)
+		*out = append(*out, infos...)
+	}
+	return nil
+}
+
+func (s *OCIService) collectRegionVolumes(ctx context.Context, user *models.OciUser, compartments []string, details bool, count *models.RegionResourceCount, out *[]models.VolumeInfo) error {
+	client, err := s.GetBlockstorageClient(user)
+	if err != nil {
+		return err
+	}
+
+	for _, compartmentID := range compartments {
+		if !details {
+			resp, err := client.ListBootVolumes(ctx, core.ListBootVolumesRequest{CompartmentId: &compartmentID})
+			if err != nil {
+				return err
+			}
+			count.VolumeCount += len(resp.Items)
+			continue
+		}
+
+		volumes, err := s.ListBootVolumes(ctx, user, compartmentID)
+		if err != nil {
+			return err
+		}
+		count.VolumeCount += len(volumes)
+		*out = append(*out, volumes...)
+	}
+	return nil
+}
+
+func (s *OCIService) collectRegionVCNs(ctx context.Context, user *models.OciUser, compartments []string, details bool, count *models.RegionResourceCount, out *[]models.VCNInfo) error {
+	client, err := s.GetVirtualNetworkClient(user)
+	if err != nil {
+		return err
+	}
+
+	for _, compartmentID := range compartments {
+		if !details {
+			resp, err := client.ListVcns(ctx, core.ListVcnsRequest{CompartmentId: &compartmentID})
+			if err != nil {
+				return err
+			}
+			count.VcnCount += len(resp.Items)
+			continue
+		}
+
+		vcns, err := s.ListVCNs(ctx, user, compartmentID)
+		if err != nil {
+			return err
+		}
+		count.VcnCount += len(vcns)
+		*out = append(*out, vcns...)
+	}
+	return nil
+}
+
+// RegionStatusNotSubscribed 未订阅区域的状态
+const RegionStatusNotSubscribed = "NOT_SUBSCRIBED"
+
+// ListRegionSubscriptionStatus 列出 OCI 所有区域及租户的订阅状态
+func (s *OCIService) ListRegionSubscriptionStatus(ctx context.Context, user *models.OciUser) ([]models.RegionSubscriptionInfo, error) {
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return nil, err
+	}
+
+	regionsResp, err := identityClient.ListRegions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取区域列表失败: %w", err)
+	}
+	subsResp, err := identityClient.ListRegionSubscriptions(ctx, identity.ListRegionSubscriptionsRequest{TenancyId: &user.OciTenantID})
+	if err != nil {
+		return nil, fmt.Errorf("获取区域订阅失败: %w", err)
+	}
+
+	subscribed := make(map[string]identity.RegionSubscription, len(subsResp.Items))
+	for _, sub := range subsResp.Items {
+		if sub.RegionName != nil {
+			subscribed[*sub.RegionName] = sub
+		}
+	}
+
+	regions := make([]models.RegionSubscriptionInfo, 0, len(regionsResp.Items))
+	for _, region := range regionsResp.Items {
+		if region.Name == nil {
+			continue
+		}
+		info := models.RegionSubscriptionInfo{
+			RegionName: *region.Name,
+			Status:     RegionStatusNotSubscribed,
+		}
+		if region.Key != nil {
+			info.RegionKey = *region.Key
+		}
+		if sub, ok := subscribed[info.RegionName]; ok {
+			info.Status = string(sub.Status)
+			info.IsHomeRegion = sub.IsHomeRegion != nil && *sub.IsHomeRegion
+		}
+		regions = append(regions, info)
+	}
+	return regions, nil
+}
+
+// SubscribeRegion 为租户订阅新区域，订阅请求必须发送到主区域
+func (s *OCIService) SubscribeRegion(ctx context.Context, user *models.OciUser, regionName string) (*models.RegionSubscriptionInfo, error) {
+	regions, err := s.ListRegionSubscriptionStatus(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *models.RegionSubscriptionInfo
+	homeRegion := ""
+	for i := range regions {
+		if regions[i].RegionName == regionName {
+			target = &regions[i]
+		}
+		if regions[i].IsHomeRegion {
+			homeRegion = regions[i].RegionName
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("区域不存在: %s", regionName)
+	}
+	if target.Status != RegionStatusNotSubscribed {
+		return target, nil
+	}
+
+	homeUser := *user
+	if homeRegion != "" {
+		homeUser.OciRegion = homeRegion
+	}
+	identityClient, err := s.GetIdentityClient(&homeUser)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := identityClient.CreateRegionSubscription(ctx, identity.CreateRegionSubscriptionRequest{
+		TenancyId: &user.OciTenantID,
+		CreateRegionSubscriptionDetails: identity.CreateRegionSubscriptionDetails{
+			RegionKey: &target.RegionKey,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("订阅区域失败: %w", err)
+	}
+
+	target.Status = string(resp.Status)
+	if target.Status == "" {
+		target.Status = string(identity.RegionSubscriptionStatusInProgress)
+	}
+	return target, nil
+}
+
+// GetRegionSubscriptionStatus 查询单个区域的订阅状态
+func (s *OCIService) GetRegionSubscriptionStatus(ctx context.Context, user *models.OciUser, regionName string) (string, error) {
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return "", err
+	}
+	resp, err := identityClient.ListRegionSubscriptions(ctx, identity.ListRegionSubscriptionsRequest{TenancyId: &user.OciTenantID})
+	if err != nil {
+		return "", err
+	}
+	for _, sub := range resp.Items {
+		if sub.RegionName != nil && *sub.RegionName == regionName {
+			return string(sub.Status), nil
+		}
+	}
+	return RegionStatusNotSubscribed, nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/logger"
+	"github.com/adiecho/oci-panel/internal/models"
+)
+
+// 后台任务类型
+const (
+	JobKindAutoRescue     = "auto_rescue"
+	JobKindEnable500Mbps  = "enable_500mbps"
+	JobKindDisable500Mbps = "disable_500mbps"
+	JobKindChangePublicIP = "change_public_ip"
+	JobKindDeleteVcn      = "delete_vcn"
+	JobKindBulkInstance   = "bulk_instance_action"
+	JobKindSecurityReport = "security_report"
+)
+
+// AutoRescueJobParams 自动救援任务参数
+type AutoRescueJobParams struct {
+	Region       string `json:"region"`
+	InstanceName string `json:"instanceName"`
+	KeepBackup   bool   `json:"keepBackup"`
+}
+
+// Enable500MbpsJobParams 开启 500Mbps 任务参数
+type Enable500MbpsJobParams struct {
+	Region  string `json:"region"`
+	SSHPort int    `json:"sshPort"`
+}
+
+// Disable500MbpsJobParams 关闭 500Mbps 任务参数
+type Disable500MbpsJobParams struct {
+	Region      string `json:"region"`
+	RetainNatGw bool   `json:"retainNatGw"`
+	RetainNlb   bool   `json:"retainNlb"`
+}
+
+// SecurityReportJobParams 重新生成全部安全报告任务参数
+type SecurityReportJobParams struct {
+	ApiKeyMaxAgeDays int `json:"apiKeyMaxAgeDays"`
+	InactiveDays     int `json:"inactiveDays"`
+}
+
+// ChangePublicIPJobParams 更换公网 IP 任务参数
+type ChangePublicIPJobParams struct {
+	Region string `json:"region"`
+}
+
+// RegisterJobHandlers 注册实例和网络相关的后台任务
+func RegisterJobHandlers(jobs *JobService, ociService *OCIService, instanceService *InstanceService) {
+	jobs.Register(JobKindAutoRescue, JobHandler{
+		TargetKey: "instance_id",
+		Run: func(ctx context.Context, job *Job) (interface{}, error) {
+			var params AutoRescueJobParams
+			if err := job.Params(&params); err != nil {
+				return nil, err
+			}
+
+			progressChan := make(chan AutoRescueProgress, 10)
+			done := make(chan struct{})
+			var publicIP string
+			go func() {
+				defer close(done)
+				for progress := range progressChan {
+					// 不记录 SSHPassword
+					slog.InfoContext(ctx, "Auto rescue progress", "step", progress.Step, "total_steps", progress.TotalSteps,
+						"status", progress.Status, "message", progress.Message, "public_ip", progress.PublicIP)
+					job.SetProgress(fmt.Sprintf("%d/%d %s %s", progress.Step, progress.TotalSteps, progress.Status, progress.Message))
+					if progress.PublicIP != "" {
+						publicIP = progress.PublicIP
+					}
+				}
+			}()
+
+			err := instanceService.AutoRescue(ctx, job.ConfigID(), job.TargetID(), params.Region, params.InstanceName, params.KeepBackup, progressChan)
+			close(progressChan)
+			<-done
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"publicIp": publicIP}, nil
+		},
+	})
+
+	jobs.Register(JobKindEnable500Mbps, JobHandler{
+		TargetKey: "instance_id",
+		Run: func(ctx context.Context, job *Job) (interface{}, error) {
+			params := Enable500MbpsJobParams{SSHPort: 22}
+			if err := job.Params(&params); err != nil {
+				return nil, err
+			}
+			publicIP, err := instanceService.Enable500Mbps(ctx, job.ConfigID(), job.TargetID(), params.Region, params.SSHPort)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"publicIp": publicIP}, nil
+		},
+	})
+
+	jobs.Register(JobKindDisable500Mbps, JobHandler{
+		TargetKey: "instance_id",
+		Run: func(ctx context.Context, job *Job) (interface{}, error) {
+			var params Disable500MbpsJobParams
+			if err := job.Params(&params); err != nil {
+				return nil, err
+			}
+			return nil, instanceService.Disable500Mbps(ctx, job.ConfigID(), job.TargetID(), params.Region, params.RetainNatGw, params.RetainNlb)
+		},
+	})
+
+	// 中断时可能已释放旧 IP 并分配新 IP，重新执行会再次更换，不自动恢复
+	jobs.Register(JobKindChangePublicIP, JobHandler{
+		TargetKey: "instance_id",
+		Run: func(ctx context.Context, job *Job) (interface{}, error) {
+			var params ChangePublicIPJobParams
+			if err := job.Params(&params); err != nil {
+				return nil, err
+			}
+			newIP, err := instanceService.ChangePublicIP(ctx, job.ConfigID(), job.TargetID(), params.Region)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"newIP": newIP}, nil
+		},
+	})
+
+	// 批量操作中断后重新执行可能重复更换 IP，不自动恢复
+	jobs.Register(JobKindBulkInstance, JobHandler{
+		Run: func(ctx context.Context, job *Job) (interface{}, error) {
+			var params BulkActionParams
+			if err := job.Params(&params); err != nil {
+				return nil, err
+			}
+			ctx = logger.With(ctx, "action", params.Action)
+			result := instanceService.ExecuteBulkAction(ctx, params, func(done, total int) {
+				job.SetProgress(fmt.Sprintf("%d/%d", done, total))
+			})
+			slog.InfoContext(ctx, "Bulk instance action finished", "succeeded", result.Succeeded,
+				"failed", result.Failed, "skipped", result.Skipped)
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			return result, nil
+		},
+	})
+
+	jobs.Register(JobKindDeleteVcn, JobHandler{
+		TargetKey: "vcn_id",
+		Resumable: true,
+		Run: func(ctx context.Context, job *Job) (interface{}, error) {
+			var user models.OciUser
+			if err := database.GetDB().Where("id = ?", job.ConfigID()).First(&user).Error; err != nil {
+				return nil, fmt.Errorf("user not found: %w", err)
+			}
+			return nil, ociService.DeleteVcn(ctx, &user, job.TargetID())
+		},
+	})
+}
+
+// RegisterSecurityReportJob 注册重新生成全部配置安全报告的后台任务，结果通过 /api/oci/tenant/securityReport 查询
+func RegisterSecurityReportJob(jobs *JobService, securityService *SecurityReportService) {
+	// 只读扫描，中断后重新执行没有副作用
+	jobs.Register(JobKindSecurityReport, JobHandler{
+		Resumable: true,
+		Run: func(ctx context.Context, job *Job) (interface{}, error) {
+			var params SecurityReportJobParams
+			if err := job.Params(&params); err != nil {
+				return nil, err
+			}
+			reports := securityService.GenerateAll(ctx, SecurityReportOptions{
+				ApiKeyMaxAgeDays: params.ApiKeyMaxAgeDays,
+				InactiveDays:     params.InactiveDays,
+			})
+			findings, high := 0, 0
+			for _, report := range reports {
+				h, _, _ := countSeverities(report.Findings)
+				findings += len(report.Findings)
+				high += h
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return map[string]int{"reports": len(reports), "findings": findings, "high": high}, nil
+		},
+	})
+}
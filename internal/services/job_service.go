@@ -0,0 +1,527 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/logger"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+
+	// DefaultJobWorkers 未配置 jobs.workers 时同时执行的任务数
+	DefaultJobWorkers = 4
+
+	// jobPollInterval 兜底扫描待执行任务的间隔，正常情况下提交任务会立即唤醒调度
+	jobPollInterval = 30 * time.Second
+	// jobRetention 已结束任务的保留时长，更早的记录定期清理
+	jobRetention = 30 * 24 * time.Hour
+	// jobPruneInterval 清理已结束任务的间隔
+	jobPruneInterval = time.Hour
+)
+
+var (
+	ErrJobNotFound    = errors.New("任务不存在")
+	ErrJobFinished    = errors.New("任务已结束")
+	ErrJobNotRetrying = errors.New("只能重试失败或已取消的任务")
+)
+
+// JobHandler 一种后台任务的执行方式
+type JobHandler struct {
+	// Run 执行任务，返回值序列化为 JSON 保存为任务结果；ctx 在任务取消或服务强制关闭时取消
+	Run func(ctx context.Context, job *Job) (interface{}, error)
+	// TargetKey 任务对象 ID 对应的日志字段，如 instance_id，用于实时日志按主题订阅
+	TargetKey string
+	// Resumable 服务重启时中断的任务是否重新排队执行
+	// 非幂等的多步操作（如自动救援）不能从头重做，中断后标记为失败并通知
+	Resumable bool
+}
+
+// Job 执行中的任务
+type Job struct {
+	record models.OciJob
+	op     *Operation
+}
+
+func (j *Job) ID() string       { return j.record.ID }
+func (j *Job) ConfigID() string { return j.record.ConfigID }
+func (j *Job) TargetID() string { return j.record.TargetID }
+func (j *Job) Attempts() int    { return j.record.Attempts }
+
+// Params 解析提交任务时的参数
+func (j *Job) Params(v interface{}) error {
+	if j.record.Params == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(j.record.Params), v)
+}
+
+// SetProgress 更新任务进度
+func (j *Job) SetProgress(progress string) {
+	j.op.SetProgress(progress)
+	database.GetDB().Model(&models.OciJob{}).Where("id = ?", j.record.ID).
+		Updates(map[string]interface{}{"progress": progress, "update_time": time.Now()})
+}
+
+// runningJob 执行中任务的取消句柄，任务被标记为执行中时即登记，cancel 在开始执行后才设置
+type runningJob struct {
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// JobService 持久化的后台任务队列，按并发上限在工作池中执行
+type JobService struct {
+	operations      *OperationRegistry
+	telegramService *TelegramService
+	handlers        map[string]JobHandler
+	slots           chan struct{}
+	wake            chan struct{}
+	jobsMu          sync.Mutex
+	jobs            map[string]*runningJob
+	stopChan        chan struct{}
+	running         bool
+	mutex           sync.Mutex
+}
+
+func NewJobService(operations *OperationRegistry, telegramService *TelegramService, workers int) *JobService {
+	if workers <= 0 {
+		workers = DefaultJobWorkers
+	}
+	return &JobService{
+		operations:      operations,
+		telegramService: telegramService,
+		handlers:        make(map[string]JobHandler),
+		slots:           make(chan struct{}, workers),
+		wake:            make(chan struct{}, 1),
+		jobs:            make(map[string]*runningJob),
+	}
+}
+
+// Register 注册任务类型，需要在 Start 之前调用
+func (s *JobService) Register(kind string, handler JobHandler) {
+	s.handlers[kind] = handler
+}
+
+// Start 恢复上次未完成的任务并开始调度
+func (s *JobService) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.running {
+		return
+	}
+	s.recover()
+	s.running = true
+	s.stopChan = make(chan struct{})
+	go s.dispatch(s.stopChan)
+	slog.Info("Job service started", "workers", cap(s.slots))
+}
+
+// Stop 停止调度新任务，执行中的任务由 OperationRegistry 在关闭时排空
+func (s *JobService) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		return
+	}
+	close(s.stopChan)
+	s.running = false
+	slog.Info("Job service stopped")
+}
+
+// recover 处理上次关闭时仍在执行的任务：可恢复的重新排队，其余标记为失败
+func (s *JobService) recover() {
+	db := database.GetDB()
+	var jobs []models.OciJob
+	if err := db.Where("status = ?", JobStatusRunning).Order("create_time").Find(&jobs).Error; err != nil || len(jobs) == 0 {
+		return
+	}
+
+	var failed []string
+	now := time.Now()
+	for _, job := range jobs {
+		if s.handlers[job.Kind].Resumable {
+			db.Model(&models.OciJob{}).Where("id = ?", job.ID).
+				Updates(map[string]interface{}{"status": JobStatusPending, "update_time": now})
+			slog.Info("Requeued job interrupted by previous shutdown", "job_id", job.ID, "kind", job.Kind,
+				"config_id", job.ConfigID, "target_id", job.TargetID, "progress", job.Progress)
+			continue
+		}
+		db.Model(&models.OciJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":      JobStatusFailed,
+			"error":       "服务重启时任务被中断，请检查资源状态后重试",
+			"end_time":    now,
+			"update_time": now,
+		})
+		slog.Warn("Job was interrupted by previous shutdown", "job_id", job.ID, "kind", job.Kind,
+			"config_id", job.ConfigID, "target_id", job.TargetID, "progress", job.Progress)
+		failed = append(failed, fmt.Sprintf("• %s %s\n  进度：%s", job.Kind, job.TargetID, job.Progress))
+	}
+
+	if len(failed) > 0 && s.telegramService != nil {
+		message := fmt.Sprintf("以下 %d 个任务在上次关闭时未完成，已标记为失败，请检查相关资源状态：\n\n%s", len(failed), html.EscapeString(strings.Join(failed, "\n")))
+		if err := s.telegramService.SendNotification("⚠️ 任务被中断", message); err != nil {
+			slog.Warn("Failed to send interrupted job notification", "error", err)
+		}
+	}
+}
+
+// Submit 提交任务，params 序列化为 JSON 保存
+func (s *JobService) Submit(ctx context.Context, kind, configID, targetID string, params interface{}) (*models.OciJob, error) {
+	if _, ok := s.handlers[kind]; !ok {
+		return nil, fmt.Errorf("未知的任务类型: %s", kind)
+	}
+	var paramsJSON string
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("任务参数无效: %w", err)
+		}
+		paramsJSON = string(data)
+	}
+
+	now := time.Now()
+	job := models.OciJob{
+		ID:         uuid.New().String(),
+		Kind:       kind,
+		ConfigID:   configID,
+		TargetID:   targetID,
+		Params:     paramsJSON,
+		Status:     JobStatusPending,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := database.GetDB().Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("保存任务失败: %w", err)
+	}
+	slog.InfoContext(ctx, "Job submitted", "job_id", job.ID, "kind", kind, "config_id", configID, "target_id", targetID)
+	s.notify()
+	return &job, nil
+}
+
+// Get 查询任务
+func (s *JobService) Get(id string) (*models.OciJob, error) {
+	var job models.OciJob
+	if err := database.GetDB().Where("id = ?", id).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// JobFilter 任务列表筛选条件，空字段不筛选
+type JobFilter struct {
+	ConfigID string
+	TargetID string
+	Kind     string
+	Status   string
+}
+
+// List 分页查询任务，按创建时间倒序
+func (s *JobService) List(filter JobFilter, page, pageSize int) ([]models.OciJob, int64, error) {
+	query := database.GetDB().Model(&models.OciJob{})
+	if filter.ConfigID != "" {
+		query = query.Where("config_id = ?", filter.ConfigID)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var jobs []models.OciJob
+	err := query.Order("create_time DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&jobs).Error
+	return jobs, total, err
+}
+
+// Cancel 取消任务：排队中的直接取消，执行中的通知其停止，已完成的步骤不会回滚
+func (s *JobService) Cancel(id string) (*models.OciJob, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch job.Status {
+	case JobStatusPending:
+		now := time.Now()
+		result := database.GetDB().Model(&models.OciJob{}).Where("id = ? AND status = ?", id, JobStatusPending).
+			Updates(map[string]interface{}{"status": JobStatusCancelled, "end_time": now, "update_time": now})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 刚被调度执行，按执行中处理
+			return s.Cancel(id)
+		}
+	case JobStatusRunning:
+		s.jobsMu.Lock()
+		rj, ok := s.jobs[id]
+		if ok {
+			rj.cancelled = true
+			if rj.cancel != nil {
+				rj.cancel()
+			}
+		}
+		s.jobsMu.Unlock()
+		if !ok {
+			return nil, ErrJobFinished
+		}
+	default:
+		return nil, ErrJobFinished
+	}
+
+	slog.Info("Job cancel requested", "job_id", id, "kind", job.Kind, "status", job.Status)
+	return s.Get(id)
+}
+
+// Retry 重新排队失败或已取消的任务，沿用原参数
+func (s *JobService) Retry(id string) (*models.OciJob, error) {
+	now := time.Now()
+	result := database.GetDB().Model(&models.OciJob{}).
+		Where("id = ? AND status IN ?", id, []string{JobStatusFailed, JobStatusCancelled}).
+		Updates(map[string]interface{}{
+			"status":      JobStatusPending,
+			"progress":    "",
+			"result":      "",
+			"error":       "",
+			"start_time":  nil,
+			"end_time":    nil,
+			"update_time": now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobNotRetrying
+	}
+	slog.Info("Job requeued", "job_id", id)
+	s.notify()
+	return s.Get(id)
+}
+
+func (s *JobService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *JobService) dispatch(stop <-chan struct{}) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(jobPruneInterval)
+	defer pruneTicker.Stop()
+	s.prune()
+	for {
+		s.startPending(stop)
+		select {
+		case <-stop:
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		case <-pruneTicker.C:
+			s.prune()
+		}
+	}
+}
+
+// prune 清理结束超过保留期的任务记录，待执行和执行中的任务不受影响
+func (s *JobService) prune() {
+	result := database.GetDB().
+		Where("status IN ? AND end_time < ?", []string{JobStatusSucceeded, JobStatusFailed, JobStatusCancelled}, time.Now().Add(-jobRetention)).
+		Delete(&models.OciJob{})
+	if result.Error != nil {
+		slog.Warn("Failed to prune jobs", "error", result.Error)
+	} else if result.RowsAffected > 0 {
+		slog.Info("Pruned finished jobs", "count", result.RowsAffected)
+	}
+}
+
+// startPending 在有空闲工作槽时按提交顺序启动待执行的任务
+func (s *JobService) startPending(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case s.slots <- struct{}{}:
+		default:
+			return
+		}
+		job, ok := s.claimNext()
+		if !ok {
+			<-s.slots
+			return
+		}
+		go s.execute(job)
+	}
+}
+
+// claimNext 把最早的待执行任务标记为执行中
+func (s *JobService) claimNext() (models.OciJob, bool) {
+	db := database.GetDB()
+	for {
+		var job models.OciJob
+		if err := db.Where("status = ?", JobStatusPending).Order("create_time").First(&job).Error; err != nil {
+			return job, false
+		}
+		now := time.Now()
+		// 标记执行中和登记取消句柄在同一把锁内完成，Cancel 看到执行中状态时一定能找到句柄
+		s.jobsMu.Lock()
+		result := db.Model(&models.OciJob{}).Where("id = ? AND status = ?", job.ID, JobStatusPending).
+			Updates(map[string]interface{}{
+				"status":      JobStatusRunning,
+				"attempts":    gorm.Expr("attempts + 1"),
+				"start_time":  now,
+				"update_time": now,
+			})
+		if result.Error == nil && result.RowsAffected == 1 {
+			s.jobs[job.ID] = &runningJob{}
+		}
+		s.jobsMu.Unlock()
+		if result.Error != nil {
+			slog.Warn("Failed to claim job", "job_id", job.ID, "error", result.Error)
+			return job, false
+		}
+		if result.RowsAffected == 1 {
+			job.Status = JobStatusRunning
+			job.Attempts++
+			job.StartTime = &now
+			return job, true
+		}
+	}
+}
+
+func (s *JobService) execute(record models.OciJob) {
+	defer func() {
+		<-s.slots
+		s.notify()
+	}()
+
+	db := database.GetDB()
+	handler, ok := s.handlers[record.Kind]
+	if !ok {
+		s.release(record.ID)
+		s.finish(record.ID, JobStatusFailed, "", "未知的任务类型: "+record.Kind)
+		return
+	}
+
+	ctx, op, err := s.operations.Attach(context.Background(), record.Kind, record.ConfigID, record.TargetID)
+	if err != nil {
+		if s.release(record.ID) {
+			s.finish(record.ID, JobStatusCancelled, "", "任务已取消")
+			return
+		}
+		// 服务正在关闭，放回队列，下次启动时执行
+		db.Model(&models.OciJob{}).Where("id = ?", record.ID).
+			Updates(map[string]interface{}{"status": JobStatusPending, "attempts": gorm.Expr("attempts - 1"), "update_time": time.Now()})
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.jobsMu.Lock()
+	rj := s.jobs[record.ID]
+	rj.cancel = cancel
+	cancelledEarly := rj.cancelled
+	s.jobsMu.Unlock()
+	if cancelledEarly {
+		// 标记执行中之后、开始执行之前已被取消，不再执行
+		cancel()
+		s.release(record.ID)
+		op.Finish(context.Canceled)
+		s.finish(record.ID, JobStatusCancelled, "", "任务已取消")
+		return
+	}
+
+	ctx = logger.With(ctx, "job_id", record.ID, "config_id", record.ConfigID)
+	if handler.TargetKey != "" {
+		ctx = logger.With(ctx, handler.TargetKey, record.TargetID)
+	}
+	slog.InfoContext(ctx, "Job started", "attempt", record.Attempts)
+
+	result, err := s.run(ctx, handler, &Job{record: record, op: op})
+
+	cancel()
+	cancelled := s.release(record.ID)
+	op.Finish(err)
+
+	// 失败或取消时也保存部分结果，如批量操作中已完成实例的结果
+	var resultJSON string
+	if result != nil {
+		if data, err := json.Marshal(result); err == nil {
+			resultJSON = string(data)
+		}
+	}
+	switch {
+	case cancelled:
+		s.finish(record.ID, JobStatusCancelled, resultJSON, "任务已取消")
+		slog.InfoContext(ctx, "Job cancelled")
+	case err != nil && s.operations.Context().Err() != nil:
+		// 服务强制关闭导致中断，保持执行中状态，下次启动时按 Resumable 恢复
+		slog.WarnContext(ctx, "Job interrupted by shutdown", "error", err)
+	case err != nil:
+		s.finish(record.ID, JobStatusFailed, resultJSON, err.Error())
+		slog.ErrorContext(ctx, "Job failed", "error", err)
+	default:
+		s.finish(record.ID, JobStatusSucceeded, resultJSON, "")
+		slog.InfoContext(ctx, "Job succeeded")
+	}
+}
+
+// release 注销任务的取消句柄，返回任务是否已被请求取消
+func (s *JobService) release(id string) bool {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	rj, ok := s.jobs[id]
+	delete(s.jobs, id)
+	return ok && rj.cancelled
+}
+
+// run 执行任务，panic 视为失败，避免拖垮工作池
+func (s *JobService) run(ctx context.Context, handler JobHandler, job *Job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务异常: %v", r)
+		}
+	}()
+	return handler.Run(ctx, job)
+}
+
+func (s *JobService) finish(id, status, result, errMsg string) {
+	now := time.Now()
+	database.GetDB().Model(&models.OciJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"result":      result,
+		"error":       errMsg,
+		"end_time":    now,
+		"update_time": now,
+	})
+}
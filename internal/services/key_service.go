@@ -0,0 +1,107 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// GenerateSSHKeyPair 生成 SSH 密钥对，返回 authorized_keys 格式公钥和 OpenSSH 格式私钥
+// algorithm 支持 ed25519 和 rsa，rsa 位数为 0 时默认 4096
+func GenerateSSHKeyPair(algorithm string, bits int, comment string) (publicKey, privateKey string, err error) {
+	var signer interface{}
+	var pub interface{}
+
+	switch strings.ToLower(algorithm) {
+	case "", "ed25519":
+		edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", "", fmt.Errorf("生成ed25519密钥失败: %w", err)
+		}
+		signer, pub = edPriv, edPub
+	case "rsa":
+		if bits == 0 {
+			bits = 4096
+		}
+		if bits != 2048 && bits != 3072 && bits != 4096 {
+			return "", "", fmt.Errorf("RSA密钥长度仅支持 2048/3072/4096")
+		}
+		rsaPriv, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return "", "", fmt.Errorf("生成RSA密钥失败: %w", err)
+		}
+		signer, pub = rsaPriv, &rsaPriv.PublicKey
+	default:
+		return "", "", fmt.Errorf("不支持的密钥算法: %s", algorithm)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return "", "", err
+	}
+	block, err := ssh.MarshalPrivateKey(signer, comment)
+	if err != nil {
+		return "", "", err
+	}
+
+	publicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub)))
+	if comment != "" {
+		publicKey += " " + comment
+	}
+	return publicKey, string(pem.EncodeToMemory(block)), nil
+}
+
+// ParseSSHPublicKey 解析 authorized_keys 格式公钥，返回算法类型和 SHA256 指纹
+func ParseSSHPublicKey(publicKey string) (algorithm, fingerprint string, err error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(publicKey)))
+	if err != nil {
+		return "", "", fmt.Errorf("公钥格式无效: %w", err)
+	}
+	return pub.Type(), ssh.FingerprintSHA256(pub), nil
+}
+
+// JoinAuthorizedKeys 合并多个公钥为 ssh_authorized_keys 元数据格式
+func JoinAuthorizedKeys(publicKeys []string) string {
+	keys := make([]string, 0, len(publicKeys))
+	for _, key := range publicKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return strings.Join(keys, "\n")
+}
+
+// BackfillSSHKeyFingerprints 为旧版本保存的缺少指纹的公钥补全算法和指纹，启动时执行一次
+func BackfillSSHKeyFingerprints() {
+	db := database.GetDB()
+	var keys []models.SSHKey
+	if err := db.Where("fingerprint = '' OR fingerprint IS NULL").Find(&keys).Error; err != nil {
+		slog.Warn("Failed to load SSH keys for fingerprint backfill", "error", err)
+		return
+	}
+	updated := 0
+	for i := range keys {
+		algorithm, fingerprint, err := ParseSSHPublicKey(keys[i].PublicKey)
+		if err != nil {
+			slog.Warn("Failed to parse stored SSH public key", "key_id", keys[i].ID, "error", err)
+			continue
+		}
+		if err := db.Model(&keys[i]).Updates(map[string]interface{}{
+			"algorithm":   algorithm,
+			"fingerprint": fingerprint,
+		}).Error; err == nil {
+			updated++
+		}
+	}
+	if updated > 0 {
+		slog.Info("Backfilled SSH key fingerprints", "count", updated)
+	}
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/metrics"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+var (
+	ociRequestDuration = metrics.NewHistogramVec(
+		"oci_panel_oci_request_duration_seconds",
+		"OCI API request latency by service and operation, including SDK retries as separate requests.",
+		[]float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60},
+		"service", "operation",
+	)
+	ociRequestsTotal = metrics.NewCounterVec(
+		"oci_panel_oci_requests_total",
+		"OCI API requests by service, operation and response code class (2xx, 4xx, 5xx, network).",
+		"service", "operation", "code",
+	)
+	cacheRefreshDuration = metrics.NewHistogramVec(
+		"oci_panel_cache_refresh_duration_seconds",
+		"Duration of scheduler config cache refreshes.",
+		nil,
+		"result",
+	)
+
+	taskExecutionsTotal = metrics.NewCounterVec(
+		"oci_panel_task_executions_total",
+		"Instance creation task attempts since process start, by config and result.",
+		"config_id", "config", "result",
+	)
+	taskFailuresTotal = metrics.NewCounterVec(
+		"oci_panel_task_failures_total",
+		"Failed instance creation task attempts since process start, by config and error class.",
+		"config_id", "config", "class",
+	)
+	_ = metrics.NewGaugeFunc(
+		"oci_panel_config_instances",
+		"Instances in the cached inventory of each config.",
+		[]string{"config_id", "config"},
+		func() []metrics.Sample {
+			return collectConfigCache(func(c models.OciConfigCache) float64 { return float64(c.InstanceCount) })
+		},
+	)
+	_ = metrics.NewGaugeFunc(
+		"oci_panel_config_running_instances",
+		"Running instances in the cached inventory of each config.",
+		[]string{"config_id", "config"},
+		func() []metrics.Sample {
+			return collectConfigCache(func(c models.OciConfigCache) float64 { return float64(c.RunningInstances) })
+		},
+	)
+	_ = metrics.NewGaugeFunc(
+		"oci_panel_config_cache_updated_timestamp_seconds",
+		"Unix time of the last cache refresh of each config.",
+		[]string{"config_id", "config"},
+		func() []metrics.Sample {
+			return collectConfigCache(func(c models.OciConfigCache) float64 { return float64(c.UpdateTime.Unix()) })
+		},
+	)
+	_ = metrics.NewGaugeFunc(
+		"oci_panel_config_health",
+		"Credential health of each config: 1 for the current status label (ok, invalid, error, unknown).",
+		[]string{"config_id", "config", "status"},
+		collectConfigHealth,
+	)
+	_ = metrics.NewGaugeFunc(
+		"oci_panel_traffic_month_bytes",
+		"VNIC traffic of the current UTC month collected by the traffic history service, by config and direction.",
+		[]string{"config_id", "config", "direction"},
+		collectMonthlyTraffic,
+	)
+)
+
+// instrumentedDispatcher 记录每次 OCI API 请求的耗时和结果
+type instrumentedDispatcher struct {
+	next common.HTTPRequestDispatcher
+}
+
+func (d *instrumentedDispatcher) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := d.next.Do(req)
+	service, operation := ociOperation(req)
+	ociRequestDuration.Observe(time.Since(start).Seconds(), service, operation)
+	code := "network"
+	if err == nil && resp != nil {
+		code = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	ociRequestsTotal.Inc(service, operation, code)
+	return resp, err
+}
+
+// instrumentClient 为 SDK 客户端挂载请求指标
+func instrumentClient(client *common.BaseClient) {
+	if client.HTTPClient == nil {
+		return
+	}
+	if _, ok := client.HTTPClient.(*instrumentedDispatcher); ok {
+		return
+	}
+	client.HTTPClient = &instrumentedDispatcher{next: client.HTTPClient}
+}
+
+var ociVersionSegment = regexp.MustCompile(`^\d{8}$`)
+
+// ociOperation 从请求中提取服务名和去除资源 ID 的操作名，如 iaas / "POST /instances/{id}"
+func ociOperation(req *http.Request) (string, string) {
+	host := req.URL.Hostname()
+	service := host
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		service = host[:i]
+	}
+	if strings.HasPrefix(service, "idcs-") {
+		service = "identitydomains"
+	}
+
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	parts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		switch {
+		case seg == "":
+			continue
+		case ociVersionSegment.MatchString(seg):
+			continue
+		case isResourceSegment(seg):
+			parts = append(parts, "{id}")
+		default:
+			parts = append(parts, seg)
+		}
+	}
+	return service, req.Method + " /" + strings.Join(parts, "/")
+}
+
+// isResourceSegment 判断路径片段是否为 OCID、UUID 等资源标识
+func isResourceSegment(seg string) bool {
+	if strings.HasPrefix(seg, "ocid1.") || strings.Contains(seg, "%") {
+		return true
+	}
+	if len(seg) < 16 {
+		return false
+	}
+	digits := 0
+	for _, r := range seg {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits > 0
+}
+
+// classifyTaskError 按错误信息归类任务失败原因
+func classifyTaskError(message string) string {
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "capacity"):
+		return "capacity"
+	case strings.Contains(msg, "too many requests") || strings.Contains(msg, "toomanyrequests"):
+		return "rate_limit"
+	case strings.Contains(msg, "limitexceeded") || strings.Contains(msg, "limit") || strings.Contains(msg, "quota"):
+		return "limit"
+	case strings.Contains(msg, "notauthenticated") || strings.Contains(msg, "notauthorized") ||
+		strings.Contains(msg, "authorization") || strings.Contains(msg, "authenticat"):
+		return "auth"
+	case strings.Contains(msg, "不存在") || strings.Contains(msg, "invalidparameter"):
+		return "config"
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "connection"):
+		return "network"
+	}
+	return "other"
+}
+
+// metricConfigNames 配置 ID 到配置名称的映射，用作指标标签
+func metricConfigNames() map[string]string {
+	var users []models.OciUser
+	database.GetDB().Select("id", "username").Find(&users)
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names
+}
+
+// metricConfigLabels 返回配置 ID 和配置名称两个标签值，配置名称不唯一，需要配合 ID 区分
+func metricConfigLabels(names map[string]string, configID string, extra ...string) []string {
+	name := names[configID]
+	if name == "" {
+		name = configID
+	}
+	return append([]string{configID, name}, extra...)
+}
+
+// recordTaskExecution 在写入任务日志时累加执行次数，失败时按错误类型累加失败次数
+func recordTaskExecution(configID, status, message string) {
+	if status != "success" && status != "error" {
+		return
+	}
+	var user models.OciUser
+	database.GetDB().Select("id", "username").Where("id = ?", configID).Limit(1).Find(&user)
+	labels := metricConfigLabels(map[string]string{user.ID: user.Username}, configID)
+	taskExecutionsTotal.Inc(append(labels, status)...)
+	if status == "error" {
+		taskFailuresTotal.Inc(append(labels, classifyTaskError(message))...)
+	}
+}
+
+func collectConfigCache(value func(models.OciConfigCache) float64) []metrics.Sample {
+	names := metricConfigNames()
+	var caches []models.OciConfigCache
+	database.GetDB().Select("config_id", "instance_count", "running_instances", "update_time").Find(&caches)
+	samples := make([]metrics.Sample, 0, len(caches))
+	for _, c := range caches {
+		if _, ok := names[c.ConfigID]; !ok {
+			continue
+		}
+		samples = append(samples, metrics.Sample{LabelValues: metricConfigLabels(names, c.ConfigID), Value: value(c)})
+	}
+	return samples
+}
+
+func collectConfigHealth() []metrics.Sample {
+	var users []models.OciUser
+	database.GetDB().Select("id", "username", "health_status").Find(&users)
+	samples := make([]metrics.Sample, 0, len(users))
+	for _, u := range users {
+		status := u.HealthStatus
+		if status == "" {
+			status = "unknown"
+		}
+		samples = append(samples, metrics.Sample{LabelValues: metricConfigLabels(map[string]string{u.ID: u.Username}, u.ID, status), Value: 1})
+	}
+	return samples
+}
+
+func collectMonthlyTraffic() []metrics.Sample {
+	names := metricConfigNames()
+	var rows []struct {
+		ConfigID string
+		InBytes  float64
+		OutBytes float64
+	}
+	database.GetDB().Model(&models.OciTrafficSample{}).
+		Select("config_id, SUM(in_bytes) AS in_bytes, SUM(out_bytes) AS out_bytes").
+		Where("resolution = ? AND bucket_time = ?", TrafficResolutionMonth, trafficBucketStart(time.Now(), TrafficResolutionMonth)).
+		Group("config_id").
+		Scan(&rows)
+	samples := make([]metrics.Sample, 0, len(rows)*2)
+	for _, row := range rows {
+		samples = append(samples,
+			metrics.Sample{LabelValues: metricConfigLabels(names, row.ConfigID, "in"), Value: row.InBytes},
+			metrics.Sample{LabelValues: metricConfigLabels(names, row.ConfigID, "out"), Value: row.OutBytes},
+		)
+	}
+	return samples
+}
@@ -2,9 +2,12 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/adiecho/oci-panel/internal/config"
@@ -62,6 +65,7 @@ func (s *OCIService) GetComputeClient(user *models.OciUser) (core.ComputeClient,
 	if err != nil {
 		return core.ComputeClient{}, err
 	}
+	instrumentClient(&client.BaseClient)
 
 	return client, nil
 }
@@ -76,6 +80,7 @@ func (s *OCIService) GetVirtualNetworkClient(user *models.OciUser) (core.Virtual
 	if err != nil {
 		return core.VirtualNetworkClient{}, err
 	}
+	instrumentClient(&client.BaseClient)
 
 	return client, nil
 }
@@ -90,6 +95,7 @@ func (s *OCIService) GetBlockstorageClient(user *models.OciUser) (core.Blockstor
 	if err != nil {
 		return core.BlockstorageClient{}, err
 	}
+	instrumentClient(&client.BaseClient)
 
 	return client, nil
 }
@@ -104,6 +110,7 @@ func (s *OCIService) GetIdentityClient(user *models.OciUser) (identity.IdentityC
 	if err != nil {
 		return identity.IdentityClient{}, err
 	}
+	instrumentClient(&client.BaseClient)
 
 	return client, nil
 }
@@ -118,6 +125,7 @@ func (s *OCIService) GetIdentityDomainsClient(user *models.OciUser, endpoint str
 	if err != nil {
 		return identitydomains.IdentityDomainsClient{}, err
 	}
+	instrumentClient(&client.BaseClient)
 
 	return client, nil
 }
@@ -216,6 +224,7 @@ type LaunchInstanceParams struct {
 	SshPublicKey       string
 	BootVolumeSizeGBs  int64
 	BootVolumeVpuPerGB int64
+	UserData           string // cloud-init 用户数据原文，LaunchInstance 负责 base64 编码
 }
 
 func (s *OCIService) LaunchInstance(ctx context.Context, user *models.OciUser, params LaunchInstanceParams) (*core.Instance, error) {
@@ -245,15 +254,21 @@ func (s *OCIService) LaunchInstance(ctx context.Context, user *models.OciUser, p
 			CreateVnicDetails: &core.CreateVnicDetails{
 				SubnetId: &params.SubnetId,
 			},
-			ShapeConfig: &core.LaunchInstanceShapeConfigDetails{
-				Ocpus:       &params.Ocpus,
-				MemoryInGBs: &params.MemoryInGBs,
-			},
 			Metadata: map[string]string{
 				"ssh_authorized_keys": params.SshPublicKey,
 			},
 		},
 	}
+	if params.UserData != "" {
+		req.LaunchInstanceDetails.Metadata["user_data"] = base64.StdEncoding.EncodeToString([]byte(params.UserData))
+	}
+	// 固定规格不允许指定 ShapeConfig，仅 Flex 规格设置 OCPU 和内存
+	if params.Ocpus > 0 {
+		req.LaunchInstanceDetails.ShapeConfig = &core.LaunchInstanceShapeConfigDetails{
+			Ocpus:       &params.Ocpus,
+			MemoryInGBs: &params.MemoryInGBs,
+		}
+	}
 
 	resp, err := client.LaunchInstance(ctx, req)
 	if err != nil {
@@ -263,37 +278,161 @@ func (s *OCIService) LaunchInstance(ctx context.Context, user *models.OciUser, p
 	return &resp.Instance, nil
 }
 
+// CreateInstanceParams 自动创建实例参数
+type CreateInstanceParams struct {
+	Region          string
+	Architecture    string
+	Shape           string // 为空时按 Architecture 选择默认规格
+	OperationSystem string
+	Ocpus           float64
+	Memory          float64
+	Disk            int
+	VpusPerGB       int64
+	SSHPublicKey    string
+	ImageID         string
+	UserData        string // 用户数据模板内容，创建时替换模板变量
+	RootPassword    string // 非空时通过 cloud-init 启用 root 密码登录
+	SSHPort         int    // 自定义 SSH 端口，0 或 22 表示不修改，只在设置 RootPassword 时生效
+	CompartmentID   string // 为空时使用配置的默认区间
+}
+
+// MaxUserDataSize OCI 限制 user_data 元数据最大 32KB
+const MaxUserDataSize = 32000
+
+// UserDataVars 用户数据模板变量
+type UserDataVars struct {
+	Hostname  string
+	Region    string
+	PublicKey string
+}
+
+// RenderUserData 替换用户数据模板中的 {{hostname}}、{{region}}、{{public_key}} 变量
+func RenderUserData(content string, vars UserDataVars) string {
+	return strings.NewReplacer(
+		"{{hostname}}", vars.Hostname,
+		"{{region}}", vars.Region,
+		"{{public_key}}", vars.PublicKey,
+	).Replace(content)
+}
+
+// ValidateUserData 校验用户数据模板大小（按 base64 编码后的长度计算）
+func ValidateUserData(content string) error {
+	if base64.StdEncoding.EncodedLen(len(content)) > MaxUserDataSize {
+		return fmt.Errorf("用户数据过大，base64 编码后不能超过 %d 字节", MaxUserDataSize)
+	}
+	return nil
+}
+
+// ValidateRootLogin 校验自定义 root 密码与 SSH 端口
+func ValidateRootLogin(password string, sshPort int) error {
+	if password != "" && len(password) < 8 {
+		return fmt.Errorf("root密码长度不能少于8位")
+	}
+	if sshPort < 0 || sshPort > 65535 {
+		return fmt.Errorf("SSH端口无效: %d", sshPort)
+	}
+	return nil
+}
+
+// ValidateSSHPort 自定义 SSH 端口由启用 root 登录的 cloud-init 脚本修改，未启用 root 登录时不能单独设置
+func ValidateSSHPort(enableRootLogin bool, sshPort int) error {
+	if !enableRootLogin && sshPort > 0 && sshPort != 22 {
+		return fmt.Errorf("自定义SSH端口需要同时启用root登录")
+	}
+	return nil
+}
+
+// BuildRootLoginScript 生成启用 root 密码登录（可选修改 SSH 端口）的 cloud-init 脚本
+func BuildRootLoginScript(password string, sshPort int) string {
+	// 密码以 base64 传入，避免 shell 转义问题
+	cred := base64.StdEncoding.EncodeToString([]byte("root:" + password))
+
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	b.WriteString("echo '" + cred + "' | base64 -d | chpasswd\n")
+	b.WriteString("sed -i 's/^#\\?PermitRootLogin.*/PermitRootLogin yes/' /etc/ssh/sshd_config\n")
+	b.WriteString("sed -i 's/^#\\?PasswordAuthentication.*/PasswordAuthentication yes/' /etc/ssh/sshd_config\n")
+	b.WriteString("rm -f /etc/ssh/sshd_config.d/*cloudimg-settings.conf\n")
+	b.WriteString("mkdir -p /etc/ssh/sshd_config.d\n")
+	b.WriteString("printf 'PermitRootLogin yes\\nPasswordAuthentication yes\\n' > /etc/ssh/sshd_config.d/00-oci-panel.conf\n")
+	if sshPort > 0 && sshPort != 22 {
+		port := fmt.Sprintf("%d", sshPort)
+		b.WriteString("printf 'Port " + port + "\\n' >> /etc/ssh/sshd_config.d/00-oci-panel.conf\n")
+		b.WriteString("grep -q '^Include /etc/ssh/sshd_config.d' /etc/ssh/sshd_config || sed -i 's/^#\\?Port .*/Port " + port + "/' /etc/ssh/sshd_config\n")
+		// Ubuntu 22.10+ 使用 socket 激活，监听端口不读取 sshd_config
+		b.WriteString("if systemctl is-enabled ssh.socket >/dev/null 2>&1; then systemctl disable --now ssh.socket; systemctl enable ssh.service; fi\n")
+		b.WriteString("command -v semanage >/dev/null 2>&1 && semanage port -a -t ssh_port_t -p tcp " + port + "\n")
+		b.WriteString("command -v firewall-cmd >/dev/null 2>&1 && firewall-cmd --permanent --add-port=" + port + "/tcp && firewall-cmd --reload\n")
+		b.WriteString("if command -v iptables >/dev/null 2>&1; then iptables -I INPUT -p tcp --dport " + port + " -j ACCEPT; [ -d /etc/iptables ] && iptables-save > /etc/iptables/rules.v4; fi\n")
+	}
+	b.WriteString("systemctl restart sshd 2>/dev/null || systemctl restart ssh\n")
+	return b.String()
+}
+
+// MergeUserData 将用户数据模板与附加脚本合并为 cloud-init multipart 格式
+func MergeUserData(userData, script string) string {
+	if userData == "" {
+		return script
+	}
+
+	const boundary = "==OCI-PANEL-BOUNDARY=="
+	partType := func(content string) string {
+		if strings.HasPrefix(content, "#cloud-config") {
+			return "text/cloud-config"
+		}
+		return "text/x-shellscript"
+	}
+
+	var b strings.Builder
+	b.WriteString("Content-Type: multipart/mixed; boundary=\"" + boundary + "\"\nMIME-Version: 1.0\n")
+	for _, part := range []string{userData, script} {
+		b.WriteString("\n--" + boundary + "\n")
+		b.WriteString("Content-Type: " + partType(part) + "; charset=\"utf-8\"\n\n")
+		b.WriteString(part)
+		if !strings.HasSuffix(part, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("\n--" + boundary + "--\n")
+	return b.String()
+}
+
 // CreateInstance 自动创建实例（自动获取AD、VCN、子网，可指定镜像ID）
-func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, region, architecture, operationSystem string, ocpus, memory float64, disk int, vpusPerGB int64, sshPublicKey string, imageIdParam string) error {
+func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, params CreateInstanceParams) (*core.Instance, error) {
 	// 临时切换用户区域
 	originalRegion := user.OciRegion
-	user.OciRegion = region
+	user.OciRegion = params.Region
 	defer func() { user.OciRegion = originalRegion }()
 
-	compartmentId := user.OciTenantID
+	compartmentId := params.CompartmentID
+	if compartmentId == "" {
+		compartmentId = user.ResourceCompartmentID()
+	}
 
-	// 1. 获取身份客户端
-	identityClient, err := s.GetIdentityClient(user)
-	if err != nil {
-		return fmt.Errorf("获取身份客户端失败: %w", err)
+	// 1. 确定Shape
+	shape := params.Shape
+	if shape == "" {
+		shape = DefaultShape(params.Architecture)
 	}
 
-	// 2. 获取可用域列表
-	adResp, err := identityClient.ListAvailabilityDomains(ctx, identity.ListAvailabilityDomainsRequest{
-		CompartmentId: &compartmentId,
-	})
+	// 2. 查找提供该规格的可用域并校验 OCPU/内存
+	shapeInfo, err := s.findShape(ctx, user, compartmentId, shape)
 	if err != nil {
-		return fmt.Errorf("获取可用域失败: %w", err)
+		return nil, err
 	}
-	if len(adResp.Items) == 0 {
-		return fmt.Errorf("没有可用的可用域")
+	if err := ValidateShapeConfig(shapeInfo, params.Ocpus, params.Memory); err != nil {
+		return nil, err
+	}
+	availabilityDomain := shapeInfo.AvailabilityDomain
+	ocpus, memory := float32(params.Ocpus), float32(params.Memory)
+	if !shapeInfo.IsFlexible {
+		ocpus, memory = 0, 0
 	}
-	availabilityDomain := *adResp.Items[0].Name
 
 	// 3. 获取或创建VCN和子网
 	vnClient, err := s.GetVirtualNetworkClient(user)
 	if err != nil {
-		return fmt.Errorf("获取网络客户端失败: %w", err)
+		return nil, fmt.Errorf("获取网络客户端失败: %w", err)
 	}
 
 	// 列出现有VCN（只获取Available状态的VCN）
@@ -303,7 +442,7 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 		LifecycleState: vcnLifecycleState,
 	})
 	if err != nil {
-		return fmt.Errorf("获取VCN列表失败: %w", err)
+		return nil, fmt.Errorf("获取VCN列表失败: %w", err)
 	}
 
 	var subnetId string
@@ -352,7 +491,7 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 				},
 			})
 			if err != nil {
-				return fmt.Errorf("创建VCN失败: %w", err)
+				return nil, fmt.Errorf("创建VCN失败: %w", err)
 			}
 			// 等待VCN创建完成
 			for i := 0; i < 30; i++ {
@@ -364,7 +503,7 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 				time.Sleep(time.Second)
 			}
 			if targetVcn == nil {
-				return fmt.Errorf("等待VCN创建超时")
+				return nil, fmt.Errorf("等待VCN创建超时")
 			}
 		} else {
 			// 使用现有VCN的CIDR（使用CidrBlocks替代已弃用的CidrBlock）
@@ -379,7 +518,7 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 			VcnId:         targetVcn.Id,
 		})
 		if err != nil {
-			return fmt.Errorf("获取Internet网关列表失败: %w", err)
+			return nil, fmt.Errorf("获取Internet网关列表失败: %w", err)
 		}
 
 		var internetGatewayId *string
@@ -396,7 +535,7 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 				},
 			})
 			if err != nil {
-				return fmt.Errorf("创建Internet网关失败: %w", err)
+				return nil, fmt.Errorf("创建Internet网关失败: %w", err)
 			}
 			// 等待Internet网关创建完成
 			for i := 0; i < 30; i++ {
@@ -408,7 +547,7 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 				time.Sleep(time.Second)
 			}
 			if internetGatewayId == nil {
-				return fmt.Errorf("等待Internet网关创建超时")
+				return nil, fmt.Errorf("等待Internet网关创建超时")
 			}
 		} else {
 			internetGatewayId = igwResp.Items[0].Id
@@ -442,7 +581,7 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 						},
 					})
 					if err != nil {
-						return fmt.Errorf("更新路由表失败: %w", err)
+						return nil, fmt.Errorf("更新路由表失败: %w", err)
 					}
 				}
 			}
@@ -462,7 +601,7 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 			},
 		})
 		if err != nil {
-			return fmt.Errorf("创建子网失败: %w", err)
+			return nil, fmt.Errorf("创建子网失败: %w", err)
 		}
 		// 等待子网创建完成
 		for i := 0; i < 30; i++ {
@@ -474,32 +613,26 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 			time.Sleep(time.Second)
 		}
 		if subnetId == "" {
-			return fmt.Errorf("等待子网创建超时")
+			return nil, fmt.Errorf("等待子网创建超时")
 		}
 	}
 
-	// 4. 确定Shape
-	shape := "VM.Standard.A1.Flex"
-	if architecture == "AMD" {
-		shape = "VM.Standard.E2.1.Micro"
-	}
-
-	// 5. 获取镜像
+	// 4. 获取镜像
 	var imageId string
-	if imageIdParam != "" {
+	if params.ImageID != "" {
 		// 使用指定的镜像ID
-		imageId = imageIdParam
+		imageId = params.ImageID
 	} else {
 		// 自动获取最新镜像
 		computeClient, err := s.GetComputeClient(user)
 		if err != nil {
-			return fmt.Errorf("获取计算客户端失败: %w", err)
+			return nil, fmt.Errorf("获取计算客户端失败: %w", err)
 		}
 
 		osName := "Canonical Ubuntu"
-		if operationSystem == "CentOS" {
+		if params.OperationSystem == "CentOS" {
 			osName = "CentOS"
-		} else if operationSystem == "Oracle Linux" {
+		} else if params.OperationSystem == "Oracle Linux" {
 			osName = "Oracle Linux"
 		}
 
@@ -511,38 +644,55 @@ func (s *OCIService) CreateInstance(ctx context.Context, user *models.OciUser, r
 			SortOrder:       core.ListImagesSortOrderDesc,
 		})
 		if err != nil {
-			return fmt.Errorf("获取镜像列表失败: %w", err)
+			return nil, fmt.Errorf("获取镜像列表失败: %w", err)
 		}
 		if len(imageResp.Items) == 0 {
-			return fmt.Errorf("没有找到合适的镜像")
+			return nil, fmt.Errorf("没有找到合适的镜像")
 		}
 		imageId = *imageResp.Items[0].Id
 	}
 
-	// 6. 生成实例名称
-	displayName := fmt.Sprintf("instance-%s-%d", architecture, time.Now().Unix())
+	// 5. 生成实例名称及用户数据
+	displayName := fmt.Sprintf("instance-%s-%d", shapeInfo.Architecture, time.Now().Unix())
+	var userData string
+	if params.UserData != "" {
+		userData = RenderUserData(params.UserData, UserDataVars{
+			Hostname:  strings.ToLower(displayName),
+			Region:    params.Region,
+			PublicKey: params.SSHPublicKey,
+		})
+	}
+	if params.RootPassword != "" {
+		userData = MergeUserData(userData, BuildRootLoginScript(params.RootPassword, params.SSHPort))
+	}
+	if userData != "" {
+		if err := ValidateUserData(userData); err != nil {
+			return nil, err
+		}
+	}
 
-	// 7. 创建实例
-	params := LaunchInstanceParams{
+	// 6. 创建实例
+	launchParams := LaunchInstanceParams{
 		CompartmentId:      compartmentId,
 		AvailabilityDomain: availabilityDomain,
 		DisplayName:        displayName,
 		ImageId:            imageId,
 		Shape:              shape,
 		SubnetId:           subnetId,
-		Ocpus:              float32(ocpus),
-		MemoryInGBs:        float32(memory),
-		SshPublicKey:       sshPublicKey,
-		BootVolumeSizeGBs:  int64(disk),
-		BootVolumeVpuPerGB: vpusPerGB,
+		Ocpus:              ocpus,
+		MemoryInGBs:        memory,
+		SshPublicKey:       params.SSHPublicKey,
+		BootVolumeSizeGBs:  int64(params.Disk),
+		BootVolumeVpuPerGB: params.VpusPerGB,
+		UserData:           userData,
 	}
 
-	_, err = s.LaunchInstance(ctx, user, params)
+	instance, err := s.LaunchInstance(ctx, user, launchParams)
 	if err != nil {
-		return fmt.Errorf("创建实例失败: %w", err)
+		return nil, fmt.Errorf("创建实例失败: %w", err)
 	}
 
-	return nil
+	return instance, nil
 }
 
 // GetInstanceDetails 获取实例详细信息包括VNICs
@@ -564,6 +714,7 @@ func (s *OCIService) GetInstanceDetails(ctx context.Context, user *models.OciUse
 		State:              string(instance.LifecycleState),
 		Shape:              *instance.Shape,
 		Region:             user.OciRegion,
+		CompartmentID:      stringValue(instance.CompartmentId),
 		AvailabilityDomain: *instance.AvailabilityDomain,
 		CreateTime:         instance.TimeCreated.Format("2006-01-02 15:04:05"),
 		PublicIPs:          []string{},
@@ -681,8 +832,8 @@ type ImageInfo struct {
 	TimeCreated            string `json:"timeCreated"`
 }
 
-// ListImages 获取可用镜像列表
-func (s *OCIService) ListImages(ctx context.Context, user *models.OciUser, region, architecture string) ([]ImageInfo, error) {
+// ListImages 获取可用镜像列表，shape 为空时按 architecture 选择默认规格
+func (s *OCIService) ListImages(ctx context.Context, user *models.OciUser, region, architecture, shape string) ([]ImageInfo, error) {
 	// 临时切换用户区域
 	originalRegion := user.OciRegion
 	user.OciRegion = region
@@ -696,9 +847,8 @@ func (s *OCIService) ListImages(ctx context.Context, user *models.OciUser, regio
 	compartmentId := user.OciTenantID
 
 	// 确定Shape
-	shape := "VM.Standard.A1.Flex"
-	if architecture == "AMD" {
-		shape = "VM.Standard.E2.1.Micro"
+	if shape == "" {
+		shape = DefaultShape(architecture)
 	}
 
 	req := core.ListImagesRequest{
@@ -733,6 +883,217 @@ func (s *OCIService) ListImages(ctx context.Context, user *models.OciUser, regio
 	return images, nil
 }
 
+// ShapeInfo 实例规格信息
+type ShapeInfo struct {
+	Shape                string  `json:"shape"`
+	AvailabilityDomain   string  `json:"availabilityDomain"`
+	ProcessorDescription string  `json:"processorDescription"`
+	Architecture         string  `json:"architecture"`
+	BillingType          string  `json:"billingType"`
+	IsFlexible           bool    `json:"isFlexible"`
+	Ocpus                float32 `json:"ocpus"`
+	MemoryInGBs          float32 `json:"memoryInGBs"`
+	OcpuMin              float32 `json:"ocpuMin"`
+	OcpuMax              float32 `json:"ocpuMax"`
+	MemoryMin            float32 `json:"memoryMin"`
+	MemoryMax            float32 `json:"memoryMax"`
+	MemoryPerOcpuMin     float32 `json:"memoryPerOcpuMin"`
+	MemoryPerOcpuMax     float32 `json:"memoryPerOcpuMax"`
+}
+
+// DefaultShape 未指定规格时按架构返回默认的 Always Free 规格
+func DefaultShape(architecture string) string {
+	if architecture == "AMD" {
+		return "VM.Standard.E2.1.Micro"
+	}
+	return "VM.Standard.A1.Flex"
+}
+
+// shapeArchitecture 根据规格名称判断处理器架构
+func shapeArchitecture(shape string) string {
+	if strings.HasPrefix(shape, "VM.Standard.A") || strings.HasPrefix(shape, "BM.Standard.A") {
+		return "ARM"
+	}
+	return "x86"
+}
+
+// ListShapes 获取区域内可用的实例规格，availabilityDomain 为空时查询所有可用域
+func (s *OCIService) ListShapes(ctx context.Context, user *models.OciUser, region, availabilityDomain string) ([]ShapeInfo, error) {
+	// 临时切换用户区域
+	originalRegion := user.OciRegion
+	if region != "" {
+		user.OciRegion = region
+	}
+	defer func() { user.OciRegion = originalRegion }()
+
+	return s.listShapes(ctx, user, user.OciTenantID, availabilityDomain)
+}
+
+func (s *OCIService) listShapes(ctx context.Context, user *models.OciUser, compartmentId, availabilityDomain string) ([]ShapeInfo, error) {
+	computeClient, err := s.GetComputeClient(user)
+	if err != nil {
+		return nil, fmt.Errorf("获取计算客户端失败: %w", err)
+	}
+
+	availabilityDomains := []string{availabilityDomain}
+	if availabilityDomain == "" {
+		identityClient, err := s.GetIdentityClient(user)
+		if err != nil {
+			return nil, fmt.Errorf("获取身份客户端失败: %w", err)
+		}
+		adResp, err := identityClient.ListAvailabilityDomains(ctx, identity.ListAvailabilityDomainsRequest{
+			CompartmentId: &compartmentId,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("获取可用域失败: %w", err)
+		}
+		if len(adResp.Items) == 0 {
+			return nil, fmt.Errorf("没有可用的可用域")
+		}
+		availabilityDomains = availabilityDomains[:0]
+		for _, ad := range adResp.Items {
+			if ad.Name != nil {
+				availabilityDomains = append(availabilityDomains, *ad.Name)
+			}
+		}
+	}
+
+	shapes := make([]ShapeInfo, 0)
+	for _, ad := range availabilityDomains {
+		req := core.ListShapesRequest{
+			CompartmentId:      &compartmentId,
+			AvailabilityDomain: &ad,
+		}
+		for {
+			resp, err := computeClient.ListShapes(ctx, req)
+			if err != nil {
+				return nil, fmt.Errorf("获取规格列表失败: %w", err)
+			}
+			for _, shape := range resp.Items {
+				shapes = append(shapes, toShapeInfo(shape, ad))
+			}
+			if resp.OpcNextPage == nil {
+				break
+			}
+			req.Page = resp.OpcNextPage
+		}
+	}
+
+	return shapes, nil
+}
+
+func toShapeInfo(shape core.Shape, availabilityDomain string) ShapeInfo {
+	info := ShapeInfo{
+		Shape:              *shape.Shape,
+		AvailabilityDomain: availabilityDomain,
+		Architecture:       shapeArchitecture(*shape.Shape),
+		BillingType:        string(shape.BillingType),
+	}
+	if shape.ProcessorDescription != nil {
+		info.ProcessorDescription = *shape.ProcessorDescription
+	}
+	if shape.IsFlexible != nil {
+		info.IsFlexible = *shape.IsFlexible
+	}
+	if shape.Ocpus != nil {
+		info.Ocpus = *shape.Ocpus
+	}
+	if shape.MemoryInGBs != nil {
+		info.MemoryInGBs = *shape.MemoryInGBs
+	}
+	if opts := shape.OcpuOptions; opts != nil {
+		if opts.Min != nil {
+			info.OcpuMin = *opts.Min
+		}
+		if opts.Max != nil {
+			info.OcpuMax = *opts.Max
+		}
+	}
+	if opts := shape.MemoryOptions; opts != nil {
+		if opts.MinInGBs != nil {
+			info.MemoryMin = *opts.MinInGBs
+		}
+		if opts.MaxInGBs != nil {
+			info.MemoryMax = *opts.MaxInGBs
+		}
+		if opts.MinPerOcpuInGBs != nil {
+			info.MemoryPerOcpuMin = *opts.MinPerOcpuInGBs
+		}
+		if opts.MaxPerOcpuInGBs != nil {
+			info.MemoryPerOcpuMax = *opts.MaxPerOcpuInGBs
+		}
+	}
+	return info
+}
+
+// shapeCacheTTL 规格查询结果的缓存时间，抢机重试时不必每次都查询可用域和规格列表
+const shapeCacheTTL = 6 * time.Hour
+
+// shapeCache 按 配置/区域/区间/规格 缓存 findShape 的结果
+var shapeCache sync.Map
+
+type shapeCacheEntry struct {
+	info    ShapeInfo
+	expires time.Time
+}
+
+// findShape 在区域内查找第一个提供指定规格的可用域，成功结果缓存 shapeCacheTTL
+func (s *OCIService) findShape(ctx context.Context, user *models.OciUser, compartmentId, shape string) (ShapeInfo, error) {
+	key := strings.Join([]string{user.ID, user.OciRegion, compartmentId, shape}, "|")
+	if v, ok := shapeCache.Load(key); ok {
+		if entry := v.(shapeCacheEntry); time.Now().Before(entry.expires) {
+			return entry.info, nil
+		}
+		shapeCache.Delete(key)
+	}
+
+	shapes, err := s.listShapes(ctx, user, compartmentId, "")
+	if err != nil {
+		return ShapeInfo{}, err
+	}
+	for _, info := range shapes {
+		if info.Shape == shape {
+			shapeCache.Store(key, shapeCacheEntry{info: info, expires: time.Now().Add(shapeCacheTTL)})
+			return info, nil
+		}
+	}
+	return ShapeInfo{}, fmt.Errorf("区域 %s 不支持规格 %s", user.OciRegion, shape)
+}
+
+// ValidateShape 校验规格在区域内可用且 OCPU/内存在规格允许范围内
+func (s *OCIService) ValidateShape(ctx context.Context, user *models.OciUser, region, shape string, ocpus, memory float64) error {
+	originalRegion := user.OciRegion
+	user.OciRegion = region
+	defer func() { user.OciRegion = originalRegion }()
+
+	info, err := s.findShape(ctx, user, user.OciTenantID, shape)
+	if err != nil {
+		return err
+	}
+	return ValidateShapeConfig(info, ocpus, memory)
+}
+
+// ValidateShapeConfig 校验 OCPU/内存是否在规格允许范围内，固定规格不做校验
+func ValidateShapeConfig(info ShapeInfo, ocpus, memory float64) error {
+	if !info.IsFlexible {
+		return nil
+	}
+	if ocpus <= 0 || memory <= 0 {
+		return fmt.Errorf("规格 %s 需要指定 OCPU 和内存", info.Shape)
+	}
+	if (info.OcpuMin > 0 && ocpus < float64(info.OcpuMin)) || (info.OcpuMax > 0 && ocpus > float64(info.OcpuMax)) {
+		return fmt.Errorf("规格 %s 的 OCPU 范围为 %g-%g，当前为 %g", info.Shape, info.OcpuMin, info.OcpuMax, ocpus)
+	}
+	if (info.MemoryMin > 0 && memory < float64(info.MemoryMin)) || (info.MemoryMax > 0 && memory > float64(info.MemoryMax)) {
+		return fmt.Errorf("规格 %s 的内存范围为 %g-%gGB，当前为 %gGB", info.Shape, info.MemoryMin, info.MemoryMax, memory)
+	}
+	perOcpu := memory / ocpus
+	if (info.MemoryPerOcpuMin > 0 && perOcpu < float64(info.MemoryPerOcpuMin)) || (info.MemoryPerOcpuMax > 0 && perOcpu > float64(info.MemoryPerOcpuMax)) {
+		return fmt.Errorf("规格 %s 每 OCPU 内存范围为 %g-%gGB，当前为 %.2fGB", info.Shape, info.MemoryPerOcpuMin, info.MemoryPerOcpuMax, perOcpu)
+	}
+	return nil
+}
+
 // ListBootVolumes 列出引导卷
 func (s *OCIService) ListBootVolumes(ctx context.Context, user *models.OciUser, compartmentId string) ([]models.VolumeInfo, error) {
 	client, err := s.GetBlockstorageClient(user)
@@ -760,6 +1121,10 @@ func (s *OCIService) ListBootVolumes(ctx context.Context, user *models.OciUser,
 			ID:          *bv.Id,
 			DisplayName: *bv.DisplayName,
 			State:       string(bv.LifecycleState),
+			Region:      user.OciRegion,
+		}
+		if bv.CompartmentId != nil {
+			volume.CompartmentID = *bv.CompartmentId
 		}
 		if bv.SizeInGBs != nil {
 			volume.SizeInGBs = *bv.SizeInGBs
@@ -821,8 +1186,12 @@ func (s *OCIService) ListVCNs(ctx context.Context, user *models.OciUser, compart
 			ID:          *vcn.Id,
 			DisplayName: *vcn.DisplayName,
 			State:       string(vcn.LifecycleState),
+			Region:      user.OciRegion,
 			Subnets:     []models.SubnetInfo{},
 		}
+		if vcn.CompartmentId != nil {
+			vcnInfo.CompartmentID = *vcn.CompartmentId
+		}
 		// 使用 CidrBlocks 替代已弃用的 CidrBlock
 		if len(vcn.CidrBlocks) > 0 {
 			vcnInfo.CIDRBlock = vcn.CidrBlocks[0]
@@ -1347,8 +1716,8 @@ func (s *OCIService) DeleteUser(ctx context.Context, user *models.OciUser, userI
 	return nil
 }
 
-// GetTrafficData 获取流量统计数据
-func (s *OCIService) GetTrafficData(ctx context.Context, user *models.OciUser, vnicId string, startTime string, endTime string) (*models.TrafficData, error) {
+// GetTrafficData 获取 VNIC 流量数据，compartmentId 为空时从租户根区间递归查询
+func (s *OCIService) GetTrafficData(ctx context.Context, user *models.OciUser, compartmentId string, vnicId string, startTime string, endTime string) (*models.TrafficData, error) {
 	configProvider, err := s.GetConfigProvider(user)
 	if err != nil {
 		return nil, err
@@ -1358,6 +1727,7 @@ func (s *OCIService) GetTrafficData(ctx context.Context, user *models.OciUser, v
 	if err != nil {
 		return nil, err
 	}
+	instrumentClient(&monitoringClient.BaseClient)
 
 	trafficData := &models.TrafficData{
 		Time:     []string{},
@@ -1369,11 +1739,16 @@ func (s *OCIService) GetTrafficData(ctx context.Context, user *models.OciUser, v
 	inboundQuery := fmt.Sprintf("NetworksBytesIn[1m]{resourceId = \"%s\"}.mean()", vnicId)
 	outboundQuery := fmt.Sprintf("NetworksBytesOut[1m]{resourceId = \"%s\"}.mean()", vnicId)
 
-	compartmentId := user.OciTenantID
+	// compartmentIdInSubtree 只能在租户根区间上使用
+	if compartmentId == "" {
+		compartmentId = user.OciTenantID
+	}
+	inSubtree := compartmentId == user.OciTenantID
 
 	// 获取入站数据
 	inReq := monitoring.SummarizeMetricsDataRequest{
-		CompartmentId: &compartmentId,
+		CompartmentId:          &compartmentId,
+		CompartmentIdInSubtree: &inSubtree,
 		SummarizeMetricsDataDetails: monitoring.SummarizeMetricsDataDetails{
 			Namespace: stringPtr("oci_computeagent"),
 			Query:     &inboundQuery,
@@ -1398,7 +1773,8 @@ func (s *OCIService) GetTrafficData(ctx context.Context, user *models.OciUser, v
 
 	// 获取出站数据
 	outReq := monitoring.SummarizeMetricsDataRequest{
-		CompartmentId: &compartmentId,
+		CompartmentId:          &compartmentId,
+		CompartmentIdInSubtree: &inSubtree,
 		SummarizeMetricsDataDetails: monitoring.SummarizeMetricsDataDetails{
 			Namespace: stringPtr("oci_computeagent"),
 			Query:     &outboundQuery,
@@ -1680,8 +2056,7 @@ func (s *OCIService) CreateIpv6ByInstanceId(ctx context.Context, user *models.Oc
 }
 
 // GetInstanceById 根据实例ID获取实例
-func (s *OCIService) GetInstanceById(user *models.OciUser, instanceID string) (*core.Instance, error) {
-	ctx := context.Background()
+func (s *OCIService) GetInstanceById(ctx context.Context, user *models.OciUser, instanceID string) (*core.Instance, error) {
 	client, err := s.GetComputeClient(user)
 	if err != nil {
 		return nil, err
@@ -1696,9 +2071,7 @@ func (s *OCIService) GetInstanceById(user *models.OciUser, instanceID string) (*
 }
 
 // GetBootVolumeByInstanceId 根据实例ID获取引导卷
-func (s *OCIService) GetBootVolumeByInstanceId(user *models.OciUser, instanceID string) (*core.BootVolume, error) {
-	ctx := context.Background()
-
+func (s *OCIService) GetBootVolumeByInstanceId(ctx context.Context, user *models.OciUser, instanceID string) (*core.BootVolume, error) {
 	computeClient, err := s.GetComputeClient(user)
 	if err != nil {
 		return nil, err
@@ -1751,6 +2124,7 @@ func (s *OCIService) GetNetworkLoadBalancerClient(user *models.OciUser) (network
 	if err != nil {
 		return networkloadbalancer.NetworkLoadBalancerClient{}, err
 	}
+	instrumentClient(&client.BaseClient)
 
 	return client, nil
 }
@@ -1773,9 +2147,7 @@ type AutoRescueProgress struct {
 }
 
 // AutoRescue 自动救援/缩小硬盘 (9步骤)
-func (s *OCIService) AutoRescue(user *models.OciUser, params AutoRescueParams, progressChan chan<- AutoRescueProgress) error {
-	ctx := context.Background()
-
+func (s *OCIService) AutoRescue(ctx context.Context, user *models.OciUser, params AutoRescueParams, progressChan chan<- AutoRescueProgress) error {
 	computeClient, err := s.GetComputeClient(user)
 	if err != nil {
 		return fmt.Errorf("failed to get compute client: %w", err)
@@ -1803,13 +2175,13 @@ func (s *OCIService) AutoRescue(user *models.OciUser, params AutoRescueParams, p
 	}
 
 	// 获取实例信息
-	instance, err := s.GetInstanceById(user, params.InstanceID)
+	instance, err := s.GetInstanceById(ctx, user, params.InstanceID)
 	if err != nil {
 		return fmt.Errorf("failed to get instance: %w", err)
 	}
 
 	// 获取引导卷
-	bootVolume, err := s.GetBootVolumeByInstanceId(user, params.InstanceID)
+	bootVolume, err := s.GetBootVolumeByInstanceId(ctx, user, params.InstanceID)
 	if err != nil {
 		return fmt.Errorf("failed to get boot volume: %w", err)
 	}
@@ -2042,8 +2414,8 @@ func (s *OCIService) AutoRescue(user *models.OciUser, params AutoRescueParams, p
 
 // Check500MbpsSupport 检查实例是否支持500Mbps功能
 // 仅 VM.Standard.E2.1.Micro (AMD) 实例支持此功能
-func (s *OCIService) Check500MbpsSupport(user *models.OciUser, instanceID string) (bool, string, error) {
-	instance, err := s.GetInstanceById(user, instanceID)
+func (s *OCIService) Check500MbpsSupport(ctx context.Context, user *models.OciUser, instanceID string) (bool, string, error) {
+	instance, err := s.GetInstanceById(ctx, user, instanceID)
 	if err != nil {
 		return false, "", fmt.Errorf("failed to get instance: %w", err)
 	}
@@ -2054,9 +2426,7 @@ func (s *OCIService) Check500MbpsSupport(user *models.OciUser, instanceID string
 }
 
 // Enable500Mbps 一键开启下行500Mbps
-func (s *OCIService) Enable500Mbps(user *models.OciUser, instanceID string, sshPort int) (string, error) {
-	ctx := context.Background()
-
+func (s *OCIService) Enable500Mbps(ctx context.Context, user *models.OciUser, instanceID string, sshPort int) (string, error) {
 	vnClient, err := s.GetVirtualNetworkClient(user)
 	if err != nil {
 		return "", fmt.Errorf("failed to get virtual network client: %w", err)
@@ -2068,7 +2438,7 @@ func (s *OCIService) Enable500Mbps(user *models.OciUser, instanceID string, sshP
 	}
 
 	// 获取实例信息
-	instance, err := s.GetInstanceById(user, instanceID)
+	instance, err := s.GetInstanceById(ctx, user, instanceID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get instance: %w", err)
 	}
@@ -2079,13 +2449,13 @@ func (s *OCIService) Enable500Mbps(user *models.OciUser, instanceID string, sshP
 	}
 
 	// 获取VCN
-	vcn, err := s.GetVcnByInstanceId(user, instanceID)
+	vcn, err := s.GetVcnByInstanceId(ctx, user, instanceID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get VCN: %w", err)
 	}
 
 	// 获取VNIC
-	vnic, err := s.GetVnicByInstanceId(user, instanceID)
+	vnic, err := s.GetVnicByInstanceId(ctx, user, instanceID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get VNIC: %w", err)
 	}
@@ -2316,16 +2686,16 @@ func (s *OCIService) Enable500Mbps(user *models.OciUser, instanceID string, sshP
 		return "", fmt.Errorf("failed to update VNIC: %w", err)
 	}
 
-	// 放行安全规则
-	_ = s.ReleaseSecurityRules(user, *vcn.Id)
+	// 放行安全规则，失败时不影响已完成的网络配置
+	if err := s.ReleaseSecurityRules(ctx, user, *vcn.Id); err != nil {
+		slog.Warn("Failed to release security rules after enabling 500Mbps", "config", user.Username, "instance_id", instanceID, "vcn_id", *vcn.Id, "error", err)
+	}
 
 	return publicIP, nil
 }
 
 // Disable500Mbps 关闭下行500Mbps
-func (s *OCIService) Disable500Mbps(user *models.OciUser, instanceID string, retainNatGw, retainNlb bool) error {
-	ctx := context.Background()
-
+func (s *OCIService) Disable500Mbps(ctx context.Context, user *models.OciUser, instanceID string, retainNatGw, retainNlb bool) error {
 	vnClient, err := s.GetVirtualNetworkClient(user)
 	if err != nil {
 		return fmt.Errorf("failed to get virtual network client: %w", err)
@@ -2337,7 +2707,7 @@ func (s *OCIService) Disable500Mbps(user *models.OciUser, instanceID string, ret
 	}
 
 	// 获取实例信息
-	instance, err := s.GetInstanceById(user, instanceID)
+	instance, err := s.GetInstanceById(ctx, user, instanceID)
 	if err != nil {
 		return fmt.Errorf("failed to get instance: %w", err)
 	}
@@ -2348,13 +2718,13 @@ func (s *OCIService) Disable500Mbps(user *models.OciUser, instanceID string, ret
 	}
 
 	// 获取VCN
-	vcn, err := s.GetVcnByInstanceId(user, instanceID)
+	vcn, err := s.GetVcnByInstanceId(ctx, user, instanceID)
 	if err != nil {
 		return fmt.Errorf("failed to get VCN: %w", err)
 	}
 
 	// 获取VNIC
-	vnic, err := s.GetVnicByInstanceId(user, instanceID)
+	vnic, err := s.GetVnicByInstanceId(ctx, user, instanceID)
 	if err != nil {
 		return fmt.Errorf("failed to get VNIC: %w", err)
 	}
@@ -2462,9 +2832,7 @@ func (s *OCIService) Disable500Mbps(user *models.OciUser, instanceID string, ret
 }
 
 // ReleaseSecurityRules 放行安全规则
-func (s *OCIService) ReleaseSecurityRules(user *models.OciUser, vcnId string) error {
-	ctx := context.Background()
-
+func (s *OCIService) ReleaseSecurityRules(ctx context.Context, user *models.OciUser, vcnId string) error {
 	vnClient, err := s.GetVirtualNetworkClient(user)
 	if err != nil {
 		return fmt.Errorf("failed to get virtual network client: %w", err)
@@ -2535,15 +2903,13 @@ func (s *OCIService) ReleaseSecurityRules(user *models.OciUser, vcnId string) er
 }
 
 // GetVcnByInstanceId 根据实例ID获取VCN
-func (s *OCIService) GetVcnByInstanceId(user *models.OciUser, instanceID string) (*core.Vcn, error) {
-	ctx := context.Background()
-
+func (s *OCIService) GetVcnByInstanceId(ctx context.Context, user *models.OciUser, instanceID string) (*core.Vcn, error) {
 	vnClient, err := s.GetVirtualNetworkClient(user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get virtual network client: %w", err)
 	}
 
-	vnic, err := s.GetVnicByInstanceId(user, instanceID)
+	vnic, err := s.GetVnicByInstanceId(ctx, user, instanceID)
 	if err != nil {
 		return nil, err
 	}
@@ -2564,9 +2930,7 @@ func (s *OCIService) GetVcnByInstanceId(user *models.OciUser, instanceID string)
 }
 
 // GetVnicByInstanceId 根据实例ID获取VNIC
-func (s *OCIService) GetVnicByInstanceId(user *models.OciUser, instanceID string) (*core.Vnic, error) {
-	ctx := context.Background()
-
+func (s *OCIService) GetVnicByInstanceId(ctx context.Context, user *models.OciUser, instanceID string) (*core.Vnic, error) {
 	computeClient, err := s.GetComputeClient(user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get compute client: %w", err)
@@ -3002,16 +3366,19 @@ func (s *OCIService) GetMonthlyTrafficStats(ctx context.Context, user *models.Oc
 	if err != nil {
 		return nil, err
 	}
+	instrumentClient(&computeClient.BaseClient)
 
 	vnClient, err := core.NewVirtualNetworkClientWithConfigurationProvider(configProvider)
 	if err != nil {
 		return nil, err
 	}
+	instrumentClient(&vnClient.BaseClient)
 
 	monitoringClient, err := monitoring.NewMonitoringClientWithConfigurationProvider(configProvider)
 	if err != nil {
 		return nil, err
 	}
+	instrumentClient(&monitoringClient.BaseClient)
 
 	compartmentId := user.OciTenantID
 	stats := &MonthlyTrafficStats{}
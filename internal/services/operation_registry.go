@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/logger"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	OperationStatusRunning     = "running"
+	OperationStatusInterrupted = "interrupted"
+
+	// operationCancelGrace 排空超时后取消操作，再等待操作返回的时间
+	operationCancelGrace = 3 * time.Second
+)
+
+// ErrShuttingDown 服务正在关闭，不再接受新的长时间操作
+var ErrShuttingDown = errors.New("服务正在关闭，请稍后重试")
+
+// Operation 进行中的长时间操作
+type Operation struct {
+	registry *OperationRegistry
+	record   models.OciOperation
+	cancel   context.CancelFunc
+	persist  bool // 是否在 oci_operation 表中保存检查点
+	mu       sync.Mutex
+	done     bool
+}
+
+// SetProgress 更新操作进度，同时写入数据库作为中断时的检查点
+func (op *Operation) SetProgress(progress string) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.done {
+		return
+	}
+	op.record.Progress = progress
+	op.record.UpdateTime = time.Now()
+	if !op.persist {
+		return
+	}
+	database.GetDB().Model(&models.OciOperation{}).Where("id = ?", op.record.ID).
+		Updates(map[string]interface{}{"progress": progress, "update_time": op.record.UpdateTime})
+}
+
+// Finish 标记操作结束并删除检查点
+// 服务强制关闭导致操作失败时保留检查点，下次启动时标记为中断
+func (op *Operation) Finish(err error) {
+	op.mu.Lock()
+	if op.done {
+		op.mu.Unlock()
+		return
+	}
+	op.done = true
+	op.mu.Unlock()
+
+	op.cancel()
+	if op.persist && (err == nil || op.registry.root.Err() == nil) {
+		database.GetDB().Where("id = ?", op.record.ID).Delete(&models.OciOperation{})
+	}
+	op.registry.remove(op)
+}
+
+func (op *Operation) snapshot() models.OciOperation {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.record
+}
+
+// OperationRegistry 记录进行中的长时间云操作，关闭服务时等待其完成，超时则取消并保留检查点
+type OperationRegistry struct {
+	root       context.Context
+	cancelRoot context.CancelFunc
+	mu         sync.Mutex
+	ops        map[string]*Operation
+	closing    bool
+	idle       chan struct{} // 没有进行中的操作时关闭
+}
+
+func NewOperationRegistry() *OperationRegistry {
+	root, cancel := context.WithCancel(context.Background())
+	idle := make(chan struct{})
+	close(idle)
+	return &OperationRegistry{
+		root:       root,
+		cancelRoot: cancel,
+		ops:        make(map[string]*Operation),
+		idle:       idle,
+	}
+}
+
+// Context 服务级别的 context，关闭服务且排空超时后取消
+func (r *OperationRegistry) Context() context.Context {
+	return r.root
+}
+
+// Begin 登记一个长时间操作
+// 返回的 context 保留 parent 中的日志字段但不随请求结束而取消，只在服务强制关闭或操作结束时取消
+func (r *OperationRegistry) Begin(parent context.Context, kind, configID, targetID string) (context.Context, *Operation, error) {
+	return r.begin(parent, kind, configID, targetID, true)
+}
+
+// Attach 登记一个自行保存检查点的操作（如后台任务），只参与关闭时的排空和取消
+func (r *OperationRegistry) Attach(parent context.Context, kind, configID, targetID string) (context.Context, *Operation, error) {
+	return r.begin(parent, kind, configID, targetID, false)
+}
+
+func (r *OperationRegistry) begin(parent context.Context, kind, configID, targetID string, persist bool) (context.Context, *Operation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closing {
+		return nil, nil, ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	stop := context.AfterFunc(r.root, cancel)
+	now := time.Now()
+	op := &Operation{
+		registry: r,
+		cancel:   func() { stop(); cancel() },
+		persist:  persist,
+		record: models.OciOperation{
+			ID:         uuid.New().String(),
+			Kind:       kind,
+			ConfigID:   configID,
+			TargetID:   targetID,
+			Status:     OperationStatusRunning,
+			StartTime:  now,
+			UpdateTime: now,
+		},
+	}
+	if persist {
+		if err := database.GetDB().Create(&op.record).Error; err != nil {
+			slog.WarnContext(parent, "Failed to save operation checkpoint", "operation", kind, "error", err)
+		}
+	}
+
+	if len(r.ops) == 0 {
+		r.idle = make(chan struct{})
+	}
+	r.ops[op.record.ID] = op
+	ctx = logger.With(ctx, "operation", kind, "operation_id", op.record.ID)
+	return ctx, op, nil
+}
+
+func (r *OperationRegistry) remove(op *Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.ops[op.record.ID]; !ok {
+		return
+	}
+	delete(r.ops, op.record.ID)
+	if len(r.ops) == 0 {
+		close(r.idle)
+	}
+}
+
+// Running 进行中的操作
+func (r *OperationRegistry) Running() []models.OciOperation {
+	r.mu.Lock()
+	ops := make([]*Operation, 0, len(r.ops))
+	for _, op := range r.ops {
+		ops = append(ops, op)
+	}
+	r.mu.Unlock()
+
+	result := make([]models.OciOperation, 0, len(ops))
+	for _, op := range ops {
+		result = append(result, op.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartTime.Before(result[j].StartTime) })
+	return result
+}
+
+// Interrupted 上次运行中被中断的操作
+func (r *OperationRegistry) Interrupted() ([]models.OciOperation, error) {
+	var ops []models.OciOperation
+	err := database.GetDB().Where("status = ?", OperationStatusInterrupted).Order("start_time DESC").Find(&ops).Error
+	return ops, err
+}
+
+// ClearInterrupted 删除被中断操作的记录
+func (r *OperationRegistry) ClearInterrupted() error {
+	return database.GetDB().Where("status = ?", OperationStatusInterrupted).Delete(&models.OciOperation{}).Error
+}
+
+// RecoverInterrupted 启动时把上次未结束的操作标记为中断并通知，需要在接受请求前调用
+func (r *OperationRegistry) RecoverInterrupted(telegram *TelegramService) {
+	db := database.GetDB()
+	var ops []models.OciOperation
+	if err := db.Where("status = ?", OperationStatusRunning).Find(&ops).Error; err != nil || len(ops) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(ops))
+	for _, op := range ops {
+		endTime := op.UpdateTime
+		db.Model(&models.OciOperation{}).Where("id = ?", op.ID).
+			Updates(map[string]interface{}{"status": OperationStatusInterrupted, "end_time": endTime})
+		slog.Warn("Operation was interrupted by previous shutdown", "operation", op.Kind, "operation_id", op.ID,
+			"config_id", op.ConfigID, "target_id", op.TargetID, "progress", op.Progress)
+		lines = append(lines, fmt.Sprintf("• %s %s\n  进度：%s", op.Kind, op.TargetID, op.Progress))
+	}
+
+	if telegram != nil {
+		message := fmt.Sprintf("以下 %d 个操作在上次关闭时未完成，请检查相关资源状态：\n\n%s", len(ops), html.EscapeString(strings.Join(lines, "\n")))
+		if err := telegram.SendNotification("⚠️ 操作被中断", message); err != nil {
+			slog.Warn("Failed to send interrupted operation notification", "error", err)
+		}
+	}
+}
+
+// Shutdown 停止接受新操作并等待进行中的操作完成
+// ctx 到期后取消剩余操作，检查点保留为 running，下次启动时标记为中断；返回未完成的操作
+func (r *OperationRegistry) Shutdown(ctx context.Context) []models.OciOperation {
+	r.mu.Lock()
+	r.closing = true
+	idle := r.idle
+	pending := len(r.ops)
+	r.mu.Unlock()
+
+	if pending > 0 {
+		slog.Info("Waiting for running operations", "count", pending)
+	}
+	select {
+	case <-idle:
+		r.cancelRoot()
+		return nil
+	case <-ctx.Done():
+	}
+
+	remaining := r.Running()
+	for _, op := range remaining {
+		slog.Warn("Cancelling running operation on shutdown", "operation", op.Kind, "operation_id", op.ID,
+			"config_id", op.ConfigID, "target_id", op.TargetID, "progress", op.Progress)
+	}
+	r.cancelRoot()
+	select {
+	case <-idle:
+	case <-time.After(operationCancelGrace):
+	}
+	return remaining
+}
@@ -3,7 +3,7 @@ package services
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"math/rand"
 	"sync"
 	"time"
@@ -11,7 +11,7 @@ import (
 	"github.com/adiecho/oci-panel/internal/database"
 	"github.com/adiecho/oci-panel/internal/models"
 	"github.com/google/uuid"
-	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/identity"
 )
 
 const (
@@ -19,11 +19,24 @@ const (
 	SettingCacheInterval = "cache_interval"
 )
 
+const (
+	// regionPollInterval 区域订阅状态轮询间隔
+	regionPollInterval = 30 * time.Second
+	// regionPollTimeout 区域订阅等待就绪的最长时间
+	regionPollTimeout = 2 * time.Hour
+)
+
 type SchedulerService struct {
 	ociService *OCIService
 	stopChan   chan struct{}
 	running    bool
 	mutex      sync.Mutex
+
+	// regionWatchers 正在轮询的区域订阅，key 为 configID/region
+	regionWatchers sync.Map
+
+	budget  *BudgetService
+	traffic *TrafficQuotaService
 }
 
 func NewSchedulerService(ociService *OCIService) *SchedulerService {
@@ -33,6 +46,16 @@ func NewSchedulerService(ociService *OCIService) *SchedulerService {
 	}
 }
 
+// SetBudgetService 设置预算服务，每次刷新缓存后评估预算
+func (s *SchedulerService) SetBudgetService(budget *BudgetService) {
+	s.budget = budget
+}
+
+// SetTrafficQuotaService 设置流量配额服务，随调度器定期检查
+func (s *SchedulerService) SetTrafficQuotaService(traffic *TrafficQuotaService) {
+	s.traffic = traffic
+}
+
 func (s *SchedulerService) Start() {
 	s.mutex.Lock()
 	if s.running {
@@ -44,7 +67,7 @@ func (s *SchedulerService) Start() {
 	s.mutex.Unlock()
 
 	go s.run()
-	log.Println("Scheduler service started")
+	slog.Info("Scheduler service started")
 }
 
 func (s *SchedulerService) Stop() {
@@ -56,7 +79,7 @@ func (s *SchedulerService) Stop() {
 	}
 	close(s.stopChan)
 	s.running = false
-	log.Println("Scheduler service stopped")
+	slog.Info("Scheduler service stopped")
 }
 
 func (s *SchedulerService) run() {
@@ -69,6 +92,9 @@ func (s *SchedulerService) run() {
 			return
 		case <-ticker.C:
 			s.checkAndRunTask()
+			if s.traffic != nil {
+				go s.traffic.CheckDue()
+			}
 		}
 	}
 }
@@ -127,12 +153,14 @@ func (s *SchedulerService) updateAllCaches(configs []models.OciUser) {
 			delay := time.Duration(1+rand.Intn(10)) * time.Second
 			time.Sleep(delay)
 
-			s.UpdateConfigCache(config.ID)
+			if err := s.UpdateConfigCache(config.ID); err != nil {
+				slog.Error("Failed to update config cache", "config", config.Username, "config_id", config.ID, "error", err)
+			}
 		}(cfg)
 	}
 
 	wg.Wait()
-	log.Println("All config caches updated")
+	slog.Info("All config caches updated", "configs", len(configs))
 }
 
 func (s *SchedulerService) UpdateConfigCache(configID string) error {
@@ -143,7 +171,7 @@ func (s *SchedulerService) UpdateConfigCache(configID string) error {
 	}
 
 	ctx := context.Background()
-	compartmentId := user.OciTenantID
+	start := time.Now()
 
 	var cache models.OciConfigCache
 	result := db.Where("config_id = ?", configID).First(&cache)
@@ -154,42 +182,33 @@ func (s *SchedulerService) UpdateConfigCache(configID string) error {
 		}
 	}
 
-	instances, err := s.ociService.ListInstances(ctx, &user, compartmentId)
+	// 汇总所有订阅区域的资源，全部区域失败时保留旧缓存，部分区域失败时这些区域沿用旧缓存
+	inventory, err := s.ociService.CollectInventory(ctx, &user, nil, InventoryOptions{
+		Instances: true,
+		Volumes:   true,
+		VCNs:      true,
+		Details:   true,
+		Recursive: true,
+	})
+	refreshResult := "error"
 	if err == nil {
-		cache.InstanceCount = len(instances)
-		cache.RunningInstances = 0
-		for _, inst := range instances {
-			if inst.LifecycleState == core.InstanceLifecycleStateRunning {
-				cache.RunningInstances++
-			}
-		}
-
-		var instanceInfos []models.InstanceInfo
-		for _, inst := range instances {
-			if inst.Id != nil {
-				detail, err := s.ociService.GetInstanceDetails(ctx, &user, *inst.Id)
-				if err == nil {
-					instanceInfos = append(instanceInfos, *detail)
-				}
-			}
-		}
-		if data, err := json.Marshal(instanceInfos); err == nil {
+		refreshResult = "ok"
+		keepFailedRegions(&cache, inventory)
+		cache.InstanceCount, cache.RunningInstances = inventory.Totals()
+		if data, err := json.Marshal(inventory.Instances); err == nil {
 			cache.InstancesData = string(data)
 		}
-	}
-
-	volumes, err := s.ociService.ListBootVolumes(ctx, &user, compartmentId)
-	if err == nil {
-		if data, err := json.Marshal(volumes); err == nil {
+		if data, err := json.Marshal(inventory.Volumes); err == nil {
 			cache.VolumesData = string(data)
 		}
-	}
-
-	vcns, err := s.ociService.ListVCNs(ctx, &user, compartmentId)
-	if err == nil {
-		if data, err := json.Marshal(vcns); err == nil {
+		if data, err := json.Marshal(inventory.VCNs); err == nil {
 			cache.VcnsData = string(data)
 		}
+		if data, err := json.Marshal(inventory.Regions); err == nil {
+			cache.RegionsData = string(data)
+		}
+	} else {
+		slog.Warn("Failed to collect inventory, keeping previous cache", "config", user.Username, "config_id", user.ID, "error", err)
 	}
 
 	tenantInfo, err := s.ociService.GetTenantInfo(ctx, &user)
@@ -212,7 +231,24 @@ func (s *SchedulerService) UpdateConfigCache(configID string) error {
 		}
 	}
 
+	// 跨月后缓存的仍是上月费用，需要立即重新查询
+	cachedCost := CachedCost(&cache)
+	if cache.CostUpdateTime == nil || time.Since(*cache.CostUpdateTime) >= CostRefreshInterval ||
+		cachedCost == nil || cachedCost.Period != CurrentCostPeriod() {
+		if cost, err := s.ociService.GetCostUsage(ctx, &user); err == nil {
+			setCostCache(&cache, cost)
+		} else {
+			slog.Warn("Failed to query cost", "config", user.Username, "config_id", user.ID, "error", err)
+		}
+	}
+	if s.budget != nil {
+		s.budget.Evaluate(&user, CachedCost(&cache))
+	}
+
 	cache.UpdateTime = time.Now()
+	cacheRefreshDuration.Observe(time.Since(start).Seconds(), refreshResult)
+	slog.Debug("Config cache refreshed", "config", user.Username, "config_id", user.ID, "result", refreshResult,
+		"instances", cache.InstanceCount, "running", cache.RunningInstances, "duration", time.Since(start))
 
 	if result.Error != nil {
 		return db.Create(&cache).Error
@@ -220,6 +256,150 @@ func (s *SchedulerService) UpdateConfigCache(configID string) error {
 	return db.Save(&cache).Error
 }
 
+// keepFailedRegions 本次查询失败的区域沿用上次缓存的资源和数量，避免单个区域的临时错误让该区域的实例从面板和统计中消失
+func keepFailedRegions(cache *models.OciConfigCache, inventory *InventoryResult) {
+	var previous []models.RegionResourceCount
+	if cache.RegionsData == "" || json.Unmarshal([]byte(cache.RegionsData), &previous) != nil {
+		return
+	}
+	previousCounts := make(map[string]models.RegionResourceCount, len(previous))
+	for _, count := range previous {
+		previousCounts[count.Region] = count
+	}
+
+	failed := map[string]bool{}
+	for i, count := range inventory.Regions {
+		prev, ok := previousCounts[count.Region]
+		if count.Error == "" || !ok {
+			continue
+		}
+		failed[count.Region] = true
+		prev.Error = count.Error
+		inventory.Regions[i] = prev
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	inventory.Instances = carryOverRegions(inventory.Instances, cache.InstancesData, failed, func(i models.InstanceInfo) string { return i.Region })
+	inventory.Volumes = carryOverRegions(inventory.Volumes, cache.VolumesData, failed, func(v models.VolumeInfo) string { return v.Region })
+	inventory.VCNs = carryOverRegions(inventory.VCNs, cache.VcnsData, failed, func(v models.VCNInfo) string { return v.Region })
+}
+
+// carryOverRegions 用上次缓存中 failed 区域的资源替换本次查询到的部分结果
+func carryOverRegions[T any](current []T, previousData string, failed map[string]bool, regionOf func(T) string) []T {
+	var previous []T
+	if previousData == "" || json.Unmarshal([]byte(previousData), &previous) != nil {
+		return current
+	}
+	merged := make([]T, 0, len(current)+len(previous))
+	for _, item := range current {
+		if !failed[regionOf(item)] {
+			merged = append(merged, item)
+		}
+	}
+	for _, item := range previous {
+		if failed[regionOf(item)] {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+func setCostCache(cache *models.OciConfigCache, cost *models.CostUsageReport) {
+	if data, err := json.Marshal(cost); err == nil {
+		now := time.Now()
+		cache.CostData = string(data)
+		cache.CostUpdateTime = &now
+	}
+}
+
+// CachedCost 解析缓存中的费用汇总，没有数据时返回 nil
+func CachedCost(cache *models.OciConfigCache) *models.CostUsageReport {
+	if cache == nil || cache.CostData == "" {
+		return nil
+	}
+	var cost models.CostUsageReport
+	if json.Unmarshal([]byte(cache.CostData), &cost) != nil {
+		return nil
+	}
+	return &cost
+}
+
+// RefreshCostCache 立即查询配置的费用并写入缓存
+func (s *SchedulerService) RefreshCostCache(configID string) (*models.CostUsageReport, error) {
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", configID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	cost, err := s.ociService.GetCostUsage(context.Background(), &user)
+	if err != nil {
+		return nil, err
+	}
+	if s.budget != nil {
+		go s.budget.Evaluate(&user, cost)
+	}
+
+	var cache models.OciConfigCache
+	if err := db.Where("config_id = ?", configID).First(&cache).Error; err != nil {
+		cache = models.OciConfigCache{ID: uuid.New().String(), ConfigID: configID}
+		setCostCache(&cache, cost)
+		return cost, db.Create(&cache).Error
+	}
+	setCostCache(&cache, cost)
+	return cost, db.Model(&cache).Updates(map[string]interface{}{
+		"cost_data":        cache.CostData,
+		"cost_update_time": cache.CostUpdateTime,
+	}).Error
+}
+
+// WatchRegionSubscription 轮询区域订阅直到 READY，随后刷新配置缓存
+// 同一配置同一区域只会有一个轮询在运行
+func (s *SchedulerService) WatchRegionSubscription(configID, regionName string) {
+	key := configID + "/" + regionName
+	if _, loaded := s.regionWatchers.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer s.regionWatchers.Delete(key)
+
+		db := database.GetDB()
+		var user models.OciUser
+		if err := db.Where("id = ?", configID).First(&user).Error; err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), regionPollTimeout)
+		defer cancel()
+
+		ticker := time.NewTicker(regionPollInterval)
+		defer ticker.Stop()
+
+		for {
+			status, err := s.ociService.GetRegionSubscriptionStatus(ctx, &user, regionName)
+			if err != nil {
+				slog.Warn("Failed to poll region subscription", "config_id", configID, "region", regionName, "error", err)
+			} else if status == string(identity.RegionSubscriptionStatusReady) {
+				slog.Info("Region subscription ready, refreshing cache", "config_id", configID, "region", regionName)
+				if err := s.UpdateConfigCache(configID); err != nil {
+					slog.Error("Failed to refresh config cache", "config_id", configID, "error", err)
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				slog.Warn("Timed out waiting for region subscription", "config_id", configID, "region", regionName)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
 func (s *SchedulerService) IsCacheEnabled() bool {
 	db := database.GetDB()
 	var setting models.SysSetting
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+)
+
+// SettingKeySecretKey 本地敏感数据加密密钥（首次使用时自动生成）
+const SettingKeySecretKey = "secret_key"
+
+var (
+	secretKey     []byte
+	secretKeyErr  error
+	secretKeyOnce sync.Once
+)
+
+// loadSecretKey 从系统设置中读取加密密钥，不存在时生成并保存
+func loadSecretKey() ([]byte, error) {
+	secretKeyOnce.Do(func() {
+		db := database.GetDB()
+		var setting models.SysSetting
+		if err := db.Where("key = ?", SettingKeySecretKey).First(&setting).Error; err == nil {
+			secretKey, secretKeyErr = base64.StdEncoding.DecodeString(setting.Value)
+			if secretKeyErr == nil && len(secretKey) != 32 {
+				secretKeyErr = fmt.Errorf("加密密钥长度无效")
+			}
+			return
+		}
+
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			secretKeyErr = fmt.Errorf("生成加密密钥失败: %w", err)
+			return
+		}
+		setting = models.SysSetting{
+			ID:    uuid.New().String(),
+			Key:   SettingKeySecretKey,
+			Value: base64.StdEncoding.EncodeToString(key),
+		}
+		if err := db.Create(&setting).Error; err != nil {
+			secretKeyErr = fmt.Errorf("保存加密密钥失败: %w", err)
+			return
+		}
+		secretKey = key
+	})
+	return secretKey, secretKeyErr
+}
+
+// EncryptSecret 使用 AES-GCM 加密敏感数据，返回 base64 编码的密文
+func EncryptSecret(plaintext string) (string, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret 解密 EncryptSecret 生成的密文
+func DecryptSecret(ciphertext string) (string, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("密文格式无效: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("密文长度无效")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败: %w", err)
+	}
+	return string(plain), nil
+}
+
+const passwordChars = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789@#%^*-_+="
+
+// GeneratePassword 生成指定长度的随机强密码
+func GeneratePassword(length int) (string, error) {
+	buf := make([]byte, length)
+	max := big.NewInt(int64(len(passwordChars)))
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = passwordChars[n.Int64()]
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,496 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+const (
+	// SecurityCheckMFA 用户未启用 MFA
+	SecurityCheckMFA = "mfa_disabled"
+	// SecurityCheckEmailUnverified 用户邮箱未验证
+	SecurityCheckEmailUnverified = "email_unverified"
+	// SecurityCheckApiKeyAge API 密钥超过最长使用天数
+	SecurityCheckApiKeyAge = "api_key_old"
+	// SecurityCheckPasswordExpiry 密码永不过期
+	SecurityCheckPasswordExpiry = "password_never_expires"
+	// SecurityCheckInactiveUser 用户长期未登录
+	SecurityCheckInactiveUser = "user_inactive"
+	// SecurityCheckOpenIngress 安全列表对 0.0.0.0/0 放行全部协议
+	SecurityCheckOpenIngress = "open_ingress"
+
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+
+	// SecurityReportInterval 定时生成安全报告的间隔
+	SecurityReportInterval = 24 * time.Hour
+	// securityReportTimeout 单个配置生成报告的超时
+	securityReportTimeout = 5 * time.Minute
+	// securityReportConcurrency 并发生成报告的配置数
+	securityReportConcurrency = 3
+
+	defaultApiKeyMaxAgeDays = 90
+	defaultInactiveDays     = 90
+)
+
+// severityOrder 报告中问题的排序，严重的在前
+var severityOrder = map[string]int{SeverityHigh: 0, SeverityMedium: 1, SeverityLow: 2}
+
+// SecurityReportOptions 安全报告阈值，为 0 时使用默认值
+type SecurityReportOptions struct {
+	ApiKeyMaxAgeDays int
+	InactiveDays     int
+}
+
+func (o SecurityReportOptions) withDefaults() SecurityReportOptions {
+	if o.ApiKeyMaxAgeDays <= 0 {
+		o.ApiKeyMaxAgeDays = defaultApiKeyMaxAgeDays
+	}
+	if o.InactiveDays <= 0 {
+		o.InactiveDays = defaultInactiveDays
+	}
+	return o
+}
+
+// BuildSecurityReport 检查租户的用户、API 密钥、密码策略和安全列表，单项检查失败记录在 Errors 中
+func (s *OCIService) BuildSecurityReport(ctx context.Context, user *models.OciUser, opts SecurityReportOptions) (*models.TenantSecurityReport, error) {
+	opts = opts.withDefaults()
+	report := &models.TenantSecurityReport{
+		ConfigID:    user.ID,
+		Username:    user.Username,
+		TenantName:  user.TenantName,
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Findings:    []models.SecurityFinding{},
+	}
+
+	identityClient, err := s.GetIdentityClient(user)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := listTenantUsers(ctx, identityClient, user.OciTenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	report.UserCount = len(users)
+
+	now := time.Now()
+	keyDeadline := now.AddDate(0, 0, -opts.ApiKeyMaxAgeDays)
+	loginDeadline := now.AddDate(0, 0, -opts.InactiveDays)
+	for _, u := range users {
+		name := stringValue(u.Name)
+		id := stringValue(u.Id)
+		if u.IsMfaActivated == nil || !*u.IsMfaActivated {
+			report.Findings = append(report.Findings, models.SecurityFinding{
+				Check: SecurityCheckMFA, Severity: SeverityHigh, Resource: name, ResourceID: id,
+				Detail: "用户未启用 MFA",
+			})
+		}
+		if stringValue(u.Email) != "" && (u.EmailVerified == nil || !*u.EmailVerified) {
+			report.Findings = append(report.Findings, models.SecurityFinding{
+				Check: SecurityCheckEmailUnverified, Severity: SeverityLow, Resource: name, ResourceID: id,
+				Detail: fmt.Sprintf("邮箱 %s 未验证", *u.Email),
+			})
+		}
+		switch {
+		case u.LastSuccessfulLoginTime != nil && u.LastSuccessfulLoginTime.Before(loginDeadline):
+			report.Findings = append(report.Findings, models.SecurityFinding{
+				Check: SecurityCheckInactiveUser, Severity: SeverityLow, Resource: name, ResourceID: id,
+				Detail: fmt.Sprintf("最后登录于 %s，超过 %d 天未登录", u.LastSuccessfulLoginTime.Format("2006-01-02"), opts.InactiveDays),
+			})
+		case u.LastSuccessfulLoginTime == nil && u.TimeCreated != nil && u.TimeCreated.Before(loginDeadline):
+			report.Findings = append(report.Findings, models.SecurityFinding{
+				Check: SecurityCheckInactiveUser, Severity: SeverityLow, Resource: name, ResourceID: id,
+				Detail: fmt.Sprintf("创建超过 %d 天从未登录控制台", opts.InactiveDays),
+			})
+		}
+
+		keys, err := identityClient.ListApiKeys(ctx, identity.ListApiKeysRequest{UserId: u.Id})
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("API 密钥（%s）: %v", name, err))
+			continue
+		}
+		for _, key := range keys.Items {
+			if key.LifecycleState != identity.ApiKeyLifecycleStateActive || key.TimeCreated == nil || !key.TimeCreated.Before(keyDeadline) {
+				continue
+			}
+			report.Findings = append(report.Findings, models.SecurityFinding{
+				Check: SecurityCheckApiKeyAge, Severity: SeverityMedium, Resource: name, ResourceID: stringValue(key.Fingerprint),
+				Detail: fmt.Sprintf("API 密钥创建于 %s，超过 %d 天未轮换", key.TimeCreated.Format("2006-01-02"), opts.ApiKeyMaxAgeDays),
+			})
+		}
+	}
+
+	if expiresAfter, err := s.GetPasswordExpiresAfter(ctx, user); err != nil {
+		report.Errors = append(report.Errors, "密码策略: "+err.Error())
+	} else if expiresAfter == 0 {
+		report.Findings = append(report.Findings, models.SecurityFinding{
+			Check: SecurityCheckPasswordExpiry, Severity: SeverityMedium, Resource: user.TenantName, ResourceID: user.OciTenantID,
+			Detail: "密码策略未设置过期时间",
+		})
+	}
+
+	ingress, errs := s.findOpenIngress(ctx, user)
+	report.Findings = append(report.Findings, ingress...)
+	report.Errors = append(report.Errors, errs...)
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return severityOrder[report.Findings[i].Severity] < severityOrder[report.Findings[j].Severity]
+	})
+	return report, nil
+}
+
+func listTenantUsers(ctx context.Context, client identity.IdentityClient, tenancyID string) ([]identity.User, error) {
+	var users []identity.User
+	req := identity.ListUsersRequest{CompartmentId: &tenancyID}
+	for {
+		resp, err := client.ListUsers(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range resp.Items {
+			if u.LifecycleState == identity.UserLifecycleStateActive {
+				users = append(users, u)
+			}
+		}
+		if resp.OpcNextPage == nil {
+			return users, nil
+		}
+		req.Page = resp.OpcNextPage
+	}
+}
+
+// isOpenIngressRule 判断入站规则是否对任意地址放行全部协议
+func isOpenIngressRule(rule core.IngressSecurityRule) bool {
+	source := stringValue(rule.Source)
+	return stringValue(rule.Protocol) == "all" && (source == "0.0.0.0/0" || source == "::/0")
+}
+
+// findOpenIngress 在所有订阅区域和区间中查找放行全部流量的安全列表
+func (s *OCIService) findOpenIngress(ctx context.Context, user *models.OciUser) ([]models.SecurityFinding, []string) {
+	compartments, err := s.ResolveCompartments(ctx, user, user.OciTenantID, true)
+	if err != nil {
+		return nil, []string{"安全列表: " + err.Error()}
+	}
+	regions := s.ListSubscribedRegions(ctx, user)
+
+	var (
+		findings []models.SecurityFinding
+		errs     []string
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+	)
+	semaphore := make(chan struct{}, regionConcurrency)
+	for _, region := range regions {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(region string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			regionUser := *user
+			regionUser.OciRegion = region
+			vnClient, err := s.GetVirtualNetworkClient(&regionUser)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Sprintf("安全列表（%s）: %v", region, err))
+				mu.Unlock()
+				return
+			}
+			for _, compartmentID := range compartments {
+				req := core.ListSecurityListsRequest{CompartmentId: common.String(compartmentID)}
+				for {
+					resp, err := vnClient.ListSecurityLists(ctx, req)
+					if err != nil {
+						mu.Lock()
+						errs = append(errs, fmt.Sprintf("安全列表（%s）: %v", region, err))
+						mu.Unlock()
+						return
+					}
+					for _, secList := range resp.Items {
+						for _, rule := range secList.IngressSecurityRules {
+							if !isOpenIngressRule(rule) {
+								continue
+							}
+							mu.Lock()
+							findings = append(findings, models.SecurityFinding{
+								Check: SecurityCheckOpenIngress, Severity: SeverityHigh,
+								Resource: stringValue(secList.DisplayName), ResourceID: stringValue(secList.Id), Region: region,
+								Detail: fmt.Sprintf("入站规则允许 %s 访问全部协议和端口", stringValue(rule.Source)),
+							})
+							mu.Unlock()
+						}
+					}
+					if resp.OpcNextPage == nil {
+						break
+					}
+					req.Page = resp.OpcNextPage
+				}
+			}
+		}(region)
+	}
+	wg.Wait()
+	return findings, errs
+}
+
+// RenderSecurityReportMarkdown 将安全报告渲染为 Markdown
+func RenderSecurityReportMarkdown(reports []models.TenantSecurityReport) string {
+	var b strings.Builder
+	b.WriteString("# 租户安全报告\n")
+	for _, report := range reports {
+		high, medium, low := countSeverities(report.Findings)
+		fmt.Fprintf(&b, "\n## %s", report.Username)
+		if report.TenantName != "" {
+			fmt.Fprintf(&b, "（%s）", report.TenantName)
+		}
+		fmt.Fprintf(&b, "\n\n生成时间：%s，用户数：%d，高危 %d / 中危 %d / 低危 %d\n\n", report.GeneratedAt, report.UserCount, high, medium, low)
+
+		if len(report.Findings) == 0 {
+			b.WriteString("未发现问题。\n")
+		} else {
+			b.WriteString("| 级别 | 检查项 | 资源 | 区域 | 说明 |\n|---|---|---|---|---|\n")
+			for _, f := range report.Findings {
+				fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n",
+					f.Severity, f.Check, markdownCell(f.Resource), f.Region, markdownCell(f.Detail))
+			}
+		}
+		if len(report.Errors) > 0 {
+			b.WriteString("\n未完成的检查：\n\n")
+			for _, e := range report.Errors {
+				fmt.Fprintf(&b, "- %s\n", e)
+			}
+		}
+	}
+	return b.String()
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+func countSeverities(findings []models.SecurityFinding) (high, medium, low int) {
+	for _, f := range findings {
+		switch f.Severity {
+		case SeverityHigh:
+			high++
+		case SeverityMedium:
+			medium++
+		default:
+			low++
+		}
+	}
+	return
+}
+
+type SecurityReportService struct {
+	ociService *OCIService
+	telegram   *TelegramService
+	stopChan   chan struct{}
+	running    bool
+	mutex      sync.Mutex
+}
+
+func NewSecurityReportService(ociService *OCIService, telegram *TelegramService) *SecurityReportService {
+	return &SecurityReportService{
+		ociService: ociService,
+		telegram:   telegram,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+func (s *SecurityReportService) Start() {
+	s.mutex.Lock()
+	if s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.mutex.Unlock()
+
+	go s.run()
+	slog.Info("Security report service started")
+}
+
+func (s *SecurityReportService) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		return
+	}
+	close(s.stopChan)
+	s.running = false
+	slog.Info("Security report service stopped")
+}
+
+func (s *SecurityReportService) run() {
+	// 每分钟检查一次，只为报告过期的配置重新生成，重启后不会重复扫描
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.runDue()
+		}
+	}
+}
+
+func (s *SecurityReportService) runDue() {
+	db := database.GetDB()
+	var users []models.OciUser
+	db.Find(&users)
+
+	// 扫描失败也会记录 check_time，失败的配置同样按间隔重试
+	var due []models.OciUser
+	for _, user := range users {
+		var record models.OciSecurityReport
+		if err := db.Where("config_id = ?", user.ID).First(&record).Error; err != nil {
+			due = append(due, user)
+			continue
+		}
+		lastCheck := record.CheckTime
+		if lastCheck.Before(record.UpdateTime) {
+			lastCheck = record.UpdateTime
+		}
+		if time.Since(lastCheck) >= SecurityReportInterval {
+			due = append(due, user)
+		}
+	}
+	if len(due) > 0 {
+		s.generate(context.Background(), due, SecurityReportOptions{}, true)
+	}
+}
+
+// GenerateAll 为所有配置重新生成报告，ctx 取消后不再开始新的配置
+func (s *SecurityReportService) GenerateAll(ctx context.Context, opts SecurityReportOptions) []models.TenantSecurityReport {
+	var users []models.OciUser
+	database.GetDB().Find(&users)
+	return s.generate(ctx, users, opts, false)
+}
+
+// GenerateConfig 为单个配置重新生成报告
+func (s *SecurityReportService) GenerateConfig(configID string, opts SecurityReportOptions) (*models.TenantSecurityReport, error) {
+	var user models.OciUser
+	if err := database.GetDB().Where("id = ?", configID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return s.Generate(&user, opts, false)
+}
+
+func (s *SecurityReportService) generate(ctx context.Context, users []models.OciUser, opts SecurityReportOptions, notify bool) []models.TenantSecurityReport {
+	reports := make([]*models.TenantSecurityReport, len(users))
+	semaphore := make(chan struct{}, securityReportConcurrency)
+	var wg sync.WaitGroup
+	for i := range users {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(idx int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			report, err := s.Generate(&users[idx], opts, notify)
+			if err != nil {
+				slog.Error("Failed to build security report", "config", users[idx].Username, "config_id", users[idx].ID, "error", err)
+				return
+			}
+			reports[idx] = report
+		}(i)
+	}
+	wg.Wait()
+
+	result := make([]models.TenantSecurityReport, 0, len(reports))
+	for _, report := range reports {
+		if report != nil {
+			result = append(result, *report)
+		}
+	}
+	return result
+}
+
+// Generate 生成报告并保存，notify 为 true 时高危问题增加会发送通知
+func (s *SecurityReportService) Generate(user *models.OciUser, opts SecurityReportOptions, notify bool) (*models.TenantSecurityReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), securityReportTimeout)
+	defer cancel()
+
+	db := database.GetDB()
+	var record models.OciSecurityReport
+	previousHigh := 0
+	if err := db.Where("config_id = ?", user.ID).First(&record).Error; err != nil {
+		record = models.OciSecurityReport{ID: uuid.New().String(), ConfigID: user.ID}
+	} else {
+		previousHigh = record.HighCount
+	}
+	record.CheckTime = time.Now()
+
+	report, err := s.ociService.BuildSecurityReport(ctx, user, opts)
+	if err != nil {
+		// 保留上次成功的报告，只记录失败原因和扫描时间
+		record.LastError = err.Error()
+		if saveErr := db.Save(&record).Error; saveErr != nil {
+			slog.Error("Failed to save security report", "config", user.Username, "config_id", user.ID, "error", saveErr)
+		}
+		return nil, err
+	}
+	high, _, _ := countSeverities(report.Findings)
+
+	data, _ := json.Marshal(report)
+	record.FindingCount = len(report.Findings)
+	record.HighCount = high
+	record.ReportData = string(data)
+	record.LastError = ""
+	record.UpdateTime = record.CheckTime
+	if err := db.Save(&record).Error; err != nil {
+		slog.Error("Failed to save security report", "config", user.Username, "config_id", user.ID, "error", err)
+	}
+
+	if notify && high > previousHigh && s.telegram != nil {
+		message := fmt.Sprintf("配置：%s\n高危问题：%d 个（上次 %d 个）\n问题总数：%d 个",
+			html.EscapeString(user.Username), high, previousHigh, len(report.Findings))
+		if err := s.telegram.SendNotification("🛡️ 安全报告发现新的高危问题", message); err != nil {
+			slog.Warn("Failed to send security report notification", "error", err)
+		}
+	}
+	return report, nil
+}
+
+// Latest 读取已保存的报告，configID 为空时返回全部配置
+func (s *SecurityReportService) Latest(configID string) ([]models.TenantSecurityReport, error) {
+	query := database.GetDB().Order("update_time desc")
+	if configID != "" {
+		query = query.Where("config_id = ?", configID)
+	}
+	var records []models.OciSecurityReport
+	if err := query.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	reports := make([]models.TenantSecurityReport, 0, len(records))
+	for _, record := range records {
+		var report models.TenantSecurityReport
+		if json.Unmarshal([]byte(record.ReportData), &report) == nil {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// SSHDialTimeout 建立 SSH 连接超时
+	SSHDialTimeout = 15 * time.Second
+	// SSHIdleTimeout 终端无输入自动断开时间
+	SSHIdleTimeout = 30 * time.Minute
+	// SSHMaxSessionDuration 单个终端会话最长时间
+	SSHMaxSessionDuration = 4 * time.Hour
+)
+
+type SSHTerminalService struct {
+	ociService *OCIService
+}
+
+func NewSSHTerminalService(ociService *OCIService) *SSHTerminalService {
+	return &SSHTerminalService{ociService: ociService}
+}
+
+// SSHTerminalParams Web 终端连接参数
+type SSHTerminalParams struct {
+	ConfigID   string `json:"configId"`
+	InstanceID string `json:"instanceId"`
+	Region     string `json:"region"`
+	Host       string `json:"host"` // 只能是实例自身的公网或内网 IP，为空时使用第一个公网 IP
+	Port       int    `json:"port"` // 为空时使用创建实例时设置的端口，默认 22
+	Username   string `json:"username"`
+	KeyID      string `json:"keyId"`
+	Password   string `json:"password"`
+	Cols       int    `json:"cols"`
+	Rows       int    `json:"rows"`
+	// AcceptHostKey 用户确认信任的新主机密钥指纹，仅在指纹与上次连接不一致时需要
+	AcceptHostKey string `json:"acceptHostKey"`
+
+	Operator string `json:"-"`
+	ClientIP string `json:"-"`
+}
+
+// SSHTerminalSession 一个已建立的 SSH 终端会话
+type SSHTerminalSession struct {
+	Audit *models.SSHSessionAudit
+
+	client    *ssh.Client
+	session   *ssh.Session
+	stdin     io.WriteCloser
+	bytesIn   atomic.Int64
+	bytesOut  atomic.Int64
+	closeOnce sync.Once
+}
+
+// HostKeyMismatchError 主机密钥与上次成功连接时不一致，需要用户确认新指纹后重连
+type HostKeyMismatchError struct {
+	Known       string
+	Fingerprint string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("主机密钥与上次连接不一致（上次 %s，本次 %s），确认实例已重装后再连接", e.Known, e.Fingerprint)
+}
+
+// countingWriter 统计写入终端输出的字节数
+type countingWriter struct {
+	w     io.Writer
+	count *atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.count.Add(int64(n))
+	return n, err
+}
+
+// Open 建立 SSH 连接并启动交互式 shell，output 需支持并发写入
+func (s *SSHTerminalService) Open(ctx context.Context, params SSHTerminalParams, output io.Writer) (*SSHTerminalSession, error) {
+	if params.Username == "" {
+		params.Username = "root"
+	}
+	if params.Cols <= 0 {
+		params.Cols = 80
+	}
+	if params.Rows <= 0 {
+		params.Rows = 24
+	}
+
+	audit := &models.SSHSessionAudit{
+		ID:         uuid.New().String(),
+		ConfigID:   params.ConfigID,
+		InstanceID: params.InstanceID,
+		Username:   params.Username,
+		KeyID:      params.KeyID,
+		Operator:   params.Operator,
+		ClientIP:   params.ClientIP,
+		Status:     "connecting",
+		StartTime:  time.Now(),
+	}
+
+	fail := func(err error) (*SSHTerminalSession, error) {
+		now := time.Now()
+		audit.Status = "failed"
+		audit.Message = err.Error()
+		audit.EndTime = &now
+		database.GetDB().Create(audit)
+		return nil, err
+	}
+
+	host, port, err := s.resolveTarget(ctx, &params)
+	audit.Host, audit.Port = host, port
+	if err != nil {
+		return fail(err)
+	}
+
+	auth, authType, err := sshAuthMethods(params)
+	audit.AuthType = authType
+	if err != nil {
+		return fail(err)
+	}
+
+	// 首次连接信任主机密钥，之后与该实例上次成功连接的指纹比对
+	var known models.SSHSessionAudit
+	database.GetDB().
+		Where("instance_id = ? AND host_key_fingerprint <> '' AND status IN ?", params.InstanceID, []string{"connected", "closed"}).
+		Order("start_time DESC").Limit(1).Find(&known)
+
+	var mismatch *HostKeyMismatchError
+	config := &ssh.ClientConfig{
+		User:    params.Username,
+		Auth:    auth,
+		Timeout: SSHDialTimeout,
+		// 实例重装后主机密钥会变化，指纹不一致时须由用户确认新指纹才继续认证
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+			audit.HostKeyFingerprint = fingerprint
+			if known.HostKeyFingerprint != "" && known.HostKeyFingerprint != fingerprint && params.AcceptHostKey != fingerprint {
+				mismatch = &HostKeyMismatchError{Known: known.HostKeyFingerprint, Fingerprint: fingerprint}
+				return mismatch
+			}
+			return nil
+		},
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := net.Dialer{Timeout: SSHDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fail(fmt.Errorf("连接 %s 失败: %w", addr, err))
+	}
+	conn.SetDeadline(time.Now().Add(SSHDialTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		if mismatch != nil {
+			return fail(mismatch)
+		}
+		return fail(fmt.Errorf("SSH握手失败: %w", err))
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return fail(fmt.Errorf("创建SSH会话失败: %w", err))
+	}
+
+	ts := &SSHTerminalSession{Audit: audit, client: client, session: session}
+	session.Stdout = &countingWriter{w: output, count: &ts.bytesOut}
+	session.Stderr = &countingWriter{w: output, count: &ts.bytesOut}
+	ts.stdin, err = session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return fail(fmt.Errorf("获取输入流失败: %w", err))
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm-256color", params.Rows, params.Cols, modes); err != nil {
+		client.Close()
+		return fail(fmt.Errorf("申请PTY失败: %w", err))
+	}
+	if err := session.Shell(); err != nil {
+		client.Close()
+		return fail(fmt.Errorf("启动shell失败: %w", err))
+	}
+
+	audit.Status = "connected"
+	database.GetDB().Create(audit)
+	return ts, nil
+}
+
+// resolveTarget 确定连接地址和端口，只允许连接实例自身的 IP
+func (s *SSHTerminalService) resolveTarget(ctx context.Context, params *SSHTerminalParams) (string, int, error) {
+	port := params.Port
+	if port <= 0 {
+		var cred models.InstanceCredential
+		if err := database.GetDB().Where("instance_id = ?", params.InstanceID).First(&cred).Error; err == nil {
+			port = cred.SSHPort
+		}
+	}
+	if port <= 0 {
+		port = 22
+	}
+
+	if params.ConfigID == "" || params.InstanceID == "" {
+		return "", port, fmt.Errorf("缺少配置或实例ID")
+	}
+
+	var user models.OciUser
+	if err := database.GetDB().Where("id = ?", params.ConfigID).First(&user).Error; err != nil {
+		return "", port, fmt.Errorf("配置不存在")
+	}
+	if params.Region != "" {
+		user.OciRegion = params.Region
+	}
+
+	detail, err := s.ociService.GetInstanceDetails(ctx, &user, params.InstanceID)
+	if err != nil {
+		return "", port, fmt.Errorf("获取实例信息失败: %w", err)
+	}
+	if params.Host != "" {
+		if !slices.Contains(detail.PublicIPs, params.Host) && !slices.Contains(detail.PrivateIPs, params.Host) {
+			return "", port, fmt.Errorf("连接地址 %s 不属于该实例", params.Host)
+		}
+		return params.Host, port, nil
+	}
+	if len(detail.PublicIPs) == 0 {
+		return "", port, fmt.Errorf("实例没有公网IP")
+	}
+	return detail.PublicIPs[0], port, nil
+}
+
+// sshAuthMethods 根据密钥库中的私钥或密码构造认证方式
+func sshAuthMethods(params SSHTerminalParams) ([]ssh.AuthMethod, string, error) {
+	if params.KeyID != "" {
+		var key models.SSHKey
+		if err := database.GetDB().Where("id = ?", params.KeyID).First(&key).Error; err != nil {
+			return nil, "key", fmt.Errorf("SSH密钥不存在")
+		}
+		if key.PrivateKey == "" {
+			return nil, "key", fmt.Errorf("该密钥没有保存私钥，请使用密码登录")
+		}
+		privateKey, err := DecryptSecret(key.PrivateKey)
+		if err != nil {
+			return nil, "key", err
+		}
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		if err != nil {
+			return nil, "key", fmt.Errorf("解析私钥失败: %w", err)
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, "key", nil
+	}
+
+	if params.Password != "" {
+		password := params.Password
+		return []ssh.AuthMethod{
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}),
+		}, "password", nil
+	}
+
+	return nil, "", fmt.Errorf("请选择SSH密钥或输入密码")
+}
+
+// Write 写入终端输入
+func (ts *SSHTerminalSession) Write(p []byte) error {
+	n, err := ts.stdin.Write(p)
+	ts.bytesIn.Add(int64(n))
+	return err
+}
+
+// Resize 调整 PTY 窗口大小
+func (ts *SSHTerminalSession) Resize(cols, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return nil
+	}
+	return ts.session.WindowChange(rows, cols)
+}
+
+// Wait 等待远端 shell 退出
+func (ts *SSHTerminalSession) Wait() error {
+	return ts.session.Wait()
+}
+
+// Close 关闭会话并写入审计结果
+func (ts *SSHTerminalSession) Close(reason string) {
+	ts.closeOnce.Do(func() {
+		ts.session.Close()
+		ts.client.Close()
+
+		now := time.Now()
+		database.GetDB().Model(ts.Audit).Updates(map[string]interface{}{
+			"status":    "closed",
+			"message":   reason,
+			"bytes_in":  ts.bytesIn.Load(),
+			"bytes_out": ts.bytesOut.Load(),
+			"end_time":  now,
+		})
+	})
+}
+
+// ListSessions 分页查询终端会话审计记录
+func (s *SSHTerminalService) ListSessions(instanceID string, page, pageSize int) ([]models.SSHSessionAudit, int64, error) {
+	var audits []models.SSHSessionAudit
+	var total int64
+
+	query := database.GetDB().Model(&models.SSHSessionAudit{})
+	if instanceID != "" {
+		query = query.Where("instance_id = ?", instanceID)
+	}
+	query.Count(&total)
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("start_time DESC").Limit(pageSize).Offset(offset).Find(&audits).Error; err != nil {
+		return nil, 0, err
+	}
+	return audits, total, nil
+}
@@ -3,14 +3,17 @@ package services
 import (
 	"context"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
 	"regexp"
 	"sync"
 	"time"
 
 	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/logger"
 	"github.com/adiecho/oci-panel/internal/models"
 	"github.com/google/uuid"
+	"github.com/oracle/oci-go-sdk/v65/core"
 )
 
 // extractOCIErrorMessage 从 OCI 错误中提取 Message 部分
@@ -30,21 +33,41 @@ func extractOCIErrorMessage(err error) string {
 
 type TaskService struct {
 	ociService *OCIService
+	telegram   *TelegramService
 	stopChan   chan struct{}
 	running    bool
 	mutex      sync.Mutex
 	taskTimers map[string]*time.Timer
 	timerMutex sync.RWMutex
+	operations *OperationRegistry
 }
 
-func NewTaskService(ociService *OCIService) *TaskService {
+func NewTaskService(ociService *OCIService, telegram *TelegramService) *TaskService {
 	return &TaskService{
 		ociService: ociService,
+		telegram:   telegram,
 		stopChan:   make(chan struct{}),
 		taskTimers: make(map[string]*time.Timer),
 	}
 }
 
+// SetOperationRegistry 设置操作登记表，创建实例时登记以便关闭服务前等待完成
+func (s *TaskService) SetOperationRegistry(operations *OperationRegistry) {
+	s.operations = operations
+}
+
+// beginCreate 登记一次实例创建，未设置登记表时直接返回
+func (s *TaskService) beginCreate(ctx context.Context, task *models.OciCreateTask) (context.Context, func(error), error) {
+	if s.operations == nil {
+		return ctx, func(error) {}, nil
+	}
+	opCtx, op, err := s.operations.Begin(ctx, "create_instance", task.UserID, task.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return opCtx, op.Finish, nil
+}
+
 func (s *TaskService) Start() {
 	s.mutex.Lock()
 	if s.running {
@@ -56,7 +79,7 @@ func (s *TaskService) Start() {
 	s.mutex.Unlock()
 
 	go s.loadAndStartTasks()
-	log.Println("Task service started")
+	slog.Info("Task service started")
 }
 
 func (s *TaskService) Stop() {
@@ -77,7 +100,7 @@ func (s *TaskService) Stop() {
 	s.taskTimers = make(map[string]*time.Timer)
 	s.timerMutex.Unlock()
 
-	log.Println("Task service stopped")
+	slog.Info("Task service stopped")
 }
 
 func (s *TaskService) loadAndStartTasks() {
@@ -113,9 +136,10 @@ func (s *TaskService) executeTask(taskID string) {
 	db := database.GetDB()
 	var task models.OciCreateTask
 	if err := db.Where("id = ?", taskID).First(&task).Error; err != nil {
-		log.Printf("Task %s not found: %v", taskID, err)
+		slog.Warn("Task not found", "task_id", taskID, "error", err)
 		return
 	}
+	ctx := logger.With(context.Background(), "task_id", taskID, "config_id", task.UserID)
 
 	if task.Status != "running" {
 		return
@@ -123,19 +147,37 @@ func (s *TaskService) executeTask(taskID string) {
 
 	var user models.OciUser
 	if err := db.Where("id = ?", task.UserID).First(&user).Error; err != nil {
-		s.logTaskExecution(taskID, "error", fmt.Sprintf("配置不存在: %v", err))
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", fmt.Sprintf("配置不存在: %v", err))
 		return
 	}
 
-	var sshKey models.SSHKey
-	if err := db.Where("id = ?", task.SSHKeyID).First(&sshKey).Error; err != nil {
-		s.logTaskExecution(taskID, "error", fmt.Sprintf("SSH密钥不存在: %v", err))
+	authorizedKeys, err := loadAuthorizedKeys(&task)
+	if err != nil {
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", err.Error())
 		return
 	}
 
-	ctx := context.Background()
-	err := s.ociService.CreateInstance(ctx, &user, task.OciRegion, task.Architecture, task.OperationSystem,
-		task.Ocpus, task.Memory, task.Disk, task.BootVolumeVpu, sshKey.PublicKey, task.ImageId)
+	userData, err := loadUserData(task.UserDataID)
+	if err != nil {
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", err.Error())
+		return
+	}
+
+	rootPassword, err := taskRootPassword(&task)
+	if err != nil {
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", err.Error())
+		return
+	}
+
+	ctx = logger.With(ctx, "config", user.Username)
+	ctx, finish, err := s.beginCreate(ctx, &task)
+	if err != nil {
+		return
+	}
+	params := taskCreateParams(&task, authorizedKeys, userData)
+	params.RootPassword = rootPassword
+	instance, err := s.ociService.CreateInstance(ctx, &user, params)
+	finish(err)
 
 	now := time.Now()
 	task.ExecuteCount++
@@ -144,12 +186,13 @@ func (s *TaskService) executeTask(taskID string) {
 	if err != nil {
 		errMsg := extractOCIErrorMessage(err)
 		task.LastMessage = errMsg
-		s.logTaskExecution(taskID, "error", errMsg)
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", errMsg)
 	} else {
 		task.SuccessCount++
 		task.LastMessage = "创建成功"
 		task.Status = "completed"
-		s.logTaskExecution(taskID, "success", "实例创建成功")
+		s.logTaskExecution(ctx, taskID, task.UserID, "success", "实例创建成功")
+		s.onInstanceCreated(&task, instance, rootPassword)
 	}
 
 	db.Save(&task)
@@ -161,7 +204,151 @@ func (s *TaskService) executeTask(taskID string) {
 	}
 }
 
-func (s *TaskService) logTaskExecution(taskID, status, message string) {
+// taskCreateParams 将任务配置转换为创建实例参数
+func taskCreateParams(task *models.OciCreateTask, sshPublicKey, userData string) CreateInstanceParams {
+	return CreateInstanceParams{
+		Region:          task.OciRegion,
+		Architecture:    task.Architecture,
+		Shape:           task.Shape,
+		OperationSystem: task.OperationSystem,
+		Ocpus:           task.Ocpus,
+		Memory:          task.Memory,
+		Disk:            task.Disk,
+		VpusPerGB:       task.BootVolumeVpu,
+		SSHPublicKey:    sshPublicKey,
+		ImageID:         task.ImageId,
+		UserData:        userData,
+		SSHPort:         task.SSHPort,
+		CompartmentID:   task.CompartmentID,
+	}
+}
+
+// taskRootPassword 获取任务的 root 密码，未启用时返回空，未指定密码时随机生成
+func taskRootPassword(task *models.OciCreateTask) (string, error) {
+	if !task.EnableRootLogin {
+		return "", nil
+	}
+	if task.RootPassword == "" {
+		password, err := GeneratePassword(20)
+		if err != nil {
+			return "", fmt.Errorf("生成root密码失败: %w", err)
+		}
+		return password, nil
+	}
+	password, err := DecryptSecret(task.RootPassword)
+	if err != nil {
+		return "", fmt.Errorf("读取root密码失败: %w", err)
+	}
+	return password, nil
+}
+
+// onInstanceCreated 保存实例 root 凭据并发送创建成功通知
+func (s *TaskService) onInstanceCreated(task *models.OciCreateTask, instance *core.Instance, rootPassword string) {
+	instanceName := ""
+	if instance.DisplayName != nil {
+		instanceName = *instance.DisplayName
+	}
+	sshPort := task.SSHPort
+	if sshPort <= 0 {
+		sshPort = 22
+	}
+
+	if rootPassword != "" {
+		encrypted, err := EncryptSecret(rootPassword)
+		if err != nil {
+			slog.Error("Failed to encrypt root password", "task_id", task.ID, "instance_id", *instance.Id, "error", err)
+		} else {
+			credential := models.InstanceCredential{
+				ID:           uuid.New().String(),
+				InstanceID:   *instance.Id,
+				InstanceName: instanceName,
+				UserID:       task.UserID,
+				TaskID:       task.ID,
+				Region:       task.OciRegion,
+				Username:     "root",
+				Password:     encrypted,
+				SSHPort:      sshPort,
+				CreateTime:   time.Now(),
+			}
+			if err := database.GetDB().Create(&credential).Error; err != nil {
+				slog.Error("Failed to save instance credential", "task_id", task.ID, "instance_id", *instance.Id, "error", err)
+			}
+		}
+	}
+
+	if s.telegram == nil {
+		return
+	}
+	msg := fmt.Sprintf("🔑 配置名：【%s】\n🌏 区域：【%s】\n🖥️ 实例：【%s】\n⚙️ 规格：【%s】",
+		html.EscapeString(task.Username), task.OciRegion, html.EscapeString(instanceName), *instance.Shape)
+	if rootPassword != "" {
+		msg += fmt.Sprintf("\n👤 用户名：<code>root</code>\n🔒 密码：<code>%s</code>\n🚪 SSH端口：%d", html.EscapeString(rootPassword), sshPort)
+		if sshPort != 22 {
+			msg += "\n⚠️ 请确认安全列表已放行该端口"
+		}
+	}
+	if err := s.telegram.SendNotification("实例创建成功", msg); err != nil {
+		slog.Warn("Failed to send instance created notification", "task_id", task.ID, "error", err)
+	}
+}
+
+// loadAuthorizedKeys 读取任务关联的全部 SSH 公钥，合并为 ssh_authorized_keys 格式
+func loadAuthorizedKeys(task *models.OciCreateTask) (string, error) {
+	ids := append([]string{task.SSHKeyID}, task.SSHKeyIDs...)
+	var keys []models.SSHKey
+	if err := database.GetDB().Where("id IN ?", ids).Find(&keys).Error; err != nil {
+		return "", fmt.Errorf("读取SSH密钥失败: %v", err)
+	}
+
+	keyMap := make(map[string]string, len(keys))
+	for _, key := range keys {
+		keyMap[key.ID] = key.PublicKey
+	}
+	if _, ok := keyMap[task.SSHKeyID]; !ok {
+		return "", fmt.Errorf("SSH密钥不存在: %s", task.SSHKeyID)
+	}
+
+	// 按任务中的顺序输出，已删除的额外密钥直接跳过
+	publicKeys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if key, ok := keyMap[id]; ok {
+			publicKeys = append(publicKeys, key)
+			delete(keyMap, id)
+		}
+	}
+	return JoinAuthorizedKeys(publicKeys), nil
+}
+
+// loadUserData 读取任务关联的用户数据模板内容，未指定模板时返回空
+func loadUserData(userDataID string) (string, error) {
+	if userDataID == "" {
+		return "", nil
+	}
+	var tpl models.UserDataTemplate
+	if err := database.GetDB().Where("id = ?", userDataID).First(&tpl).Error; err != nil {
+		return "", fmt.Errorf("用户数据模板不存在: %v", err)
+	}
+	return tpl.Content, nil
+}
+
+// logTaskExecution 写入任务日志，记录执行指标，并按结果级别输出结构化日志，ctx 中应带有 task_id 等字段
+// 容量不足和限流是抢机任务的常态，按 info 输出，其他失败按 warn 输出
+func (s *TaskService) logTaskExecution(ctx context.Context, taskID, configID, status, message string) {
+	level := slog.LevelInfo
+	attrs := []any{"status", status, "message", message}
+	switch status {
+	case "error":
+		class := classifyTaskError(message)
+		if class != "capacity" && class != "rate_limit" {
+			level = slog.LevelWarn
+		}
+		attrs = append(attrs, "class", class)
+	case TaskStatusPaused:
+		level = slog.LevelWarn
+	}
+	slog.Log(ctx, level, "Task execution", attrs...)
+	recordTaskExecution(configID, status, message)
+
 	db := database.GetDB()
 	logEntry := models.TaskLog{
 		ID:          uuid.New().String(),
@@ -221,6 +408,42 @@ func (s *TaskService) StopTask(taskID string) error {
 	return nil
 }
 
+// TaskStatusPaused 配置凭据失效时自动暂停的任务状态，凭据恢复后自动继续
+const TaskStatusPaused = "paused"
+
+// PauseUserTasks 暂停配置下所有运行中的任务，返回暂停的任务数
+func (s *TaskService) PauseUserTasks(userID, reason string) int {
+	db := database.GetDB()
+	var tasks []models.OciCreateTask
+	db.Where("user_id = ? AND status = ?", userID, "running").Find(&tasks)
+
+	for _, task := range tasks {
+		if err := db.Model(&models.OciCreateTask{}).Where("id = ?", task.ID).Update("status", TaskStatusPaused).Error; err != nil {
+			continue
+		}
+		s.removeTaskTimer(task.ID)
+		s.logTaskExecution(logger.With(context.Background(), "task_id", task.ID, "config_id", userID), task.ID, userID, TaskStatusPaused, "任务已暂停: "+reason)
+	}
+	return len(tasks)
+}
+
+// ResumeUserTasks 恢复配置下因凭据失效而暂停的任务，返回恢复的任务数
+func (s *TaskService) ResumeUserTasks(userID string) int {
+	db := database.GetDB()
+	var tasks []models.OciCreateTask
+	db.Where("user_id = ? AND status = ?", userID, TaskStatusPaused).Find(&tasks)
+
+	for _, task := range tasks {
+		task.Status = "running"
+		if err := db.Model(&models.OciCreateTask{}).Where("id = ?", task.ID).Update("status", task.Status).Error; err != nil {
+			continue
+		}
+		s.scheduleTask(task)
+		s.logTaskExecution(logger.With(context.Background(), "task_id", task.ID, "config_id", userID), task.ID, userID, "running", "配置凭据已恢复，任务继续执行")
+	}
+	return len(tasks)
+}
+
 func (s *TaskService) DeleteTask(taskID string) error {
 	s.removeTaskTimer(taskID)
 
@@ -257,22 +480,41 @@ func (s *TaskService) ExecuteTaskOnce(taskID string) error {
 	if err := db.Where("id = ?", taskID).First(&task).Error; err != nil {
 		return fmt.Errorf("任务不存在: %w", err)
 	}
+	ctx := logger.With(context.Background(), "task_id", taskID, "config_id", task.UserID)
 
 	var user models.OciUser
 	if err := db.Where("id = ?", task.UserID).First(&user).Error; err != nil {
-		s.logTaskExecution(taskID, "error", fmt.Sprintf("配置不存在: %v", err))
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", fmt.Sprintf("配置不存在: %v", err))
 		return fmt.Errorf("配置不存在: %w", err)
 	}
 
-	var sshKey models.SSHKey
-	if err := db.Where("id = ?", task.SSHKeyID).First(&sshKey).Error; err != nil {
-		s.logTaskExecution(taskID, "error", fmt.Sprintf("SSH密钥不存在: %v", err))
-		return fmt.Errorf("SSH密钥不存在: %w", err)
+	authorizedKeys, err := loadAuthorizedKeys(&task)
+	if err != nil {
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", err.Error())
+		return err
 	}
 
-	ctx := context.Background()
-	err := s.ociService.CreateInstance(ctx, &user, task.OciRegion, task.Architecture, task.OperationSystem,
-		task.Ocpus, task.Memory, task.Disk, task.BootVolumeVpu, sshKey.PublicKey, task.ImageId)
+	userData, err := loadUserData(task.UserDataID)
+	if err != nil {
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", err.Error())
+		return err
+	}
+
+	rootPassword, err := taskRootPassword(&task)
+	if err != nil {
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", err.Error())
+		return err
+	}
+
+	ctx = logger.With(ctx, "config", user.Username)
+	ctx, finish, err := s.beginCreate(ctx, &task)
+	if err != nil {
+		return err
+	}
+	params := taskCreateParams(&task, authorizedKeys, userData)
+	params.RootPassword = rootPassword
+	instance, err := s.ociService.CreateInstance(ctx, &user, params)
+	finish(err)
 
 	now := time.Now()
 	task.ExecuteCount++
@@ -282,7 +524,7 @@ func (s *TaskService) ExecuteTaskOnce(taskID string) error {
 		errMsg := extractOCIErrorMessage(err)
 		task.LastMessage = errMsg
 		task.Status = "error"
-		s.logTaskExecution(taskID, "error", errMsg)
+		s.logTaskExecution(ctx, taskID, task.UserID, "error", errMsg)
 		db.Save(&task)
 		return fmt.Errorf("%s", errMsg)
 	}
@@ -290,7 +532,15 @@ func (s *TaskService) ExecuteTaskOnce(taskID string) error {
 	task.SuccessCount++
 	task.Status = "completed"
 	task.LastMessage = "创建成功"
-	s.logTaskExecution(taskID, "success", "创建成功")
+	s.logTaskExecution(ctx, taskID, task.UserID, "success", "创建成功")
 	db.Save(&task)
+	s.onInstanceCreated(&task, instance, rootPassword)
 	return nil
 }
+
+// ValidateShape 校验任务规格及 OCPU/内存配置
+func (s *TaskService) ValidateShape(user *models.OciUser, region, shape string, ocpus, memory float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return s.ociService.ValidateShape(ctx, user, region, shape, ocpus, memory)
+}
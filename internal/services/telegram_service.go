@@ -4,7 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -28,6 +29,7 @@ type TelegramService struct {
 	chatID     string
 	enabled    bool
 	ociService *OCIService
+	health     *HealthService
 	mu         sync.RWMutex
 	stopChan   chan struct{}
 	running    bool
@@ -88,6 +90,11 @@ func NewTelegramService(ociService *OCIService) *TelegramService {
 	return ts
 }
 
+// SetHealthService 设置健康检查服务，API 测活复用其检查逻辑
+func (s *TelegramService) SetHealthService(health *HealthService) {
+	s.health = health
+}
+
 func (s *TelegramService) loadConfig() {
 	db := database.GetDB()
 
@@ -268,7 +275,7 @@ func (s *TelegramService) StartBot() {
 	s.mu.Unlock()
 
 	go s.pollUpdates()
-	log.Println("Telegram bot started")
+	slog.Info("Telegram bot started")
 }
 
 func (s *TelegramService) StopBot() {
@@ -280,7 +287,7 @@ func (s *TelegramService) StopBot() {
 	s.running = false
 	close(s.stopChan)
 	s.mu.Unlock()
-	log.Println("Telegram bot stopped")
+	slog.Info("Telegram bot stopped")
 }
 
 func (s *TelegramService) IsRunning() bool {
@@ -299,7 +306,7 @@ func (s *TelegramService) pollUpdates() {
 		default:
 			updates, err := s.getUpdates(offset)
 			if err != nil {
-				log.Printf("Error getting updates: %v", err)
+				slog.Warn("Failed to get Telegram updates", "error", err)
 				time.Sleep(5 * time.Second)
 				continue
 			}
@@ -391,6 +398,10 @@ func (s *TelegramService) getMainKeyboard() *InlineKeyboardMarkup {
 				{Text: "ℹ️ 版本信息", CallbackData: "version_info"},
 				{Text: "📊 流量统计", CallbackData: "traffic_stats"},
 			},
+			{
+				{Text: "💰 费用统计", CallbackData: "cost_stats"},
+				{Text: "😴 闲置风险", CallbackData: "idle_risk"},
+			},
 			{
 				{Text: "⭐ 开源地址（欢迎Star）", URL: "https://github.com/adiecho/oci-panel"},
 			},
@@ -442,44 +453,53 @@ func (s *TelegramService) handleCallback(callback *struct {
 		text := s.getTrafficStats()
 		s.editMessage(chatID, messageID, text, s.getMainKeyboard())
 
+	case "cost_stats":
+		text := s.getCostStats()
+		s.editMessage(chatID, messageID, text, s.getMainKeyboard())
+
+	case "idle_risk":
+		text := s.getIdleRisk()
+		s.editMessage(chatID, messageID, text, s.getMainKeyboard())
+
 	case "cancel":
 		s.deleteMessage(chatID, messageID)
 	}
 }
 
 func (s *TelegramService) checkAlive() string {
-	db := database.GetDB()
-
-	var users []models.OciUser
-	if err := db.Find(&users).Error; err != nil {
-		return "❌ 获取配置失败"
+	if s.health == nil {
+		return "❌ 健康检查服务未启动"
 	}
 
-	if len(users) == 0 {
+	results := s.health.CheckAll()
+	if len(results) == 0 {
 		return "【API测活结果】\n\n暂无配置"
 	}
 
-	var validCount, invalidCount int
-	var invalidNames []string
+	var validCount, invalidCount, errorCount int
+	var invalidNames, errorNames []string
 
-	for _, user := range users {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		_, err := s.ociService.ListInstances(ctx, &user, user.OciTenantID)
-		cancel()
-
-		if err != nil {
-			invalidCount++
-			invalidNames = append(invalidNames, user.Username)
-		} else {
+	for _, r := range results {
+		switch r.Status {
+		case HealthStatusOK:
 			validCount++
+		case HealthStatusInvalid:
+			invalidCount++
+			invalidNames = append(invalidNames, r.Username)
+		default:
+			errorCount++
+			errorNames = append(errorNames, r.Username)
 		}
 	}
 
-	result := fmt.Sprintf("【API测活结果】\n\n✅ 有效配置数：%d\n❌ 失效配置数：%d\n🔑 总配置数：%d",
-		validCount, invalidCount, len(users))
+	result := fmt.Sprintf("【API测活结果】\n\n✅ 有效配置数：%d\n❌ 失效配置数：%d\n⚠️ 检查失败数：%d\n🔑 总配置数：%d",
+		validCount, invalidCount, errorCount, len(results))
 
 	if len(invalidNames) > 0 {
-		result += fmt.Sprintf("\n\n⚠️ 失效配置：\n%s", strings.Join(invalidNames, "\n"))
+		result += fmt.Sprintf("\n\n❌ 失效配置（任务已暂停）：\n%s", strings.Join(invalidNames, "\n"))
+	}
+	if len(errorNames) > 0 {
+		result += fmt.Sprintf("\n\n⚠️ 检查失败：\n%s", strings.Join(errorNames, "\n"))
 	}
 
 	return result
@@ -616,6 +636,95 @@ func (s *TelegramService) getTrafficStats() string {
 		strings.Join(stats, "\n\n"))
 }
 
+// getCostStats 本月费用统计，优先使用缓存
+func (s *TelegramService) getCostStats() string {
+	db := database.GetDB()
+
+	var users []models.OciUser
+	if err := db.Find(&users).Error; err != nil {
+		return "❌ 获取配置失败"
+	}
+
+	if len(users) == 0 {
+		return "【费用统计】\n\n暂无配置"
+	}
+
+	var stats []string
+	for _, user := range users {
+		var cost *models.CostUsageReport
+		var cache models.OciConfigCache
+		if db.Where("config_id = ?", user.ID).First(&cache).Error == nil {
+			cost = CachedCost(&cache)
+		}
+		if cost == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+			var err error
+			cost, err = s.ociService.GetCostUsage(ctx, &user)
+			cancel()
+			if err != nil {
+				stats = append(stats, fmt.Sprintf("❌ %s: 获取失败", user.Username))
+				continue
+			}
+		}
+
+		text := fmt.Sprintf("🔑 配置名：【%s】\n💵 本月已产生：%.2f %s\n📈 预计月底：%.2f %s",
+			user.Username, cost.MonthToDate, cost.Currency, cost.ForecastMonthEnd, cost.Currency)
+		if len(cost.ByService) > 0 {
+			top := cost.ByService[0]
+			text += fmt.Sprintf("\n🏷️ 最高服务：%s（%.2f）", top.Name, top.Amount)
+		}
+		if cost.TrialCredit != nil {
+			text += fmt.Sprintf("\n🎁 试用额度剩余：%.2f / %.2f %s", cost.TrialCredit.Remaining, cost.TrialCredit.Amount, cost.TrialCredit.Currency)
+			if cost.TrialCredit.ExpireTime != "" {
+				text += fmt.Sprintf("（%s 到期）", cost.TrialCredit.ExpireTime)
+			}
+		}
+		text += fmt.Sprintf("\n🕐 数据时间：%s", cost.UpdateTime)
+		stats = append(stats, text)
+	}
+
+	return fmt.Sprintf("【费用统计】\n\n🕐 时间：%s\n\n%s",
+		time.Now().Format("2006-01-02 15:04:05"),
+		strings.Join(stats, "\n\n"))
+}
+
+// getIdleRisk 列出有空闲回收风险的 Always Free 实例，使用最近一次定时评估的结果
+func (s *TelegramService) getIdleRisk() string {
+	db := database.GetDB()
+
+	var users []models.OciUser
+	if err := db.Find(&users).Error; err != nil {
+		return "❌ 获取配置失败"
+	}
+	names := map[string]string{}
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+
+	var assessments []models.OciIdleAssessment
+	if err := db.Where("status IN ?", []string{IdleStatusAtRisk, IdleStatusIdle}).Order("config_id, instance_name").Find(&assessments).Error; err != nil {
+		return "❌ 获取评估结果失败"
+	}
+	if len(assessments) == 0 {
+		return fmt.Sprintf("【闲置风险】\n\n🕐 时间：%s\n\n✅ 暂无有回收风险的实例", time.Now().Format("2006-01-02 15:04:05"))
+	}
+
+	var stats []string
+	for _, a := range assessments {
+		icon := "⚠️"
+		if a.Status == IdleStatusIdle {
+			icon = "🚨"
+		}
+		stats = append(stats, fmt.Sprintf("%s 【%s】%s\n📍 %s（%s）\n📉 %s\n🕐 评估时间：%s",
+			icon, html.EscapeString(names[a.ConfigID]), html.EscapeString(a.InstanceName), a.Region, a.Shape,
+			html.EscapeString(a.Reason), a.UpdateTime.Format("2006-01-02 15:04:05")))
+	}
+
+	return fmt.Sprintf("【闲置风险】\n\n🕐 时间：%s\n\n%s",
+		time.Now().Format("2006-01-02 15:04:05"),
+		strings.Join(stats, "\n\n"))
+}
+
 func (s *TelegramService) SendNotification(title, message string) error {
 	text := fmt.Sprintf("<b>%s</b>\n\n%s\n\n🕐 %s",
 		title, message, time.Now().Format("2006-01-02 15:04:05"))
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TrafficResolutionAuto  = "auto"
+	TrafficResolutionHour  = "hour"
+	TrafficResolutionDay   = "day"
+	TrafficResolutionMonth = "month"
+)
+
+const (
+	// TrafficCollectInterval 流量采集间隔
+	TrafficCollectInterval = time.Hour
+	// trafficBackfill 首次采集时回溯的时长
+	trafficBackfill = 7 * 24 * time.Hour
+	// trafficHourRetention 小时数据保留时长，更早的数据只保留日和月汇总
+	trafficHourRetention = 31 * 24 * time.Hour
+	// trafficDayRetention 日数据保留时长，月汇总永久保留
+	trafficDayRetention = 400 * 24 * time.Hour
+	// trafficCollectConcurrency 并发采集的配置数
+	trafficCollectConcurrency = 3
+	// trafficMaxPoints 单次查询返回的最大时间点数
+	trafficMaxPoints = 5000
+)
+
+// CollectVnicTraffic 按小时采集所有订阅区域中实例 VNIC 的入站和出站字节数
+// VnicFromNetworkBytes 为 VNIC 从网络接收（入站），VnicToNetworkBytes 为 VNIC 发往网络（出站）
+func (s *OCIService) CollectVnicTraffic(ctx context.Context, user *models.OciUser, start, end time.Time) ([]models.OciTrafficSample, []string) {
+	compartments, err := s.ResolveCompartments(ctx, user, user.OciTenantID, true)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	var (
+		result []models.OciTrafficSample
+		errs   []string
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	semaphore := make(chan struct{}, regionConcurrency)
+	for _, region := range s.ListSubscribedRegions(ctx, user) {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(region string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			regionUser := *user
+			regionUser.OciRegion = region
+			for _, compartmentID := range compartments {
+				samples, err := s.compartmentVnicTraffic(ctx, &regionUser, compartmentID, start, end)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", region, err))
+				}
+				result = append(result, samples...)
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}(region)
+	}
+	wg.Wait()
+	return result, errs
+}
+
+func (s *OCIService) compartmentVnicTraffic(ctx context.Context, user *models.OciUser, compartmentID string, start, end time.Time) ([]models.OciTrafficSample, error) {
+	instances, vnicOwner, err := s.compartmentInstanceVnics(ctx, user, compartmentID)
+	if err != nil || len(instances) == 0 {
+		return nil, err
+	}
+
+	type bucketKey struct {
+		vnicID string
+		bucket time.Time
+	}
+	buckets := map[bucketKey]*models.OciTrafficSample{}
+	for _, metric := range []string{"VnicFromNetworkBytes", "VnicToNetworkBytes"} {
+		items, err := s.summarizeVnicMetric(ctx, user, compartmentID, metric+"[1h].groupBy(resourceId).sum()", start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			vnicID := item.Dimensions["resourceId"]
+			owner, ok := vnicOwner[vnicID]
+			if !ok {
+				continue
+			}
+			for _, dp := range item.AggregatedDatapoints {
+				if dp.Timestamp == nil || dp.Value == nil {
+					continue
+				}
+				key := bucketKey{vnicID: vnicID, bucket: dp.Timestamp.UTC().Truncate(time.Hour)}
+				sample, ok := buckets[key]
+				if !ok {
+					sample = &models.OciTrafficSample{
+						ConfigID:     user.ID,
+						InstanceID:   owner.InstanceID,
+						InstanceName: owner.Name,
+						Region:       owner.Region,
+						VnicID:       vnicID,
+						Resolution:   TrafficResolutionHour,
+						BucketTime:   key.bucket,
+					}
+					buckets[key] = sample
+				}
+				if metric == "VnicFromNetworkBytes" {
+					sample.InBytes += int64(*dp.Value)
+				} else {
+					sample.OutBytes += int64(*dp.Value)
+				}
+			}
+		}
+	}
+
+	result := make([]models.OciTrafficSample, 0, len(buckets))
+	for _, sample := range buckets {
+		result = append(result, *sample)
+	}
+	return result, nil
+}
+
+// trafficBucketStart 返回时间所在粒度时间段的 UTC 起点
+func trafficBucketStart(t time.Time, resolution string) time.Time {
+	t = t.UTC()
+	switch resolution {
+	case TrafficResolutionDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case TrafficResolutionMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// trafficBucketNext 返回下一个时间段的起点
+func trafficBucketNext(t time.Time, resolution string) time.Time {
+	switch resolution {
+	case TrafficResolutionDay:
+		return t.AddDate(0, 0, 1)
+	case TrafficResolutionMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.Add(time.Hour)
+}
+
+// autoTrafficResolution 根据时间范围选择粒度，超出小时数据保留期时使用日汇总
+func autoTrafficResolution(start, end time.Time) string {
+	span := end.Sub(start)
+	switch {
+	case span <= 72*time.Hour && time.Since(start) <= trafficHourRetention:
+		return TrafficResolutionHour
+	case span <= 92*24*time.Hour:
+		return TrafficResolutionDay
+	}
+	return TrafficResolutionMonth
+}
+
+type TrafficHistoryService struct {
+	ociService *OCIService
+	stopChan   chan struct{}
+	running    bool
+	mutex      sync.Mutex
+
+	// lastCollected 每个配置上次采集的时间，重启后重新采集一次，写入是幂等的
+	lastCollected sync.Map
+	collecting    atomic.Bool
+}
+
+func NewTrafficHistoryService(ociService *OCIService) *TrafficHistoryService {
+	return &TrafficHistoryService{
+		ociService: ociService,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+func (s *TrafficHistoryService) Start() {
+	s.mutex.Lock()
+	if s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = true
+	s.stopChan = make(chan struct{})
+	s.mutex.Unlock()
+
+	go s.run()
+	slog.Info("Traffic history service started")
+}
+
+func (s *TrafficHistoryService) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.running {
+		return
+	}
+	close(s.stopChan)
+	s.running = false
+	slog.Info("Traffic history service stopped")
+}
+
+func (s *TrafficHistoryService) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			go s.collectDue()
+		}
+	}
+}
+
+// collectDue 采集超过采集间隔的配置，上一轮未结束时跳过
+func (s *TrafficHistoryService) collectDue() {
+	if !s.collecting.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.collecting.Store(false)
+
+	var users []models.OciUser
+	database.GetDB().Find(&users)
+
+	semaphore := make(chan struct{}, trafficCollectConcurrency)
+	var wg sync.WaitGroup
+	for i := range users {
+		if last, ok := s.lastCollected.Load(users[i].ID); ok && time.Since(last.(time.Time)) < TrafficCollectInterval {
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(user *models.OciUser) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if err := s.Collect(user); err != nil {
+				slog.Error("Failed to collect traffic", "config", user.Username, "config_id", user.ID, "error", err)
+			}
+		}(&users[i])
+	}
+	wg.Wait()
+	s.prune()
+}
+
+// Collect 采集配置的小时流量并更新日、月汇总
+// 从上次采集的最后一小时之前两小时开始，补齐上次采集时尚未完整的时间段
+func (s *TrafficHistoryService) Collect(user *models.OciUser) error {
+	db := database.GetDB()
+	now := time.Now().UTC()
+	start := now.Add(-trafficBackfill).Truncate(time.Hour)
+	var latest models.OciTrafficSample
+	if db.Where("config_id = ? AND resolution = ?", user.ID, TrafficResolutionHour).Order("bucket_time DESC").First(&latest).Error == nil {
+		if resume := latest.BucketTime.Add(-2 * time.Hour); resume.After(start) {
+			start = resume
+		}
+	}
+
+	samples, errs := s.ociService.CollectVnicTraffic(context.Background(), user, start, now)
+	s.lastCollected.Store(user.ID, time.Now())
+	for _, e := range errs {
+		slog.Warn("Partial traffic history", "config", user.Username, "config_id", user.ID, "error", e)
+	}
+	if len(samples) == 0 {
+		if len(errs) > 0 {
+			return fmt.Errorf("%s", errs[0])
+		}
+		return nil
+	}
+
+	if err := upsertTrafficSamples(samples); err != nil {
+		return err
+	}
+	if err := s.rollup(user.ID, TrafficResolutionHour, TrafficResolutionDay, start); err != nil {
+		return err
+	}
+	return s.rollup(user.ID, TrafficResolutionDay, TrafficResolutionMonth, start)
+}
+
+func upsertTrafficSamples(samples []models.OciTrafficSample) error {
+	for i := range samples {
+		samples[i].ID = uuid.New().String()
+	}
+	return database.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "vnic_id"}, {Name: "resolution"}, {Name: "bucket_time"}},
+		DoUpdates: clause.AssignmentColumns([]string{"instance_id", "instance_name", "region", "in_bytes", "out_bytes"}),
+	}).CreateInBatches(samples, 200).Error
+}
+
+// rollup 用较细粒度的数据重新计算 since 所在时间段之后的较粗粒度汇总
+func (s *TrafficHistoryService) rollup(configID, from, to string, since time.Time) error {
+	start := trafficBucketStart(since, to)
+	var rows []models.OciTrafficSample
+	if err := database.GetDB().Where("config_id = ? AND resolution = ? AND bucket_time >= ?", configID, from, start).
+		Order("bucket_time").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	type bucketKey struct {
+		vnicID string
+		bucket time.Time
+	}
+	buckets := map[bucketKey]*models.OciTrafficSample{}
+	for _, row := range rows {
+		key := bucketKey{vnicID: row.VnicID, bucket: trafficBucketStart(row.BucketTime, to)}
+		sample, ok := buckets[key]
+		if !ok {
+			sample = &models.OciTrafficSample{
+				ConfigID:   configID,
+				VnicID:     row.VnicID,
+				Resolution: to,
+				BucketTime: key.bucket,
+			}
+			buckets[key] = sample
+		}
+		sample.InstanceID = row.InstanceID
+		sample.InstanceName = row.InstanceName
+		sample.Region = row.Region
+		sample.InBytes += row.InBytes
+		sample.OutBytes += row.OutBytes
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	samples := make([]models.OciTrafficSample, 0, len(buckets))
+	for _, sample := range buckets {
+		samples = append(samples, *sample)
+	}
+	return upsertTrafficSamples(samples)
+}
+
+// prune 清理超过保留期的小时和日数据
+func (s *TrafficHistoryService) prune() {
+	db := database.GetDB()
+	now := time.Now().UTC()
+	db.Where("resolution = ? AND bucket_time < ?", TrafficResolutionHour, now.Add(-trafficHourRetention)).Delete(&models.OciTrafficSample{})
+	db.Where("resolution = ? AND bucket_time < ?", TrafficResolutionDay, now.Add(-trafficDayRetention)).Delete(&models.OciTrafficSample{})
+}
+
+// History 查询本地保存的历史流量，instanceID 为空时汇总整个配置
+// resolution 为空或 auto 时根据时间范围自动选择粒度，缺失的时间段补 0
+func (s *TrafficHistoryService) History(configID, instanceID string, start, end time.Time, resolution string) (*models.TrafficHistory, error) {
+	if !end.After(start) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	switch resolution {
+	case "", TrafficResolutionAuto:
+		resolution = autoTrafficResolution(start, end)
+	case TrafficResolutionHour, TrafficResolutionDay, TrafficResolutionMonth:
+	default:
+		return nil, fmt.Errorf("不支持的粒度: %s", resolution)
+	}
+
+	start = trafficBucketStart(start, resolution)
+	end = end.UTC()
+	count := 0
+	for t := start; t.Before(end); t = trafficBucketNext(t, resolution) {
+		if count++; count > trafficMaxPoints {
+			return nil, fmt.Errorf("时间范围过大，请使用更粗的粒度")
+		}
+	}
+
+	query := database.GetDB().Where("config_id = ? AND resolution = ? AND bucket_time >= ? AND bucket_time < ?", configID, resolution, start, end)
+	if instanceID != "" {
+		query = query.Where("instance_id = ?", instanceID)
+	}
+	var rows []models.OciTrafficSample
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	history := &models.TrafficHistory{
+		Resolution: resolution,
+		StartTime:  start,
+		EndTime:    end,
+		Points:     make([]models.TrafficHistoryPoint, 0, count),
+		Instances:  []models.TrafficHistoryTotal{},
+	}
+	points := map[time.Time]*models.TrafficHistoryPoint{}
+	for t := start; t.Before(end); t = trafficBucketNext(t, resolution) {
+		history.Points = append(history.Points, models.TrafficHistoryPoint{Time: t})
+	}
+	for i := range history.Points {
+		points[history.Points[i].Time] = &history.Points[i]
+	}
+
+	totals := map[string]*models.TrafficHistoryTotal{}
+	for _, row := range rows {
+		if point, ok := points[row.BucketTime.UTC()]; ok {
+			point.Inbound += row.InBytes
+			point.Outbound += row.OutBytes
+		}
+		total, ok := totals[row.InstanceID]
+		if !ok {
+			total = &models.TrafficHistoryTotal{InstanceID: row.InstanceID}
+			totals[row.InstanceID] = total
+		}
+		total.InstanceName = row.InstanceName
+		total.Region = row.Region
+		total.Inbound += row.InBytes
+		total.Outbound += row.OutBytes
+		history.Inbound += row.InBytes
+		history.Outbound += row.OutBytes
+	}
+	for _, total := range totals {
+		history.Instances = append(history.Instances, *total)
+	}
+	sort.Slice(history.Instances, func(i, j int) bool { return history.Instances[i].Outbound > history.Instances[j].Outbound })
+	return history, nil
+}
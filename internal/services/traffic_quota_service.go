@@ -0,0 +1,673 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/models"
+	"github.com/google/uuid"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/monitoring"
+	"gorm.io/gorm"
+)
+
+const (
+	TrafficActionNone         = "none"
+	TrafficActionStop         = "stop"
+	TrafficActionDetachIP     = "detach_ip"
+	TrafficActionTightenRules = "tighten_rules"
+)
+
+const (
+	TrafficEventWarn   = "warn"
+	TrafficEventAction = "action"
+	TrafficEventError  = "error"
+)
+
+// TrafficQuotaCheckInterval 流量配额检查间隔，流量指标按天聚合，无需频繁查询
+const TrafficQuotaCheckInterval = time.Hour
+
+// DefaultTrafficLimitBytes Always Free 每月 10TB 出站流量
+const DefaultTrafficLimitBytes int64 = 10 << 40
+
+// defaultTrafficWarnPercents 未指定告警阈值时使用
+var defaultTrafficWarnPercents = []int{80, 90}
+
+// InstanceEgress 实例本月出站流量
+type InstanceEgress struct {
+	InstanceID string   `json:"instanceId"`
+	Name       string   `json:"name"`
+	Region     string   `json:"region"`
+	Shape      string   `json:"shape"`
+	State      string   `json:"state"`
+	VnicIDs    []string `json:"-"`
+	Bytes      int64    `json:"bytes"`
+}
+
+// CollectMonthlyEgress 统计所有订阅区域和区间中实例本月的出站流量
+// VnicToNetworkBytes 是 VNIC 发往网络的字节数，即出站流量；单个区域失败记录在 errs 中
+func (s *OCIService) CollectMonthlyEgress(ctx context.Context, user *models.OciUser) ([]InstanceEgress, []string) {
+	compartments, err := s.ResolveCompartments(ctx, user, user.OciTenantID, true)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var (
+		result []InstanceEgress
+		errs   []string
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	semaphore := make(chan struct{}, regionConcurrency)
+	for _, region := range s.ListSubscribedRegions(ctx, user) {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(region string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			regionUser := *user
+			regionUser.OciRegion = region
+			for _, compartmentID := range compartments {
+				items, err := s.compartmentEgress(ctx, &regionUser, compartmentID, monthStart, now)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", region, err))
+				}
+				result = append(result, items...)
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}(region)
+	}
+	wg.Wait()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Bytes > result[j].Bytes })
+	return result, errs
+}
+
+// compartmentEgress 统计单个区间中实例的出站流量，按 VNIC 分组查询一次监控指标
+func (s *OCIService) compartmentEgress(ctx context.Context, user *models.OciUser, compartmentID string, start, end time.Time) ([]InstanceEgress, error) {
+	instances, vnicOwner, err := s.compartmentInstanceVnics(ctx, user, compartmentID)
+	if err != nil || len(instances) == 0 {
+		return nil, err
+	}
+
+	metrics, err := s.summarizeVnicMetric(ctx, user, compartmentID, "VnicToNetworkBytes[1d].groupBy(resourceId).sum()", start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, metric := range metrics {
+		item, ok := vnicOwner[metric.Dimensions["resourceId"]]
+		if !ok {
+			continue
+		}
+		for _, dp := range metric.AggregatedDatapoints {
+			if dp.Value != nil {
+				item.Bytes += int64(*dp.Value)
+			}
+		}
+	}
+
+	result := make([]InstanceEgress, 0, len(instances))
+	for _, item := range instances {
+		result = append(result, *item)
+	}
+	return result, nil
+}
+
+// compartmentInstanceVnics 列出区间中未终止的实例及其 VNIC，返回 VNIC ID 到实例的映射
+func (s *OCIService) compartmentInstanceVnics(ctx context.Context, user *models.OciUser, compartmentID string) ([]*InstanceEgress, map[string]*InstanceEgress, error) {
+	instances, err := s.ListInstances(ctx, user, compartmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := map[string]*InstanceEgress{}
+	var ordered []*InstanceEgress
+	for _, instance := range instances {
+		if instance.Id == nil || instance.LifecycleState == core.InstanceLifecycleStateTerminated {
+			continue
+		}
+		item := &InstanceEgress{
+			InstanceID: *instance.Id,
+			Name:       stringValue(instance.DisplayName),
+			Region:     user.OciRegion,
+			Shape:      stringValue(instance.Shape),
+			State:      string(instance.LifecycleState),
+		}
+		byID[item.InstanceID] = item
+		ordered = append(ordered, item)
+	}
+	if len(ordered) == 0 {
+		return nil, nil, nil
+	}
+
+	computeClient, err := s.GetComputeClient(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	vnicOwner := map[string]*InstanceEgress{}
+	req := core.ListVnicAttachmentsRequest{CompartmentId: &compartmentID}
+	for {
+		resp, err := computeClient.ListVnicAttachments(ctx, req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list VNIC attachments: %w", err)
+		}
+		for _, attach := range resp.Items {
+			if attach.VnicId == nil || attach.InstanceId == nil {
+				continue
+			}
+			if item, ok := byID[*attach.InstanceId]; ok {
+				item.VnicIDs = append(item.VnicIDs, *attach.VnicId)
+				vnicOwner[*attach.VnicId] = item
+			}
+		}
+		if resp.OpcNextPage == nil {
+			break
+		}
+		req.Page = resp.OpcNextPage
+	}
+	return ordered, vnicOwner, nil
+}
+
+// summarizeVnicMetric 在 oci_vcn 命名空间中查询区间内的 VNIC 指标
+func (s *OCIService) summarizeVnicMetric(ctx context.Context, user *models.OciUser, compartmentID, query string, start, end time.Time) ([]monitoring.MetricData, error) {
+	configProvider, err := s.GetConfigProvider(user)
+	if err != nil {
+		return nil, err
+	}
+	monitoringClient, err := monitoring.NewMonitoringClientWithConfigurationProvider(configProvider)
+	if err != nil {
+		return nil, err
+	}
+	instrumentClient(&monitoringClient.BaseClient)
+	resp, err := monitoringClient.SummarizeMetricsData(ctx, monitoring.SummarizeMetricsDataRequest{
+		CompartmentId: &compartmentID,
+		SummarizeMetricsDataDetails: monitoring.SummarizeMetricsDataDetails{
+			Namespace: stringPtr("oci_vcn"),
+			Query:     &query,
+			StartTime: &common.SDKTime{Time: start},
+			EndTime:   &common.SDKTime{Time: end},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query VNIC metrics: %w", err)
+	}
+	return resp.Items, nil
+}
+
+// DetachPublicIPs 移除 VNIC 上的公网 IP：临时 IP 直接删除，保留 IP 解除绑定以便之后重新分配
+func (s *OCIService) DetachPublicIPs(ctx context.Context, user *models.OciUser, vnicIDs []string) ([]string, error) {
+	vnClient, err := s.GetVirtualNetworkClient(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var detached []string
+	for _, vnicID := range vnicIDs {
+		vnicResp, err := vnClient.GetVnic(ctx, core.GetVnicRequest{VnicId: common.String(vnicID)})
+		if err != nil {
+			return detached, fmt.Errorf("failed to get VNIC: %w", err)
+		}
+		if stringValue(vnicResp.PublicIp) == "" {
+			continue
+		}
+		ipResp, err := vnClient.GetPublicIpByIpAddress(ctx, core.GetPublicIpByIpAddressRequest{
+			GetPublicIpByIpAddressDetails: core.GetPublicIpByIpAddressDetails{IpAddress: vnicResp.PublicIp},
+		})
+		if err != nil {
+			return detached, fmt.Errorf("failed to get public IP by address: %w", err)
+		}
+		if ipResp.Lifetime == core.PublicIpLifetimeEphemeral {
+			_, err = vnClient.DeletePublicIp(ctx, core.DeletePublicIpRequest{PublicIpId: ipResp.Id})
+		} else {
+			_, err = vnClient.UpdatePublicIp(ctx, core.UpdatePublicIpRequest{
+				PublicIpId:            ipResp.Id,
+				UpdatePublicIpDetails: core.UpdatePublicIpDetails{PrivateIpId: stringPtr("")},
+			})
+		}
+		if err != nil {
+			return detached, fmt.Errorf("failed to detach public IP %s: %w", *vnicResp.PublicIp, err)
+		}
+		detached = append(detached, *vnicResp.PublicIp)
+	}
+	return detached, nil
+}
+
+// TightenIngressRules 删除 VNIC 所在子网安全列表中对公网开放的入站规则，保留 TCP 22 和 sshPort 以免失去管理入口
+// 安全列表按子网共享，同一子网的其他实例也会受影响
+func (s *OCIService) TightenIngressRules(ctx context.Context, user *models.OciUser, vnicIDs []string, sshPort int) (int, error) {
+	vnClient, err := s.GetVirtualNetworkClient(user)
+	if err != nil {
+		return 0, err
+	}
+
+	listIDs := map[string]bool{}
+	for _, vnicID := range vnicIDs {
+		vnicResp, err := vnClient.GetVnic(ctx, core.GetVnicRequest{VnicId: common.String(vnicID)})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get VNIC: %w", err)
+		}
+		subnetResp, err := vnClient.GetSubnet(ctx, core.GetSubnetRequest{SubnetId: vnicResp.SubnetId})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get subnet: %w", err)
+		}
+		for _, id := range subnetResp.SecurityListIds {
+			listIDs[id] = true
+		}
+	}
+
+	removed := 0
+	for listID := range listIDs {
+		secList, err := vnClient.GetSecurityList(ctx, core.GetSecurityListRequest{SecurityListId: common.String(listID)})
+		if err != nil {
+			return removed, fmt.Errorf("failed to get security list: %w", err)
+		}
+		kept := make([]core.IngressSecurityRule, 0, len(secList.IngressSecurityRules))
+		for _, rule := range secList.IngressSecurityRules {
+			source := stringValue(rule.Source)
+			if (source == "0.0.0.0/0" || source == "::/0") && !isSSHIngressRule(rule, sshPort) {
+				continue
+			}
+			kept = append(kept, rule)
+		}
+		if len(kept) == len(secList.IngressSecurityRules) {
+			continue
+		}
+		_, err = vnClient.UpdateSecurityList(ctx, core.UpdateSecurityListRequest{
+			SecurityListId:            common.String(listID),
+			UpdateSecurityListDetails: core.UpdateSecurityListDetails{IngressSecurityRules: kept},
+		})
+		if err != nil {
+			return removed, fmt.Errorf("failed to update security list: %w", err)
+		}
+		removed += len(secList.IngressSecurityRules) - len(kept)
+	}
+	return removed, nil
+}
+
+// isSSHIngressRule 判断入站规则是否只放行 TCP 22 或 sshPort 端口
+func isSSHIngressRule(rule core.IngressSecurityRule, sshPort int) bool {
+	if stringValue(rule.Protocol) != "6" || rule.TcpOptions == nil || rule.TcpOptions.DestinationPortRange == nil {
+		return false
+	}
+	portRange := rule.TcpOptions.DestinationPortRange
+	if portRange.Min == nil || portRange.Max == nil || *portRange.Min != *portRange.Max {
+		return false
+	}
+	return *portRange.Min == 22 || (sshPort > 0 && *portRange.Min == sshPort)
+}
+
+// TrafficQuotaStatus 配额及本月出站流量
+type TrafficQuotaStatus struct {
+	models.OciTrafficQuota
+	Percent float64 `json:"percent"`
+}
+
+// SetTrafficQuotaParams 设置流量配额参数，InstanceID 为空时对整个配置生效
+type SetTrafficQuotaParams struct {
+	ConfigID     string
+	InstanceID   string
+	LimitBytes   int64
+	WarnPercents []int
+	Action       string
+}
+
+type TrafficQuotaService struct {
+	ociService *OCIService
+	telegram   *TelegramService
+	checking   atomic.Bool
+}
+
+func NewTrafficQuotaService(ociService *OCIService, telegram *TelegramService) *TrafficQuotaService {
+	return &TrafficQuotaService{
+		ociService: ociService,
+		telegram:   telegram,
+	}
+}
+
+func normalizeTrafficAction(action string) (string, error) {
+	switch action {
+	case "", TrafficActionNone:
+		return TrafficActionNone, nil
+	case TrafficActionStop, TrafficActionDetachIP, TrafficActionTightenRules:
+		return action, nil
+	}
+	return "", fmt.Errorf("不支持的动作: %s", action)
+}
+
+// normalizeWarnPercents 去重排序告警阈值，只保留 1-99 之间的值
+func normalizeWarnPercents(percents []int) ([]int, error) {
+	if len(percents) == 0 {
+		return append([]int(nil), defaultTrafficWarnPercents...), nil
+	}
+	seen := map[int]bool{}
+	result := []int{}
+	for _, p := range percents {
+		if p <= 0 || p >= 100 {
+			return nil, fmt.Errorf("告警阈值必须在 1-99 之间: %d", p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	sort.Ints(result)
+	return result, nil
+}
+
+// SetQuota 创建或更新流量配额，阈值或限额变化后重新评估本月状态
+func (s *TrafficQuotaService) SetQuota(params SetTrafficQuotaParams) (*models.OciTrafficQuota, error) {
+	if params.LimitBytes < 0 {
+		return nil, fmt.Errorf("流量限额不能为负数")
+	}
+	if params.LimitBytes == 0 {
+		params.LimitBytes = DefaultTrafficLimitBytes
+	}
+	action, err := normalizeTrafficAction(params.Action)
+	if err != nil {
+		return nil, err
+	}
+	percents, err := normalizeWarnPercents(params.WarnPercents)
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", params.ConfigID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("配置不存在")
+	}
+
+	var record models.OciTrafficQuota
+	err = db.Where("config_id = ? AND instance_id = ?", params.ConfigID, params.InstanceID).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	isNew := err != nil
+	if isNew {
+		record = models.OciTrafficQuota{ID: uuid.New().String(), ConfigID: params.ConfigID, InstanceID: params.InstanceID}
+	}
+	if record.LimitBytes != params.LimitBytes || fmt.Sprint(record.WarnPercents) != fmt.Sprint(percents) {
+		record.NotifiedPercent = 0
+		record.ActionTaken = false
+	}
+	record.LimitBytes = params.LimitBytes
+	record.WarnPercents = percents
+	record.Action = action
+
+	if isNew {
+		err = db.Create(&record).Error
+	} else {
+		err = db.Save(&record).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListQuotas 获取配置的所有流量配额
+func (s *TrafficQuotaService) ListQuotas(configID string) ([]TrafficQuotaStatus, error) {
+	var records []models.OciTrafficQuota
+	if err := database.GetDB().Where("config_id = ?", configID).Order("instance_id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	result := make([]TrafficQuotaStatus, 0, len(records))
+	for _, record := range records {
+		result = append(result, quotaStatus(record))
+	}
+	return result, nil
+}
+
+func quotaStatus(record models.OciTrafficQuota) TrafficQuotaStatus {
+	status := TrafficQuotaStatus{OciTrafficQuota: record}
+	if record.LimitBytes > 0 {
+		status.Percent = roundAmount(float64(record.LastEgress) / float64(record.LimitBytes) * 100)
+	}
+	return status
+}
+
+// DeleteQuota 删除流量配额
+func (s *TrafficQuotaService) DeleteQuota(id string) error {
+	result := database.GetDB().Where("id = ?", id).Delete(&models.OciTrafficQuota{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListLogs 获取配置最近的流量配额记录
+func (s *TrafficQuotaService) ListLogs(configID string, limit int) ([]models.OciTrafficQuotaLog, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var logs []models.OciTrafficQuotaLog
+	err := database.GetDB().Where("config_id = ?", configID).Order("create_time DESC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// CheckDue 检查超过检查间隔的配置，由调度器每分钟调用，上一轮未结束时跳过
+func (s *TrafficQuotaService) CheckDue() {
+	if !s.checking.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.checking.Store(false)
+
+	var quotas []models.OciTrafficQuota
+	if err := database.GetDB().Find(&quotas).Error; err != nil {
+		return
+	}
+	due := map[string]bool{}
+	for _, quota := range quotas {
+		if quota.LastChecked == nil || time.Since(*quota.LastChecked) >= TrafficQuotaCheckInterval {
+			due[quota.ConfigID] = true
+		}
+	}
+	for configID := range due {
+		if _, err := s.Check(configID); err != nil {
+			slog.Error("Failed to check traffic quota", "config_id", configID, "error", err)
+			// 记录本次尝试时间，失败后同样按检查间隔重试
+			database.GetDB().Model(&models.OciTrafficQuota{}).Where("config_id = ?", configID).Update("last_checked", time.Now())
+		}
+	}
+}
+
+// Check 立即统计配置本月出站流量并评估其所有配额
+func (s *TrafficQuotaService) Check(configID string) ([]TrafficQuotaStatus, error) {
+	db := database.GetDB()
+	var user models.OciUser
+	if err := db.Where("id = ?", configID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("配置不存在")
+	}
+	var quotas []models.OciTrafficQuota
+	if err := db.Where("config_id = ?", configID).Order("instance_id").Find(&quotas).Error; err != nil {
+		return nil, err
+	}
+	if len(quotas) == 0 {
+		return []TrafficQuotaStatus{}, nil
+	}
+
+	egress, errs := s.ociService.CollectMonthlyEgress(context.Background(), &user)
+	if len(egress) == 0 && len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	for _, e := range errs {
+		slog.Warn("Partial egress data for traffic quota", "config", user.Username, "config_id", user.ID, "error", e)
+	}
+
+	result := make([]TrafficQuotaStatus, 0, len(quotas))
+	for i := range quotas {
+		s.evaluate(&user, &quotas[i], egress)
+		result = append(result, quotaStatus(quotas[i]))
+	}
+	return result, nil
+}
+
+// evaluate 评估单个配额：每个阈值每月只通知一次，达到 100% 时执行一次配置的动作
+func (s *TrafficQuotaService) evaluate(user *models.OciUser, quota *models.OciTrafficQuota, egress []InstanceEgress) {
+	// 与出站流量统计的月初（UTC）保持一致
+	month := CurrentCostPeriod()
+	if quota.Month != month {
+		quota.Month = month
+		quota.NotifiedPercent = 0
+		quota.ActionTaken = false
+	}
+
+	var used int64
+	var targets []InstanceEgress
+	for _, item := range egress {
+		if quota.InstanceID == "" {
+			used += item.Bytes
+			if item.Bytes > 0 {
+				targets = append(targets, item)
+			}
+		} else if item.InstanceID == quota.InstanceID {
+			used = item.Bytes
+			targets = []InstanceEgress{item}
+			quota.InstanceName = item.Name
+		}
+	}
+	now := time.Now()
+	quota.LastEgress = used
+	quota.LastChecked = &now
+
+	scope := "整个配置"
+	if quota.InstanceID != "" {
+		scope = "实例 " + quota.InstanceName
+	}
+	percent := float64(used) / float64(quota.LimitBytes) * 100
+	thresholds := append(append([]int{}, quota.WarnPercents...), 100)
+	crossed := 0
+	for _, threshold := range thresholds {
+		if percent >= float64(threshold) {
+			crossed = threshold
+		}
+	}
+
+	if crossed > quota.NotifiedPercent {
+		quota.NotifiedPercent = crossed
+		summary := fmt.Sprintf("配置：%s\n范围：%s\n本月出站：%s / %s（%.1f%%）",
+			html.EscapeString(user.Username), html.EscapeString(scope), FormatBytes(used), FormatBytes(quota.LimitBytes), percent)
+		s.writeLog(quota, quota.InstanceID, TrafficEventWarn, fmt.Sprintf("%s 出站流量达到 %d%%：%s / %s",
+			scope, crossed, FormatBytes(used), FormatBytes(quota.LimitBytes)))
+		if crossed < 100 {
+			s.notify(fmt.Sprintf("📶 出站流量已使用 %d%%", crossed), summary)
+		} else if quota.Action == TrafficActionNone {
+			s.notify("🚨 出站流量已超出配额", summary)
+		}
+	}
+
+	if crossed >= 100 && quota.Action != TrafficActionNone && !quota.ActionTaken {
+		quota.ActionTaken = true
+		var done, failed []string
+		for _, target := range targets {
+			detail, err := s.applyAction(user, quota.Action, target)
+			label := fmt.Sprintf("%s（%s）", target.Name, target.Region)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", label, err))
+				s.writeLog(quota, target.InstanceID, TrafficEventError, fmt.Sprintf("%s %s 失败: %v", label, quota.Action, err))
+				continue
+			}
+			done = append(done, label+" "+detail)
+			s.writeLog(quota, target.InstanceID, TrafficEventAction, label+" "+detail)
+		}
+		message := fmt.Sprintf("配置：%s\n范围：%s\n本月出站：%s / %s\n动作：%s",
+			html.EscapeString(user.Username), html.EscapeString(scope), FormatBytes(used), FormatBytes(quota.LimitBytes), quota.Action)
+		if len(done) > 0 {
+			message += "\n" + html.EscapeString(strings.Join(done, "\n"))
+		}
+		if len(failed) > 0 {
+			message += "\n失败：\n" + html.EscapeString(strings.Join(failed, "\n"))
+		}
+		s.notify("🛑 出站流量超出配额，已执行限制动作", message)
+	}
+
+	database.GetDB().Save(quota)
+}
+
+// applyAction 对超额实例执行动作，返回执行结果描述
+func (s *TrafficQuotaService) applyAction(user *models.OciUser, action string, target InstanceEgress) (string, error) {
+	ctx := context.Background()
+	regionUser := *user
+	regionUser.OciRegion = target.Region
+
+	switch action {
+	case TrafficActionStop:
+		if target.State != string(core.InstanceLifecycleStateRunning) {
+			return "未运行，已跳过停止", nil
+		}
+		if err := s.ociService.InstanceAction(ctx, &regionUser, target.InstanceID, string(core.InstanceActionActionSoftstop)); err != nil {
+			return "", err
+		}
+		return "已停止", nil
+	case TrafficActionDetachIP:
+		detached, err := s.ociService.DetachPublicIPs(ctx, &regionUser, target.VnicIDs)
+		if err != nil {
+			return "", err
+		}
+		if len(detached) == 0 {
+			return "没有公网 IP", nil
+		}
+		return "已移除公网 IP " + strings.Join(detached, ", "), nil
+	case TrafficActionTightenRules:
+		// 创建实例时设置了自定义 SSH 端口的，同时保留该端口
+		sshPort := 22
+		var cred models.InstanceCredential
+		if database.GetDB().Where("instance_id = ?", target.InstanceID).First(&cred).Error == nil && cred.SSHPort > 0 {
+			sshPort = cred.SSHPort
+		}
+		removed, err := s.ociService.TightenIngressRules(ctx, &regionUser, target.VnicIDs, sshPort)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("已删除 %d 条公网入站规则", removed), nil
+	}
+	return "", fmt.Errorf("不支持的动作: %s", action)
+}
+
+func (s *TrafficQuotaService) writeLog(quota *models.OciTrafficQuota, instanceID, event, message string) {
+	level := slog.LevelWarn
+	if event == TrafficEventError {
+		level = slog.LevelError
+	}
+	slog.Log(context.Background(), level, "Traffic quota event", "event", event, "config_id", quota.ConfigID, "instance_id", instanceID, "message", message)
+	entry := models.OciTrafficQuotaLog{
+		ID:         uuid.New().String(),
+		QuotaID:    quota.ID,
+		ConfigID:   quota.ConfigID,
+		InstanceID: instanceID,
+		Event:      event,
+		Message:    message,
+	}
+	if err := database.GetDB().Create(&entry).Error; err != nil {
+		slog.Error("Failed to save traffic quota log", "config_id", quota.ConfigID, "error", err)
+	}
+}
+
+func (s *TrafficQuotaService) notify(title, message string) {
+	if s.telegram == nil {
+		return
+	}
+	if err := s.telegram.SendNotification(title, message); err != nil {
+		slog.Warn("Failed to send traffic quota notification", "error", err)
+	}
+}
@@ -1,81 +1,235 @@
 package services
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/adiecho/oci-panel/internal/logger"
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// LogTopicAll 订阅全部日志，包括没有主题的日志
+	LogTopicAll = "all"
+
+	wsSendBuffer   = 64
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsClient 日志流连接，写操作只在 writePump 中执行
+type wsClient struct {
+	conn   *websocket.Conn
+	send   chan []byte
+	mu     sync.Mutex // 保护 level 和 topics
+	level  slog.Level
+	topics map[string]bool
+}
+
+// accepts 判断连接是否订阅了该级别和主题的日志
+func (c *wsClient) accepts(level slog.Level, topics []string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if level < c.level {
+		return false
+	}
+	if c.topics[LogTopicAll] {
+		return true
+	}
+	for _, t := range topics {
+		if c.topics[t] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *wsClient) writePump() {
+	defer c.conn.Close()
+	for data := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			// 关闭连接后读循环退出并注销，剩余消息直接丢弃
+			c.conn.Close()
+			for range c.send {
+			}
+			return
+		}
+	}
+}
+
+// wsMessage 待广播的日志，level 和 topics 用于按连接过滤
+type wsMessage struct {
+	level  slog.Level
+	topics []string
+	data   []byte
+}
+
 type WebSocketService struct {
-	clients    map[*websocket.Conn]bool
-	broadcast  chan []byte
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
-	mu         sync.RWMutex
+	clients   map[*websocket.Conn]*wsClient
+	broadcast chan wsMessage
+	mu        sync.RWMutex
+	minLevel  atomic.Int64 // 所有连接中最低的日志级别，没有连接时为 math.MaxInt64
 }
 
 func NewWebSocketService() *WebSocketService {
 	ws := &WebSocketService{
-		clients:    make(map[*websocket.Conn]bool),
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
+		clients:   make(map[*websocket.Conn]*wsClient),
+		broadcast: make(chan wsMessage, 256),
 	}
+	ws.minLevel.Store(math.MaxInt64)
 	go ws.run()
 	return ws
 }
 
+// run 把日志分发到各连接的发送队列，不在持锁时做网络写入；队列已满的慢连接会被断开
 func (ws *WebSocketService) run() {
-	for {
-		select {
-		case client := <-ws.register:
-			ws.mu.Lock()
-			ws.clients[client] = true
-			ws.mu.Unlock()
-			log.Printf("Client connected. Total clients: %d", len(ws.clients))
-
-		case client := <-ws.unregister:
-			ws.mu.Lock()
-			if _, ok := ws.clients[client]; ok {
-				delete(ws.clients, client)
-				client.Close()
+	for message := range ws.broadcast {
+		var slow []*websocket.Conn
+		ws.mu.RLock()
+		for conn, client := range ws.clients {
+			if !client.accepts(message.level, message.topics) {
+				continue
 			}
-			ws.mu.Unlock()
-			log.Printf("Client disconnected. Total clients: %d", len(ws.clients))
-
-		case message := <-ws.broadcast:
-			ws.mu.RLock()
-			for client := range ws.clients {
-				err := client.WriteMessage(websocket.TextMessage, message)
-				if err != nil {
-					log.Printf("Error writing to client: %v", err)
-					client.Close()
-					delete(ws.clients, client)
-				}
+			select {
+			case client.send <- message.data:
+			default:
+				slow = append(slow, conn)
 			}
-			ws.mu.RUnlock()
+		}
+		ws.mu.RUnlock()
+		for _, conn := range slow {
+			ws.UnregisterClient(conn)
 		}
 	}
 }
 
-func (ws *WebSocketService) RegisterClient(conn *websocket.Conn) {
-	ws.register <- conn
+func (ws *WebSocketService) updateMinLevelLocked() {
+	min := int64(math.MaxInt64)
+	for _, client := range ws.clients {
+		client.mu.Lock()
+		if int64(client.level) < min {
+			min = int64(client.level)
+		}
+		client.mu.Unlock()
+	}
+	ws.minLevel.Store(min)
 }
 
+// RegisterClient 注册已认证的日志流连接，只接收不低于 level 且匹配 topics 的日志，topics 为空时订阅全部
+func (ws *WebSocketService) RegisterClient(conn *websocket.Conn, level slog.Level, topics []string) {
+	client := &wsClient{
+		conn:   conn,
+		send:   make(chan []byte, wsSendBuffer),
+		level:  level,
+		topics: map[string]bool{},
+	}
+	if len(topics) == 0 {
+		topics = []string{LogTopicAll}
+	}
+	for _, t := range topics {
+		client.topics[t] = true
+	}
+	go client.writePump()
+
+	ws.mu.Lock()
+	ws.clients[conn] = client
+	ws.updateMinLevelLocked()
+	total := len(ws.clients)
+	ws.mu.Unlock()
+	slog.Debug("Log stream client connected", "clients", total)
+}
+
+// UnregisterClient 注销连接，发送队列中剩余的消息写完后关闭连接
 func (ws *WebSocketService) UnregisterClient(conn *websocket.Conn) {
-	ws.unregister <- conn
+	ws.mu.Lock()
+	client, ok := ws.clients[conn]
+	if ok {
+		delete(ws.clients, conn)
+		close(client.send)
+	}
+	ws.updateMinLevelLocked()
+	total := len(ws.clients)
+	ws.mu.Unlock()
+	if ok {
+		slog.Debug("Log stream client disconnected", "clients", total)
+	}
+}
+
+func (ws *WebSocketService) getClient(conn *websocket.Conn) *wsClient {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	return ws.clients[conn]
+}
+
+// SetClientLevel 修改连接接收的最低日志级别
+func (ws *WebSocketService) SetClientLevel(conn *websocket.Conn, level slog.Level) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if client, ok := ws.clients[conn]; ok {
+		client.mu.Lock()
+		client.level = level
+		client.mu.Unlock()
+		ws.updateMinLevelLocked()
+	}
+}
+
+// Subscribe 为连接增加订阅主题，返回当前订阅的全部主题
+func (ws *WebSocketService) Subscribe(conn *websocket.Conn, topics []string) []string {
+	return ws.updateTopics(conn, topics, true)
+}
+
+// Unsubscribe 取消连接的订阅主题，返回当前订阅的全部主题
+func (ws *WebSocketService) Unsubscribe(conn *websocket.Conn, topics []string) []string {
+	return ws.updateTopics(conn, topics, false)
+}
+
+func (ws *WebSocketService) updateTopics(conn *websocket.Conn, topics []string, add bool) []string {
+	client := ws.getClient(conn)
+	if client == nil {
+		return nil
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	for _, t := range topics {
+		if add {
+			client.topics[t] = true
+		} else {
+			delete(client.topics, t)
+		}
+	}
+	current := make([]string, 0, len(client.topics))
+	for t := range client.topics {
+		current = append(current, t)
+	}
+	sort.Strings(current)
+	return current
+}
+
+// SendToClient 只向指定连接发送消息，队列已满时丢弃
+func (ws *WebSocketService) SendToClient(conn *websocket.Conn, data []byte) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	if client, ok := ws.clients[conn]; ok {
+		select {
+		case client.send <- data:
+		default:
+		}
+	}
 }
 
 func (ws *WebSocketService) BroadcastMessage(message []byte) {
-	ws.broadcast <- message
+	ws.broadcast <- wsMessage{level: slog.LevelInfo, data: message}
 }
 
 func (ws *WebSocketService) SendLog(level string, message string) {
 	logMsg := fmt.Sprintf("[%s] %s: %s", time.Now().Format("2006-01-02 15:04:05"), level, message)
-	ws.BroadcastMessage([]byte(logMsg))
+	ws.broadcast <- wsMessage{level: logger.ParseLevel(level), data: []byte(logMsg)}
 }
 
 func (ws *WebSocketService) SendInfo(message string) {
@@ -99,13 +253,78 @@ func (ws *WebSocketService) SendSuccess(message string) {
 }
 
 type LogMessage struct {
-	Time    string `json:"time"`
-	Level   string `json:"level"`
-	Message string `json:"message"`
+	Time    string         `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"message"`
+	Topics  []string       `json:"topics,omitempty"`
+	Fields  map[string]any `json:"fields,omitempty"`
 }
 
 func (ws *WebSocketService) SendStructuredLog(logMsg LogMessage) {
-	import_json := fmt.Sprintf(`{"time":"%s","level":"%s","message":"%s"}`,
-		logMsg.Time, logMsg.Level, logMsg.Message)
-	ws.BroadcastMessage([]byte(import_json))
+	data, err := json.Marshal(logMsg)
+	if err != nil {
+		return
+	}
+	ws.broadcast <- wsMessage{level: logger.ParseLevel(logMsg.Level), topics: logMsg.Topics, data: data}
+}
+
+// Enabled 是否有连接订阅该级别的日志，实现 logger.Sink
+func (ws *WebSocketService) Enabled(level slog.Level) bool {
+	return int64(level) >= ws.minLevel.Load()
+}
+
+// Publish 把结构化日志转发给日志流，实现 logger.Sink
+// 缓冲区已满时丢弃，避免日志调用阻塞业务或在广播循环内死锁
+func (ws *WebSocketService) Publish(record logger.Record) {
+	logMsg := LogMessage{
+		Time:    record.Time.Format("2006-01-02 15:04:05"),
+		Level:   logger.LevelName(record.Level),
+		Message: record.Message,
+		Topics:  logTopics(record.Attrs),
+	}
+	if len(record.Attrs) > 0 {
+		logMsg.Fields = record.Attrs
+	}
+	data, err := json.Marshal(logMsg)
+	if err != nil {
+		// 字段中有无法序列化的值时退化为字符串
+		for k, v := range logMsg.Fields {
+			logMsg.Fields[k] = fmt.Sprint(v)
+		}
+		if data, err = json.Marshal(logMsg); err != nil {
+			return
+		}
+	}
+	select {
+	case ws.broadcast <- wsMessage{level: record.Level, topics: logMsg.Topics, data: data}:
+	default:
+	}
+}
+
+// logTopics 根据日志字段生成主题：task:<id>、job:<id>、rescue:<instance_id>、config:<id>、instance:<id>，以及显式的 topic 字段
+func logTopics(attrs map[string]any) []string {
+	var topics []string
+	str := func(key string) string {
+		s, _ := attrs[key].(string)
+		return s
+	}
+	if t := str("topic"); t != "" {
+		topics = append(topics, t)
+	}
+	if id := str("task_id"); id != "" {
+		topics = append(topics, "task:"+id)
+	}
+	if id := str("job_id"); id != "" {
+		topics = append(topics, "job:"+id)
+	}
+	if id := str("instance_id"); id != "" {
+		if str("operation") == "auto_rescue" {
+			topics = append(topics, "rescue:"+id)
+		}
+		topics = append(topics, "instance:"+id)
+	}
+	if id := str("config_id"); id != "" {
+		topics = append(topics, "config:"+id)
+	}
+	return topics
 }
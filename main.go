@@ -1,41 +1,125 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/adiecho/oci-panel/internal/config"
 	"github.com/adiecho/oci-panel/internal/database"
+	"github.com/adiecho/oci-panel/internal/logger"
 	"github.com/adiecho/oci-panel/internal/router"
+	appservices "github.com/adiecho/oci-panel/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
+// defaultShutdownTimeout 未配置 server.shutdown_timeout 时的关闭等待时间
+const defaultShutdownTimeout = 25 * time.Second
+
 func main() {
 	cfg := config.Load()
+	logger.Setup(cfg.Logging.Level)
 
 	if err := database.InitDB(cfg.Database.DSN); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
 	}
+	appservices.BackfillSSHKeyFingerprints()
 
-	r := gin.Default()
+	if logger.ParseLevel(cfg.Logging.Level) > slog.LevelDebug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.New()
 	services := router.Setup(r, cfg)
 
+	// 标记上次关闭时未完成的操作，需要在接受新请求前执行
+	services.Operations.RecoverInterrupted(services.Telegram)
+
 	// 启动定时任务服务
 	services.Scheduler.Start()
-	defer services.Scheduler.Stop()
 
 	// 启动创建实例任务服务
 	services.Task.Start()
-	defer services.Task.Stop()
+
+	// 启动配置凭据健康检查
+	services.Health.Start()
+
+	// 启动租户安全报告定时扫描
+	services.Security.Start()
+
+	// 启动流量历史采集
+	services.Traffic.Start()
+
+	// 启动 Always Free 实例空闲回收风险评估
+	services.IdleGuard.Start()
+
+	// 恢复上次未完成的后台任务并启动工作池
+	services.Jobs.Start()
 
 	// 启动 Telegram Bot（如果已配置并启用）
 	_, _, tgEnabled := services.Telegram.GetConfig()
 	if tgEnabled {
 		services.Telegram.StartBot()
-		defer services.Telegram.StopBot()
 	}
 
-	log.Printf("Server starting on port %s", cfg.Server.Port)
-	if err := r.Run(":" + cfg.Server.Port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: r,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "port", cfg.Server.Port, "log_level", logger.LevelName(logger.ParseLevel(cfg.Logging.Level)))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutdown signal received")
+	case err := <-serverErr:
+		slog.Error("Failed to start server", "error", err)
+		exitCode = 1
+	}
+	stop()
+
+	timeout := defaultShutdownTimeout
+	if cfg.Server.ShutdownTimeout > 0 {
+		timeout = time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	// 先停止后台服务，不再产生新的定时操作
+	services.Scheduler.Stop()
+	services.Task.Stop()
+	services.Health.Stop()
+	services.Security.Stop()
+	services.Traffic.Stop()
+	services.IdleGuard.Stop()
+	services.Jobs.Stop()
+
+	// 停止接受新请求并等待进行中的请求返回
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP server shutdown incomplete", "error", err)
+	}
+
+	// 等待执行中的后台任务和长时间操作完成，超时则取消并保留检查点
+	if remaining := services.Operations.Shutdown(shutdownCtx); len(remaining) > 0 {
+		slog.Warn("Operations interrupted by shutdown", "count", len(remaining))
+	}
+
+	if tgEnabled {
+		services.Telegram.StopBot()
 	}
+	cancel()
+	slog.Info("Server stopped")
+	os.Exit(exitCode)
 }